@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/eicca/mvmv/pkg/mvmv"
+	"github.com/spf13/cobra"
+)
+
+// runDiff reports what merging a source into a target would move and skip
+func runDiff(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	ctx, stop := interruptContext(cmd.Context())
+	defer stop()
+
+	workers, _ := cmd.Flags().GetInt("workers")
+	output, _ := cmd.Flags().GetString("output")
+	if output != mvmv.OutputText && output != mvmv.OutputJSON {
+		return usageError{errors.New("--output: want text or json")}
+	}
+
+	t := mvmv.ParseTransfer(args[0], cleanPath(args[1]))
+	result, err := mvmv.Diff(ctx, t.Source, t.Target, mvmv.Options{Workers: workers})
+
+	// Only a walk that got going has counts to show
+	var runErr *mvmv.RunError
+	if err != nil && !errors.As(err, &runErr) && ctx.Err() == nil {
+		return err
+	}
+	if output == mvmv.OutputJSON {
+		json.NewEncoder(os.Stdout).Encode(result)
+	} else {
+		result.Print(os.Stdout)
+	}
+	return interrupted(ctx, partial(err, true))
+}
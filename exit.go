@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/eicca/mvmv/pkg/mvmv"
+	"github.com/spf13/cobra"
+)
+
+// Exit statuses, listed in the README so scripts can tell failures apart
+const (
+	// exitFailure is a run that moved nothing, or any failure not covered
+	// by the statuses below
+	exitFailure = 1
+	// exitUsage is an invalid argument, flag value or flag combination
+	exitUsage = 2
+	// exitInvalidPath is a source or target that can't be used; nothing
+	// was moved
+	exitInvalidPath = 3
+	// exitPartial is a run that finished but had some operations fail
+	exitPartial = 4
+	// exitInterrupted is a run stopped by SIGINT or SIGTERM, matching the
+	// shell convention of 128 + SIGINT
+	exitInterrupted = 130
+)
+
+// usageError marks an error in the command line itself
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error { return e.error }
+
+// partialError marks a run that failed after completing some operations
+type partialError struct {
+	error
+}
+
+func (e partialError) Unwrap() error { return e.error }
+
+// usageArgs turns the errors of an argument check into usage errors
+func usageArgs(check cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := check(cmd, args); err != nil {
+			return usageError{err}
+		}
+		return nil
+	}
+}
+
+// flagError turns a flag parsing error into a usage error
+func flagError(_ *cobra.Command, err error) error {
+	return usageError{err}
+}
+
+// partial marks the error of a run as partial when it got some work done
+// before its failures. With FailFast the run stops with the failed
+// operation itself rather than a RunError.
+func partial(err error, progressed bool) error {
+	var (
+		runErr  *mvmv.RunError
+		moveErr *mvmv.MoveError
+	)
+	if progressed && (errors.As(err, &runErr) || errors.As(err, &moveErr)) {
+		return partialError{err}
+	}
+	return err
+}
+
+// exitCode maps the error returned by Execute to the process exit status.
+// A cancelled context only comes from a signal, so it counts as one.
+func exitCode(err error) int {
+	var (
+		usage   usageError
+		options *mvmv.OptionsError
+		pathErr *mvmv.PathError
+		partErr partialError
+	)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errInterrupted), errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &usage), errors.As(err, &options):
+		return exitUsage
+	case errors.As(err, &pathErr):
+		return exitInvalidPath
+	case errors.As(err, &partErr):
+		return exitPartial
+	default:
+		return exitFailure
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/eicca/mvmv/pkg/mvmv"
+)
+
+func TestExitCode(t *testing.T) {
+	runErr := &mvmv.RunError{Errors: 2}
+	moveErr := &mvmv.MoveError{Op: "rename", SourcePath: "/src/a", TargetPath: "/dst/a", Err: errors.New("input/output error")}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"run failed", runErr, exitFailure},
+		{"run failed without progress", partial(runErr, false), exitFailure},
+		{"partial", partial(runErr, true), exitPartial},
+		{"partial wrapped", fmt.Errorf("moving: %w", partial(runErr, true)), exitPartial},
+		{"fail fast", partial(moveErr, true), exitPartial},
+		{"fail fast without progress", partial(moveErr, false), exitFailure},
+		{"other error after progress", partial(errors.New("disk on fire"), true), exitFailure},
+		{"options", &mvmv.OptionsError{Err: errors.New("quiet and verbose output can't be combined")}, exitUsage},
+		{"usage", usageError{errors.New("accepts 2 arg(s)")}, exitUsage},
+		{"path", &mvmv.PathError{Err: errors.New("source does not exist")}, exitInvalidPath},
+		{"interrupted", errInterrupted, exitInterrupted},
+		{"interrupted after progress", interrupted(cancelled(), partial(runErr, true)), exitInterrupted},
+		{"context canceled", context.Canceled, exitInterrupted},
+		{"other", errors.New("unexpected"), exitFailure},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+// cancelled returns a context that is already cancelled
+func cancelled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
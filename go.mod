@@ -2,8 +2,13 @@ module github.com/eicca/mvmv
 
 go 1.23.5
 
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/spf13/cobra v1.9.1
+	golang.org/x/sys v0.13.0
+)
+
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/cobra v1.9.1 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
 )
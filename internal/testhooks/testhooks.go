@@ -0,0 +1,9 @@
+// Package testhooks reaches into unexported parts of package mvmv that
+// exist for testing only, so the CLI can wire them to hidden flags without
+// making them part of the library's API.
+package testhooks
+
+// SetFaultInjector sets the fault injector of the *mvmv.Options opts: inject
+// is called with the source path before every rename, and an error it
+// returns is taken as the rename's own. Package mvmv installs it.
+var SetFaultInjector func(opts any, inject func(path string) error)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/eicca/mvmv/pkg/mvmv"
 	"github.com/spf13/cobra"
 )
 
@@ -17,7 +18,7 @@ var (
 func main() {
 	if err := Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -27,19 +28,153 @@ func Execute() error {
 }
 
 var rootCmd = &cobra.Command{
-	Use:   "mvmv SOURCE TARGET",
+	Use:   "mvmv SOURCE... TARGET | mvmv --from-file PAIRS | mvmv --shard SOURCE TARGET...",
 	Short: "Parallel move tool for large directory structures",
 	Long: `mvmv is a parallel file move utility designed for merging massive
-directory structures efficiently.`,
+directory structures efficiently.
+
+Like rsync, a source with a trailing slash has its contents merged into the
+target, while one without is moved into the target as a directory of the same
+name. Several sources may be given, and quoted glob patterns in them are
+expanded to the matching directories; the last argument is the target.
+With --from-file, the sources and their targets are read from a file instead.`,
 	Version: fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date),
-	Args:    cobra.ExactArgs(2),
+	Args:    usageArgs(moveArgs),
 	RunE:    runMove,
+
+	// main reports the error itself
+	SilenceErrors: true,
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo MANIFEST",
+	Short: "Move the entries recorded in a --manifest file back to their sources",
+	Long: `undo reverses a run recorded with --manifest, moving every target back to
+its original path, newest first. Entries whose target no longer exists are
+skipped; entries whose original path is occupied again are reported as
+conflicts and left alone.`,
+	Args: usageArgs(cobra.ExactArgs(1)),
+	RunE: runUndo,
+
+	SilenceErrors: true,
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff SOURCE TARGET",
+	Short: "Count what merging SOURCE into TARGET would move and skip, without moving anything",
+	Long: `diff walks the source and target trees side by side and reports the files
+only in the source, which would be moved, the files only in the target, and
+the files in both, which would be skipped, with their counts and sizes.
+SOURCE is resolved like a source of a move: with a trailing slash its
+contents are compared with TARGET, otherwise it is compared with
+TARGET/<name>. Nothing is changed.`,
+	Args: usageArgs(cobra.ExactArgs(2)),
+	RunE: runDiff,
+
+	SilenceErrors: true,
 }
 
 func init() {
-	rootCmd.Flags().IntP("workers", "w", 0, "Number of parallel workers (default: number of CPU cores)")
-	rootCmd.Flags().IntP("buffer", "b", 100000, "Job queue buffer size")
-	rootCmd.Flags().BoolP("stats", "s", false, "Show statistics during and after operation")
-	rootCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
-	rootCmd.Flags().BoolP("dry-run", "n", false, "Preview what would be moved without actually moving")
+	rootCmd.SetFlagErrorFunc(flagError)
+	rootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().BoolP("dry-run", "n", false, "List what would be restored without moving anything")
+	undoCmd.Flags().BoolP("verbose", "v", false, "Log every restored entry")
+	undoCmd.Flags().StringP("output", "o", mvmv.OutputText, "Output format: text or json")
+	undoCmd.Flags().Bool("cross-device", true, "Fall back to copy and delete when a file has to move back across filesystems")
+	undoCmd.Flags().Bool("verify", false, "Verify the SHA-256 of every file copied back across filesystems")
+	undoCmd.Flags().String("log-format", "text", "Format of log messages on stderr: text or json")
+	undoCmd.Flags().String("log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().IntP("workers", "w", 0, "Number of directories read in parallel (default: number of CPU cores)")
+	diffCmd.Flags().StringP("output", "o", mvmv.OutputText, "Output format: text or json")
+
+	addMoveFlags(rootCmd)
+}
+
+// addMoveFlags registers the flags of the move command on cmd
+func addMoveFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("workers", "w", "", "Number of parallel workers, or auto to pick by storage type (default: number of CPU cores)")
+	cmd.Flags().IntP("buffer", "b", 100000, "Number of queued jobs to reserve room for")
+	cmd.Flags().BoolP("stats", "s", false, "Show statistics during and after operation (a progress bar on terminals)")
+	cmd.Flags().Duration("stats-interval", mvmv.DefaultStatsInterval, "How often to print the live statistics line; 0 prints only the final statistics")
+	cmd.Flags().Bool("count-dir-bytes", false, "Walk directories renamed as a whole to count their data in the bytes moved")
+	cmd.Flags().Bool("resource-stats", false, "Include CPU time and peak memory in the final statistics")
+	cmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cmd.Flags().BoolP("quiet", "q", false, "Print nothing but errors, which go to stderr")
+	cmd.Flags().StringP("output", "o", mvmv.OutputText, "Output format: text or json")
+	cmd.Flags().String("manifest", "", "Append a JSON line for every completed move to this file")
+	cmd.Flags().String("summary", "", "After the run, print a summary of what moved: tree, for the target directories that received entries")
+	cmd.Flags().Int("summary-depth", 2, "Levels below the target shown by --summary tree")
+	cmd.Flags().String("checkpoint", "", "Save the source paths completed so far to this file")
+	cmd.Flags().Bool("resume", false, "Skip the paths completed according to --checkpoint")
+	cmd.Flags().String("log-format", "text", "Format of log messages on stderr: text or json")
+	cmd.Flags().String("log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	cmd.Flags().BoolP("dry-run", "n", false, "Preview what would be moved without actually moving")
+	cmd.Flags().Bool("show-conflicts", false, "Dry run listing only source files that already exist at the target, with their differences")
+	cmd.Flags().Bool("show-skipped", false, "Dry run listing only the entries that would be skipped because they exist at the target, with their differences")
+	cmd.Flags().Bool("ordered", false, "Report operations sorted by source path once the work is done")
+	cmd.Flags().BoolP("follow-symlinks", "L", false, "Replace symlinks to regular files inside the source tree with copies of those files")
+	cmd.Flags().Bool("move-symlinks", false, "Recreate symlinks at target verbatim instead of skipping them")
+	cmd.Flags().Bool("rewrite-symlinks", false, "Recreate symlinks at target, rewriting links that point inside the source tree")
+	cmd.Flags().Bool("skip-special", false, "Leave named pipes, sockets and device nodes in the source instead of moving them")
+	cmd.Flags().Bool("skip-if-in-target", false, "Skip source files that exist anywhere in the target, not just at the same path")
+	cmd.Flags().String("index-by", mvmv.IndexByName, "Key for --skip-if-in-target: name or hash")
+	cmd.Flags().String("hash-denylist", "", "File of SHA-256 digests (optionally followed by sizes) of files never to move")
+	cmd.Flags().Bool("delete-denied", false, "Delete source files matching --hash-denylist instead of leaving them")
+	cmd.Flags().BoolP("mkdir", "p", false, "Create the target directory if it doesn't exist")
+	cmd.Flags().String("dir-mode", "", "Octal permissions for every directory mvmv creates, ignoring the umask (e.g. 0755)")
+	cmd.Flags().String("target-subdir", "", "Move everything into this subdirectory of the target, created if missing (e.g. incoming/2024)")
+	cmd.Flags().Bool("overwrite", false, "Replace existing target files with the source version")
+	cmd.Flags().BoolP("overwrite-newer", "u", false, "Replace existing target files only when the source is newer")
+	cmd.Flags().Bool("replace-mismatched", false, "Remove a target file where a directory is moved, or a target directory where a file is")
+	cmd.Flags().Bool("delete-identical", false, "Delete source files whose contents match the existing target file instead of skipping them")
+	cmd.Flags().Bool("conflict-rename", false, "Keep both files when the target exists, moving the source as \"name (1).ext\"")
+	cmd.Flags().Bool("cross-device", true, "Fall back to copy and delete when source and target are on different filesystems")
+	cmd.Flags().Bool("check-space", false, "Before starting, make sure the target has room for everything copied across filesystems")
+	cmd.Flags().String("bwlimit", "", "Limit the total rate of data copied across filesystems, per second (e.g. 50M)")
+	cmd.Flags().Bool("no-temp-file", false, "Write copies across filesystems straight to the target name instead of renaming a temporary file into place")
+	cmd.Flags().String("copy-buffer", "", "Size of the buffer each copy across filesystems reads into (default 1M)")
+	cmd.Flags().BoolP("hard-links", "H", false, "Keep hard-linked files linked when copying them across filesystems")
+	cmd.Flags().Int("max-open-files", 0, "Bound the file descriptors held by concurrent cross-device copies (0 = half the ulimit, -1 = no bound)")
+	cmd.Flags().Bool("verify", false, "Verify the SHA-256 of every file copied across filesystems before deleting the source")
+	cmd.Flags().Bool("fsync", false, "Sync the directories of moved entries to disk (slower)")
+	cmd.Flags().Bool("preserve-ownership", false, "Give files copied across filesystems and created directories the source's owner (Unix)")
+	cmd.Flags().BoolP("xattrs", "X", false, "Give files copied across filesystems and created directories the source's extended attributes and ACLs (Linux)")
+	cmd.Flags().BoolP("archive", "a", false, "Preserve everything the platform allows: --preserve-ownership, --xattrs and --hard-links")
+	cmd.Flags().Bool("no-replace", false, "Use renameat2(RENAME_NOREPLACE) so the kernel never replaces an existing target (Linux)")
+	cmd.Flags().Bool("flatten", false, "Move every file straight into the target, dropping the source's directory structure")
+	cmd.Flags().String("prefix", "", "Add this prefix to the name of every file moved (e.g. 2024-01-01_)")
+	cmd.Flags().String("suffix", "", "Add this suffix to the name of every file moved, before the extension")
+	cmd.Flags().Bool("atomic-dirs", false, "Move the files of each merged directory all-or-nothing, reverting on failure")
+	cmd.Flags().Bool("prune-empty", false, "Remove source directories left empty after their contents were moved")
+	cmd.Flags().Bool("keep-tree", false, "Leave the source directory tree in place, empty, instead of moving directories")
+	cmd.Flags().String("case-collisions", mvmv.CaseCollisionError, "On a case-insensitive target, what to do with names differing only in case: error or keep (the first)")
+	cmd.Flags().Int("max-depth", 0, "Merge at most this many levels deep; deeper existing directories are reported as conflicts (0 = unlimited)")
+	cmd.Flags().Bool("sync-dir-perms", false, "Give directories merged into existing ones the source directory's permissions")
+	cmd.Flags().Bool("delete-source-on-success", false, "Remove the source directories once the run finishes without errors")
+	cmd.Flags().Bool("timings", false, "Time every rename and copy, showing each with --verbose and the slowest in the statistics")
+	cmd.Flags().Bool("checksum-manifest", false, "Write a SHA256SUMS file of the moved files to each target root, reading renamed files back to hash them")
+	cmd.Flags().Bool("debug-signal", false, "Dump queued jobs and each worker's current path to stderr on SIGUSR1")
+	cmd.Flags().Duration("stall-timeout", 0, "Warn, naming each busy worker's path, when nothing advances for this long (0 disables)")
+	cmd.Flags().Bool("stall-abort", false, "Stop the run when --stall-timeout finds it stalled")
+	cmd.Flags().String("metrics", "", "Serve live statistics as Prometheus metrics at /metrics on this address (e.g. :9090)")
+	cmd.Flags().Int("retries", 0, "Retry renames and copies failing with transient errors (EIO, EINTR, ...) this many times")
+	cmd.Flags().Duration("retry-delay", mvmv.DefaultRetryDelay, "Wait before the first retry, doubling after each one")
+	cmd.Flags().Bool("fail-fast", false, "Stop at the first failed operation instead of continuing")
+	cmd.Flags().String("max-errors", "", "Stop once more than this many operations failed, or this percentage of entries (e.g. 100 or 5%)")
+	cmd.Flags().Float64("simulate-errors", 0, "Fail this percentage of renames at random with EIO, to test error handling")
+	cmd.Flags().MarkHidden("simulate-errors")
+	cmd.Flags().String("inaccessible", mvmv.InaccessibleError, "What to do with unreadable source directories: error, fail (stop the run) or report (list them apart from errors)")
+	cmd.Flags().Duration("watch", 0, "After the main pass, keep moving newly created files for this long")
+	cmd.Flags().Duration("watch-settle", mvmv.DefaultWatchSettle, "How long a watched file must go unmodified before it is moved")
+	cmd.Flags().StringArray("include", nil, "Only move files whose name matches this glob (repeatable)")
+	cmd.Flags().String("min-size", "", "Only move files of at least this size (e.g. 10M, 2G)")
+	cmd.Flags().String("max-size", "", "Only move files of at most this size (e.g. 10M, 2G)")
+	cmd.Flags().String("newer-than", "", "Only move files modified after this time or within this age (e.g. 7d, 36h, 2024-01-31, RFC3339)")
+	cmd.Flags().String("older-than", "", "Only move files modified before this time or longer ago than this age")
+	cmd.Flags().StringArray("exclude", nil, "Leave files and directories whose name matches this glob (repeatable, wins over --include)")
+	cmd.Flags().Bool("no-ignore", false, "Don't read .mvmvignore files")
+	cmd.Flags().String("from-file", "", "Read tab-separated source and target pairs from this file instead of the arguments")
+	cmd.Flags().Bool("shard", false, "Distribute top-level source entries across multiple targets")
+	cmd.Flags().String("shard-by", mvmv.ShardRoundRobin, "Shard strategy: round-robin or size")
 }
@@ -0,0 +1,19 @@
+//go:build darwin || freebsd || netbsd
+
+package mvmv
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the file's last access time, falling back to the
+// modification time when it isn't available
+func accessTime(info os.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(st.Atimespec.Unix())
+}
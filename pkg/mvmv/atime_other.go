@@ -0,0 +1,14 @@
+//go:build !(linux || openbsd || dragonfly || solaris || darwin || freebsd || netbsd)
+
+package mvmv
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime is not available on this platform, so the modification time
+// stands in for it
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,116 @@
+package mvmv
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// movedFile records a completed file move so it can be reverted
+type movedFile struct {
+	source  string
+	target  string
+	size    int64
+	renamed bool
+}
+
+// processFilesAtomically moves the regular files among a merged directory's
+// children as a unit: if any of them fails, the files already moved are
+// renamed back and the rest are left in place. The moves are only recorded,
+// in the manifest and elsewhere, once all of them succeeded. Jobs for other
+// entries are returned for the worker pool.
+func (m *mover) processFilesAtomically(dir string, children []Job) []Job {
+	var moved []movedFile
+	var entries []ManifestEntry
+	record := func(e ManifestEntry) { entries = append(entries, e) }
+	rest := make([]Job, 0, len(children))
+	failed := false
+
+	for _, child := range children {
+		info, err := os.Lstat(child.SourcePath)
+		if err != nil || !info.Mode().IsRegular() || child.caseTwin != "" {
+			// Let processPath handle and report anything that isn't a plain
+			// file, or collides with a sibling
+			rest = append(rest, child)
+			continue
+		}
+		atomic.AddInt64(&m.stats.EntriesScanned, 1)
+		if failed {
+			continue
+		}
+
+		targetInfo, err := os.Lstat(child.TargetPath)
+		if err != nil {
+			targetInfo = nil
+		}
+		target, err := m.processFileWith(record, child.SourcePath, child.TargetPath, info, targetInfo)
+		if err != nil {
+			failed = true
+			continue
+		}
+		if target != "" {
+			moved = append(moved, movedFile{source: child.SourcePath, target: target, size: info.Size(), renamed: target != child.TargetPath})
+		}
+	}
+
+	if failed {
+		if len(moved) > 0 {
+			m.rollbackDir(dir, moved)
+		}
+		return rest
+	}
+	for _, e := range entries {
+		m.recordMove(e)
+	}
+
+	return rest
+}
+
+// rollbackDir reverts file moves in reverse order. A file copied across
+// filesystems is copied back, as its source is already gone.
+func (m *mover) rollbackDir(dir string, moved []movedFile) {
+	m.logOp(opEvent{Op: "rolled-back", Source: dir, Reason: fmt.Sprintf("%d files", len(moved))}, "Rolling back %d files in directory: %s\n", len(moved), dir)
+	atomic.AddInt64(&m.stats.DirsRolledBack, 1)
+
+	for i := len(moved) - 1; i >= 0; i-- {
+		f := moved[i]
+		if !m.opts.DryRun {
+			copied, err := m.revertFile(f)
+			if err != nil {
+				m.recordError(MoveError{Op: "rollback", SourcePath: f.target, TargetPath: f.source, Err: err}, "Failed to roll back file %s: %v", f.target)
+				continue
+			}
+			if copied {
+				atomic.AddInt64(&m.stats.FilesCopied, -1)
+			}
+		}
+		atomic.AddInt64(&m.stats.FilesMoved, -1)
+		atomic.AddInt64(&m.stats.BytesMoved, -f.size)
+		if f.renamed {
+			atomic.AddInt64(&m.stats.FilesRenamed, -1)
+		}
+		atomic.AddInt64(&m.stats.FilesRolledBack, 1)
+	}
+}
+
+// revertFile puts a moved file back at its source, renaming it or, across
+// filesystems, copying it back and removing the target. It reports whether
+// the file was copied.
+func (m *mover) revertFile(f movedFile) (bool, error) {
+	err := m.rename(f.target, f.source)
+	if err == nil || !isCrossDevice(err) {
+		return false, err
+	}
+	info, err := os.Lstat(f.target)
+	if err != nil {
+		return true, err
+	}
+	if err := m.copyData(f.target, f.source, info); err != nil {
+		return true, err
+	}
+	if err := os.Remove(f.target); err != nil {
+		return true, err
+	}
+	m.syncParents(f.source, f.target)
+	return true, nil
+}
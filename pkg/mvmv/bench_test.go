@@ -0,0 +1,90 @@
+package mvmv
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// The shape of the tree moved by the benchmarks, e.g.
+//
+//	go test -bench Move -mvmv.width 10 -mvmv.depth 2 -mvmv.files 500 ./pkg/mvmv
+var (
+	benchWidth = flag.Int("mvmv.width", 4, "subdirectories per directory of the benchmark tree")
+	benchDepth = flag.Int("mvmv.depth", 3, "depth of the benchmark tree")
+	benchFiles = flag.Int("mvmv.files", 20, "files per directory of the benchmark tree")
+)
+
+// BenchmarkMove merges a synthetic tree into a target that already has all
+// of its directories, so that every file is a job of its own and the
+// workers, rather than a single rename of the root, do the work
+func BenchmarkMove(b *testing.B) {
+	shape := treeShape{width: *benchWidth, depth: *benchDepth, files: *benchFiles}
+	for _, workers := range benchWorkers() {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			benchmarkMove(b, b.TempDir(), shape, Options{Workers: workers, Quiet: true})
+		})
+	}
+}
+
+// BenchmarkMoveCrossDevice is BenchmarkMove copying into a second filesystem
+func BenchmarkMoveCrossDevice(b *testing.B) {
+	other, err := os.MkdirTemp("/dev/shm", "mvmv-bench-")
+	if err != nil {
+		b.Skipf("No second filesystem: %v", err)
+	}
+	defer os.RemoveAll(other)
+	srcDev, _ := deviceID(statFile(b, b.TempDir()))
+	otherDev, _ := deviceID(statFile(b, other))
+	if srcDev == otherDev {
+		b.Skip("No second filesystem")
+	}
+
+	shape := treeShape{width: *benchWidth, depth: *benchDepth, files: *benchFiles}
+	for _, workers := range benchWorkers() {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			benchmarkMove(b, other, shape, Options{Workers: workers, AllowCrossDevice: true, Quiet: true})
+		})
+	}
+}
+
+// benchWorkers is the worker counts each benchmark runs with
+func benchWorkers() []int {
+	workers := []int{1, 4, runtime.GOMAXPROCS(0)}
+	slices.Sort(workers)
+	return slices.Compact(workers)
+}
+
+// benchmarkMove moves a fresh tree of the given shape under base into a
+// target holding its directories b.N times, and reports files per second
+// and the targets stated per file
+func benchmarkMove(b *testing.B, base string, shape treeShape, opts Options) {
+	var files int
+	var stats int64
+	b.ResetTimer()
+	b.StopTimer()
+	for i := 0; i < b.N; i++ {
+		src := b.TempDir()
+		dst, err := os.MkdirTemp(base, "dst-")
+		if err != nil {
+			b.Fatal(err)
+		}
+		files = createTree(b, src, shape)
+		createTree(b, dst, treeShape{width: shape.width, depth: shape.depth})
+
+		b.StartTimer()
+		result, err := Move(context.Background(), []string{src}, dst, opts)
+		b.StopTimer()
+		if err != nil {
+			b.Fatalf("Move failed: %v", err)
+		}
+		stats += result.targetStats
+		os.RemoveAll(dst)
+	}
+	b.ReportMetric(float64(files*b.N)/b.Elapsed().Seconds(), "files/s")
+	b.ReportMetric(float64(stats)/float64(files*b.N), "target-stats/file")
+}
@@ -0,0 +1,118 @@
+package mvmv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Policies for Options.CaseCollisions
+const (
+	CaseCollisionError = "error"
+	CaseCollisionKeep  = "keep"
+)
+
+// errCaseCollision is recorded for source entries whose names differ only
+// in case, which a case-insensitive target can't hold side by side
+var errCaseCollision = errors.New("name differs only in case from another entry")
+
+// validateCaseCollisions checks the Options.CaseCollisions policy
+func validateCaseCollisions(policy string) error {
+	switch policy {
+	case "", CaseCollisionError, CaseCollisionKeep:
+		return nil
+	default:
+		return fmt.Errorf("unknown case collision policy %q (want %s or %s)", policy, CaseCollisionError, CaseCollisionKeep)
+	}
+}
+
+// caseInsensitive reports whether dir is on a filesystem that ignores case
+// in names, by creating a scratch file and then one named the same in upper
+// case, which fails if the first one is found
+func caseInsensitive(dir string) (bool, error) {
+	f, err := os.CreateTemp(dir, ".mvmv-case-")
+	if err != nil {
+		return false, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	upper := filepath.Join(dir, strings.ToUpper(filepath.Base(f.Name())))
+	g, err := os.OpenFile(upper, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	g.Close()
+	os.Remove(upper)
+	return false, nil
+}
+
+// probeCaseFolding returns the target roots of seeds that are on
+// case-insensitive filesystems, or nil if there are none. A target that
+// can't be probed is taken to be case-sensitive.
+func probeCaseFolding(seeds []Job, opts *Options) map[string]bool {
+	var folding map[string]bool
+	probed := make(map[string]bool)
+	for _, seed := range seeds {
+		if probed[seed.TargetRoot] {
+			continue
+		}
+		probed[seed.TargetRoot] = true
+
+		insensitive, err := caseInsensitive(existingTarget(seed.TargetRoot))
+		if err != nil {
+			newLogger(opts).Warn("Cannot check whether the target is case-sensitive", "target", seed.TargetRoot, "error", err)
+			continue
+		}
+		if insensitive {
+			if folding == nil {
+				folding = make(map[string]bool)
+			}
+			folding[seed.TargetRoot] = true
+		}
+	}
+	return folding
+}
+
+// markCaseTwins sets caseTwin on jobs whose names differ only in case from
+// an earlier sibling's. With CaseCollisionError the first of them is marked
+// too, so none of them is moved.
+func markCaseTwins(jobs []Job, policy string) {
+	first := make(map[string]int, len(jobs))
+	for i := range jobs {
+		name := filepath.Base(jobs[i].SourcePath)
+		key := strings.ToLower(name)
+		j, seen := first[key]
+		if !seen {
+			first[key] = i
+			continue
+		}
+		jobs[i].caseTwin = filepath.Base(jobs[j].SourcePath)
+		if policy != CaseCollisionKeep && jobs[j].caseTwin == "" {
+			jobs[j].caseTwin = name
+		}
+	}
+}
+
+// caseCollision leaves an entry that collides with a sibling on a
+// case-insensitive target in the source: as an error, or as a skip when the
+// sibling is kept
+func (m *mover) caseCollision(job Job, sourceInfo os.FileInfo) {
+	if sourceInfo.IsDir() {
+		m.progress.treeDone(job.SourcePath)
+	} else {
+		m.progress.fileDone(sourceInfo.Size())
+	}
+
+	if m.opts.CaseCollisions == CaseCollisionKeep {
+		m.skip(SkipCaseCollision, opEvent{Source: job.SourcePath, Target: job.TargetPath}, "Skipping %s, keeping %s: names differ only in case\n", job.SourcePath, job.caseTwin)
+		return
+	}
+	err := fmt.Errorf("%w (%s)", errCaseCollision, job.caseTwin)
+	m.recordError(MoveError{Op: "move", SourcePath: job.SourcePath, TargetPath: job.TargetPath, Err: err}, "Cannot move %s: %v", job.SourcePath)
+}
@@ -0,0 +1,209 @@
+package mvmv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkpointInterval is how often a changed checkpoint is written out
+const checkpointInterval = 5 * time.Second
+
+// checkpointFile is the on-disk form of a checkpoint
+type checkpointFile struct {
+	// Completed lists the source paths whose whole subtree was handled
+	// without errors
+	Completed []string `json:"completed"`
+}
+
+// checkpoint tracks the source paths completed during a run. Once a
+// directory is complete its children are dropped, so the set stays about as
+// large as the part of the tree in progress.
+type checkpoint struct {
+	path string
+	// saveMu keeps an older snapshot from replacing a newer one
+	saveMu sync.Mutex
+
+	mu       sync.Mutex
+	done     map[string]bool
+	children map[string][]string
+	// failed holds the paths of failed operations and their ancestors,
+	// which are never marked complete
+	failed map[string]bool
+	dirty  bool
+}
+
+func newCheckpoint(path string, completed []string) *checkpoint {
+	c := &checkpoint{
+		path:     path,
+		done:     make(map[string]bool),
+		children: make(map[string][]string),
+		failed:   make(map[string]bool),
+	}
+	for _, p := range completed {
+		c.add(p)
+	}
+	return c
+}
+
+// loadCheckpoint reads the paths completed by an earlier run. A missing file
+// means nothing was completed yet.
+func loadCheckpoint(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read checkpoint: %w", err)
+	}
+	var f checkpointFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("cannot parse checkpoint %s: %w", path, err)
+	}
+	return f.Completed, nil
+}
+
+// add marks path complete; the caller holds the lock
+func (c *checkpoint) add(path string) {
+	if c.done[path] {
+		return
+	}
+	c.done[path] = true
+	parent := filepath.Dir(path)
+	c.children[parent] = append(c.children[parent], path)
+	c.dirty = true
+}
+
+// complete marks paths whose subtrees are done, unless something in them
+// failed. It does nothing on a nil checkpoint.
+func (c *checkpoint) complete(paths []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, path := range paths {
+		if c.failed[path] {
+			continue
+		}
+		// Directories complete after their children, which the directory
+		// now stands for
+		for _, child := range c.children[path] {
+			delete(c.done, child)
+		}
+		delete(c.children, path)
+		c.add(path)
+	}
+}
+
+// fail keeps path and every directory above it from being marked complete
+func (c *checkpoint) fail(path string) {
+	if c == nil || path == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for !c.failed[path] {
+		c.failed[path] = true
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+}
+
+// save writes the checkpoint if it changed since the last save. The file is
+// replaced atomically, so a crash leaves either the old or the new one.
+func (c *checkpoint) save() error {
+	if c == nil {
+		return nil
+	}
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	f := checkpointFile{Completed: make([]string, 0, len(c.done))}
+	for path := range c.done {
+		f.Completed = append(f.Completed, path)
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	slices.Sort(f.Completed)
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".mvmv-checkpoint-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// run saves the checkpoint every checkpointInterval until done is closed
+func (c *checkpoint) run(done <-chan struct{}, logger *slog.Logger) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.save(); err != nil {
+				logger.Warn("Cannot save checkpoint", "error", err)
+			}
+		}
+	}
+}
+
+// resumed reports whether an earlier run completed path, in which case it is
+// skipped. Each path is skipped once, so later rescans handle it again.
+func (m *mover) resumed(path string) bool {
+	if m.resume == nil {
+		return false
+	}
+	if _, ok := m.resume.LoadAndDelete(path); !ok {
+		return false
+	}
+	atomic.AddInt64(&m.stats.Resumed, 1)
+	if m.progress != nil {
+		if info, err := os.Lstat(path); err == nil {
+			if info.IsDir() {
+				m.progress.treeDone(path)
+			} else {
+				m.progress.fileDone(info.Size())
+			}
+		}
+	}
+	m.skip(SkipCheckpoint, opEvent{Source: path}, "Skipping completed path: %s\n", path)
+	return true
+}
@@ -0,0 +1,135 @@
+package mvmv
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// checksumFile is the name of the checksum manifest written to each target
+// root with ChecksumManifest
+const checksumFile = "SHA256SUMS"
+
+// checksum is the digest of a moved file, by its path below the target root
+type checksum struct {
+	path string
+	sum  string
+}
+
+// checksumList collects the digests of the files moved into each target
+// root
+type checksumList struct {
+	mu    sync.Mutex
+	roots []string
+	sums  map[string][]checksum
+}
+
+func newChecksumList(seeds []Job) *checksumList {
+	c := &checksumList{sums: make(map[string][]checksum)}
+	for _, seed := range seeds {
+		if !slices.Contains(c.roots, seed.TargetRoot) {
+			c.roots = append(c.roots, seed.TargetRoot)
+		}
+	}
+	// The innermost root claims the files below it
+	slices.SortFunc(c.roots, func(a, b string) int { return len(b) - len(a) })
+	return c
+}
+
+// addChecksums hashes what was moved to target, a file or a directory
+// moved as a whole, reading it back from the target. It runs from
+// recordMove, so files of an atomic directory are only hashed once the
+// directory committed and never after a rollback.
+func (m *mover) addChecksums(target string, typ string) {
+	if typ == ManifestDir {
+		filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				m.recordError(MoveError{Op: "checksum", SourcePath: path, Err: err}, "Cannot read %s for its checksum: %v", path)
+				return nil
+			}
+			if d.Type().IsRegular() {
+				m.addChecksum(path)
+			}
+			return nil
+		})
+		return
+	}
+	if info, err := os.Lstat(target); err == nil && info.Mode().IsRegular() {
+		m.addChecksum(target)
+	}
+}
+
+// addChecksum hashes the file at path and keeps the digest for its root
+func (m *mover) addChecksum(path string) {
+	sum, err := hashFile(path)
+	if err != nil {
+		m.recordError(MoveError{Op: "checksum", SourcePath: path, Err: err}, "Cannot compute checksum of %s: %v", path)
+		return
+	}
+	c := m.checksums
+	for _, root := range c.roots {
+		if rel, ok := relativeTo(root, path); ok {
+			c.mu.Lock()
+			c.sums[root] = append(c.sums[root], checksum{path: filepath.ToSlash(rel), sum: sum})
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// writeChecksums writes a SHA256SUMS file, sorted by path and in the format
+// of sha256sum, to every target root that received files, replacing any
+// from an earlier run. The file is written under a temporary name first.
+func (m *mover) writeChecksums() {
+	c := m.checksums
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, root := range c.roots {
+		sums := c.sums[root]
+		if len(sums) == 0 {
+			continue
+		}
+		slices.SortFunc(sums, func(a, b checksum) int { return strings.Compare(a.path, b.path) })
+		path := filepath.Join(root, checksumFile)
+		if err := writeChecksumFile(path, sums); err != nil {
+			m.recordError(MoveError{Op: "checksum", SourcePath: path, Err: err}, "Cannot write checksum manifest %s: %v", path)
+			continue
+		}
+		m.printInfo("Wrote checksums of %d files to %s\n", len(sums), path)
+	}
+}
+
+func writeChecksumFile(path string, sums []checksum) error {
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	for _, s := range sums {
+		// sha256sum marks lines whose name needs escaping with a backslash
+		name := s.path
+		if strings.ContainsAny(name, "\\\n\r") {
+			name = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r").Replace(name)
+			w.WriteString("\\")
+		}
+		w.WriteString(s.sum + "  " + name + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,106 @@
+package mvmv
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+)
+
+// deleteSources removes what is left of each source root after a run that
+// finished without errors. Sources still holding entries the run left
+// behind on purpose, such as skipped or filtered files, are only cleared of
+// the directories emptied by the move.
+func (m *mover) deleteSources(seeds []Job) {
+	if atomic.LoadInt64(&m.stats.Errors) > 0 {
+		m.printInfo("Keeping source after errors\n")
+		return
+	}
+	if reason := m.leftBehind(); reason != "" {
+		m.printInfo("Keeping source, %s\n", reason)
+		m.pruneSources(seeds)
+		return
+	}
+
+	for _, root := range sourceRoots(seeds) {
+		// A file source that was moved is already gone
+		if _, err := os.Lstat(root); err != nil {
+			continue
+		}
+
+		m.logOp(opEvent{Op: "deleted", Source: root, Reason: "source"}, "Removing source: %s\n", root)
+		if m.opts.DryRun {
+			atomic.AddInt64(&m.stats.SourcesDeleted, 1)
+			continue
+		}
+		if err := os.RemoveAll(root); err != nil {
+			m.recordError(MoveError{Op: "remove", SourcePath: root, Err: err}, "Failed to remove source %s: %v", root)
+			continue
+		}
+		atomic.AddInt64(&m.stats.SourcesDeleted, 1)
+	}
+}
+
+// keptSkips are the skip reasons that leave data in the source which isn't
+// already at the target
+var keptSkips = []SkipReason{SkipExists, SkipNotOlder, SkipFiltered, SkipSymlink, SkipDenied, SkipMaxDepth, SkipCaseCollision, SkipSpecial}
+
+// leftBehind says why the run left entries in the source that removing it
+// would destroy, or returns "" if it left none
+func (m *mover) leftBehind() string {
+	switch {
+	case atomic.LoadInt64(&m.stats.FilesFiltered) > 0 || atomic.LoadInt64(&m.stats.DirsFiltered) > 0:
+		return "some entries were filtered out"
+	case atomic.LoadInt64(&m.stats.DirsInaccessible) > 0:
+		return "some directories could not be read"
+	case atomic.LoadInt64(&m.stats.DirConflicts) > 0:
+		return "some directories were left at max depth"
+	case m.unsettled.Load() > 0:
+		return fmt.Sprintf("%d files were still changing when the watch ended", m.unsettled.Load())
+	}
+	var skipped int64
+	for _, r := range keptSkips {
+		skipped += atomic.LoadInt64(&m.stats.Skipped[r])
+	}
+	if skipped > 0 {
+		return fmt.Sprintf("%d entries were skipped", skipped)
+	}
+	return ""
+}
+
+// pruneSources removes the directories below each source root that the
+// move left empty, deepest first. The roots themselves are kept.
+func (m *mover) pruneSources(seeds []Job) {
+	if m.opts.DryRun {
+		return
+	}
+	for _, root := range sourceRoots(seeds) {
+		var dirs []string
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() && path != root {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+		// WalkDir lists parents before their children
+		slices.Reverse(dirs)
+		for _, dir := range dirs {
+			if _, err := removeEmptyDir(dir); err != nil {
+				m.recordError(MoveError{Op: "prune", SourcePath: dir, Err: err}, "Cannot remove empty directory %s: %v", dir)
+			}
+		}
+	}
+}
+
+// sourceRoots returns the distinct source roots of the seeds
+func sourceRoots(seeds []Job) []string {
+	var roots []string
+	for _, seed := range seeds {
+		if !slices.Contains(roots, seed.SourceRoot) {
+			roots = append(roots, seed.SourceRoot)
+		}
+	}
+	return roots
+}
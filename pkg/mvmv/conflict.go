@@ -0,0 +1,90 @@
+package mvmv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// conflictName returns the first name of the form "name (N).ext", counting
+// N from 1, that exists neither at the target nor among the names already
+// claimed in this run. The extension is the part after the last dot, so
+// "a.tar.gz" becomes "a.tar (1).gz"; names starting with their only dot,
+// like ".bashrc", have none.
+func (m *mover) conflictName(targetPath string) string {
+	dir, name := filepath.Split(targetPath)
+	ext := filepath.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+
+	for n := 1; ; n++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, n, ext))
+		if _, err := os.Lstat(candidate); err == nil {
+			continue
+		}
+		if _, taken := m.claimed.LoadOrStore(candidate, struct{}{}); !taken {
+			return candidate
+		}
+	}
+}
+
+// noteConflict counts a file whose target already exists and, with
+// ShowConflicts, reports how the two differ
+func (m *mover) noteConflict(sourcePath, targetPath string, sourceInfo, targetInfo os.FileInfo) {
+	atomic.AddInt64(&m.stats.FileConflicts, 1)
+	if !m.opts.ShowConflicts {
+		return
+	}
+	diff := conflictDiff(sourceInfo, targetInfo)
+	m.logOp(opEvent{Op: "conflict", Source: sourcePath, Target: targetPath, Reason: diff, Size: sourceInfo.Size()}, "Target exists (%s): %s\n", diff, targetPath)
+}
+
+// skipDiff describes how a file skipped for its existing target differs
+// from it, with ShowSkipped
+func (m *mover) skipDiff(source, target os.FileInfo) string {
+	if !m.opts.ShowSkipped {
+		return ""
+	}
+	return conflictDiff(source, target)
+}
+
+// conflictDiff describes how a source file differs from its existing target
+// in type, size and modification time
+func conflictDiff(source, target os.FileInfo) string {
+	if !target.Mode().IsRegular() {
+		return "target is a " + fileKind(target.Mode())
+	}
+	var parts []string
+	if source.Size() == target.Size() {
+		parts = append(parts, "same size")
+	} else {
+		parts = append(parts, fmt.Sprintf("size %d vs %d bytes", source.Size(), target.Size()))
+	}
+	switch st, tt := source.ModTime(), target.ModTime(); {
+	case st.After(tt):
+		parts = append(parts, "source newer")
+	case st.Before(tt):
+		parts = append(parts, "source older")
+	default:
+		parts = append(parts, "same time")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fileKind names the type of a file for messages
+func fileKind(mode os.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode.IsRegular():
+		return "file"
+	default:
+		return "special file"
+	}
+}
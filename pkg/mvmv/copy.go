@@ -0,0 +1,277 @@
+package mvmv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+)
+
+// copyFDs is the number of file descriptors a copy holds open at once
+const copyFDs = 2
+
+// DefaultCopyBufferSize is the copy buffer size used when
+// Options.CopyBufferSize is zero
+const DefaultCopyBufferSize = 1 << 20
+
+// errChecksumMismatch is returned when a copied file doesn't read back as
+// the data written to it
+var errChecksumMismatch = errors.New("checksum mismatch after copy")
+
+// errXattrsUnsupported is returned by copyXattrs when a filesystem has no
+// extended attributes; the copy itself still stands
+var errXattrsUnsupported = errors.New("extended attributes not supported")
+
+// isCrossDevice reports whether a rename failed because source and target
+// are on different filesystems
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// copyFile moves a file between filesystems by streaming its contents to
+// a temporary file next to targetPath, syncing it, renaming it into place
+// and then removing sourcePath, so that targetPath never holds a partial
+// copy; with NoTempFile it is written directly. The mode and the access and
+// modification times are preserved. A partially written file is removed on
+// failure, leaving the source untouched. With Verify set, the target
+// is read back after syncing and must hash the same as the data read from
+// the source, or errChecksumMismatch is returned. With
+// PreserveOwnership set, the target also gets the source's owner, and with
+// RateLimit set the data is read no faster than the run's shared limit.
+func (m *mover) copyFile(sourcePath, targetPath string, info os.FileInfo) error {
+	if err := m.copyData(sourcePath, targetPath, info); err != nil {
+		return err
+	}
+	if err := os.Remove(sourcePath); err != nil {
+		os.Remove(targetPath)
+		return err
+	}
+	m.syncParents(targetPath, sourcePath)
+	return nil
+}
+
+// copyData creates targetPath as a copy of sourcePath, the first half of
+// copyFile. The source is left in place.
+func (m *mover) copyData(sourcePath, targetPath string, info os.FileInfo) (err error) {
+	if m.copySlots != nil {
+		m.copySlots <- struct{}{}
+		defer func() { <-m.copySlots }()
+	}
+
+	in, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := m.createTemp(targetPath, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	// Everything up to the final rename is done to the temporary file
+	writePath := out.Name()
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(writePath)
+		}
+	}()
+
+	var reader io.Reader = in
+	if m.limiter != nil {
+		reader = &limitedReader{r: in, limiter: m.limiter}
+	}
+	if m.opts.StallTimeout > 0 {
+		reader = &countingReader{r: reader, n: &m.copied}
+	}
+	var sourceHash hash.Hash
+	if m.opts.Verify {
+		sourceHash = verifyHash()
+		reader = io.TeeReader(reader, sourceHash)
+	}
+
+	// Left to itself the target would copy from a wrapped reader through
+	// its own small buffer; the plain file is still handed to it so the
+	// kernel can copy the data where it is able to
+	var writer io.Writer = out
+	if reader != io.Reader(in) {
+		writer = struct{ io.Writer }{out}
+	}
+	buf := m.copyBuffer()
+	_, err = io.CopyBuffer(writer, reader, *buf)
+	m.buffers.Put(buf)
+	if err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	if err = out.Sync(); err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	if m.opts.Verify {
+		var targetSum []byte
+		if targetSum, err = hashFileWith(writePath, verifyHash()); err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+		if !bytes.Equal(sourceHash.Sum(nil), targetSum) {
+			return errChecksumMismatch
+		}
+	}
+
+	// The umask may have narrowed the mode given to OpenFile, and a
+	// temporary file is created private
+	if err = os.Chmod(writePath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = os.Chtimes(writePath, accessTime(info), info.ModTime()); err != nil {
+		return err
+	}
+	if m.opts.PreserveOwnership {
+		if err = copyOwner(writePath, info); err != nil {
+			return fmt.Errorf("chown: %w", err)
+		}
+	}
+	if m.opts.PreserveXattrs {
+		if err = m.copyXattrs(sourcePath, writePath); err != nil {
+			return fmt.Errorf("xattr: %w", err)
+		}
+	}
+
+	if writePath != targetPath {
+		return m.commitTemp(writePath, targetPath)
+	}
+	return nil
+}
+
+// copyXattrs copies the extended attributes of sourcePath to targetPath.
+// A filesystem without extended attributes is warned about once per run
+// rather than failing every copy.
+func (m *mover) copyXattrs(sourcePath, targetPath string) error {
+	err := copyXattrs(sourcePath, targetPath)
+	if errors.Is(err, errXattrsUnsupported) {
+		m.xattrWarning.Do(func() {
+			m.logger().Warn("Cannot preserve extended attributes", "target", targetPath, "error", err)
+		})
+		return nil
+	}
+	return err
+}
+
+// copySlotCount returns how many copies may run at once under the
+// MaxOpenFiles budget, or 0 for no limit. By default half of the process's
+// descriptor limit goes to copies, leaving the rest for directory reads,
+// hashing and the watcher.
+func copySlotCount(maxOpenFiles int) int {
+	if maxOpenFiles == 0 {
+		maxOpenFiles = openFileLimit() / 2
+	}
+	if maxOpenFiles <= 0 {
+		return 0
+	}
+	return max(maxOpenFiles/copyFDs, 1)
+}
+
+// createDir recreates a source directory at the target with its permissions
+// and, if requested, its owner and extended attributes
+func (m *mover) createDir(sourcePath, targetPath string, sourceInfo os.FileInfo) error {
+	perm := sourceInfo.Mode().Perm()
+	if m.opts.DirMode != 0 {
+		perm = m.opts.DirMode.Perm()
+	}
+	if err := mkdirMode(targetPath, perm); err != nil {
+		return err
+	}
+	m.syncParents(targetPath)
+	if m.opts.PreserveOwnership {
+		if err := copyOwner(targetPath, sourceInfo); err != nil {
+			return err
+		}
+	}
+	if m.opts.PreserveXattrs {
+		return m.copyXattrs(sourcePath, targetPath)
+	}
+	return nil
+}
+
+// syncDirMode reports whether the permissions of the existing target
+// directory differ from the source's and must be set once its subtree is
+// done. A dry run only reports the change. targetInfo is the target as
+// processPath found it; a symlink is followed to the directory.
+func (m *mover) syncDirMode(sourcePath, targetPath string, sourceInfo, targetInfo os.FileInfo) bool {
+	if targetInfo.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if targetInfo, err = m.statTarget(targetPath); err != nil {
+			m.recordError(MoveError{Op: "stat", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Cannot stat target of %s: %v", sourcePath)
+			return false
+		}
+	}
+	from, to := targetInfo.Mode().Perm(), sourceInfo.Mode().Perm()
+	if from == to {
+		return false
+	}
+	if m.opts.DryRun {
+		atomic.AddInt64(&m.stats.DirModesSynced, 1)
+		m.logOp(opEvent{Op: "chmod", Source: sourcePath, Target: targetPath, Reason: fmt.Sprintf("%#o -> %#o", from, to)}, "Would set mode of %s to %#o\n", targetPath, to)
+		return false
+	}
+	return true
+}
+
+// mkdirMode creates a directory with exactly the given permissions,
+// regardless of the umask
+func mkdirMode(path string, perm os.FileMode) error {
+	if err := os.Mkdir(path, perm); err != nil {
+		return err
+	}
+	return os.Chmod(path, perm)
+}
+
+// mkdirAllMode is os.MkdirAll giving every directory it creates exactly
+// perm, regardless of the umask
+func mkdirAllMode(path string, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		if !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+	if parent := filepath.Dir(path); parent != path {
+		if err := mkdirAllMode(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := mkdirMode(path, perm); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// mkdirTarget creates the target directory path and its missing parents
+// with DirMode, or else with perm as masked by the umask
+func mkdirTarget(path string, perm os.FileMode, opts *Options) error {
+	if opts.DirMode != 0 {
+		return mkdirAllMode(path, opts.DirMode.Perm())
+	}
+	return os.MkdirAll(path, perm)
+}
+
+// copyBuffer returns a buffer of CopyBufferSize bytes from the pool, to be
+// put back once the copy is done
+func (m *mover) copyBuffer() *[]byte {
+	if buf, ok := m.buffers.Get().(*[]byte); ok {
+		return buf
+	}
+	size := m.opts.CopyBufferSize
+	if size == 0 {
+		size = DefaultCopyBufferSize
+	}
+	buf := make([]byte, size)
+	return &buf
+}
@@ -0,0 +1,84 @@
+package mvmv
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// hashDenylist holds SHA-256 digests of files that must never be moved.
+// It is read-only once loaded, so it is safe for concurrent use by workers.
+type hashDenylist struct {
+	hashes map[string]struct{}
+	sizes  map[int64]struct{}
+
+	// anySize is set when an entry has no size, forcing every candidate to be hashed
+	anySize bool
+}
+
+// loadDenylist reads a denylist file. Each line holds a hex SHA-256 digest,
+// optionally followed by the file size in bytes. Other trailing fields are
+// ignored, so sha256sum output can be used directly. Blank lines and lines
+// starting with # are skipped.
+func loadDenylist(path string) (*hashDenylist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open hash denylist: %w", err)
+	}
+	defer f.Close()
+
+	d := &hashDenylist{
+		hashes: make(map[string]struct{}),
+		sizes:  make(map[int64]struct{}),
+	}
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		sum := strings.ToLower(fields[0])
+		if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != 32 {
+			return nil, fmt.Errorf("hash denylist line %d: invalid SHA-256 digest %q", lineNo, fields[0])
+		}
+		d.hashes[sum] = struct{}{}
+
+		if len(fields) > 1 {
+			if size, err := strconv.ParseInt(fields[1], 10, 64); err == nil && size >= 0 {
+				d.sizes[size] = struct{}{}
+				continue
+			}
+		}
+		d.anySize = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read hash denylist: %w", err)
+	}
+
+	return d, nil
+}
+
+// match reports whether the file's digest is on the denylist. Files whose
+// size matches no entry are not hashed.
+func (d *hashDenylist) match(path string, info os.FileInfo) (bool, error) {
+	if !d.anySize {
+		if _, ok := d.sizes[info.Size()]; !ok {
+			return false, nil
+		}
+	}
+
+	sum, err := hashFile(path)
+	if err != nil {
+		return false, err
+	}
+	_, ok := d.hashes[sum]
+	return ok, nil
+}
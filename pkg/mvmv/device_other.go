@@ -0,0 +1,21 @@
+//go:build !unix
+
+package mvmv
+
+import "os"
+
+// deviceID is not available on this platform
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// sameFile reports whether both infos describe the same file
+func sameFile(a, b os.FileInfo) bool {
+	return os.SameFile(a, b)
+}
+
+// hardLinkKey is not available on this platform, so hard links are copied
+// like any other file
+func hardLinkKey(info os.FileInfo) (linkKey, int, bool) {
+	return linkKey{}, 0, false
+}
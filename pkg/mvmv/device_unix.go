@@ -0,0 +1,41 @@
+//go:build unix
+
+package mvmv
+
+import (
+	"os"
+	"syscall"
+)
+
+// deviceID returns the ID of the device holding the file
+func deviceID(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// sameFile reports whether both infos describe the same file, by device
+// and inode number
+func sameFile(a, b os.FileInfo) bool {
+	sa, ok := a.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	sb, ok := b.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return sa.Dev == sb.Dev && sa.Ino == sb.Ino
+}
+
+// hardLinkKey identifies a file that has more than one hard link, by device
+// and inode number, and returns its link count
+func hardLinkKey(info os.FileInfo) (linkKey, int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return linkKey{}, 0, false
+	}
+	return linkKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, int(st.Nlink), true
+}
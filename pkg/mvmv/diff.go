@@ -0,0 +1,203 @@
+package mvmv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DiffCount is a number of entries and the bytes of their files
+type DiffCount struct {
+	// Files counts everything that isn't a directory, symlinks included
+	Files int64 `json:"files"`
+	Dirs  int64 `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// DiffResult compares a source tree with the target it would be merged into
+type DiffResult struct {
+	// SourceOnly counts the entries missing at the target, which a move
+	// would bring over; a directory counts with its whole subtree
+	SourceOnly DiffCount `json:"source_only"`
+	// TargetOnly counts the entries of the target without a source
+	TargetOnly DiffCount `json:"target_only"`
+	// Both counts the files on both sides, which a move would skip, and the
+	// directories it would merge. Bytes are the source files' sizes
+	Both DiffCount `json:"both"`
+	// TypeMismatches counts source entries whose target is of another type
+	TypeMismatches int64 `json:"type_mismatches"`
+
+	Failures []MoveError `json:"-"`
+}
+
+// Diff walks source and target side by side, without changing either, and
+// counts what merging source into target would move and skip. A missing
+// target counts as empty. Of opts, only Workers applies. The error is a
+// *RunError when some directories couldn't be read.
+func Diff(ctx context.Context, source, target string, opts Options) (DiffResult, error) {
+	if err := checkTransfers([]Transfer{{Source: source, Target: target}}); err != nil {
+		return DiffResult{}, &PathError{Err: err}
+	}
+	d := &differ{}
+	if _, err := os.Lstat(target); errors.Is(err, os.ErrNotExist) {
+		// The source would be renamed as a whole
+		info, err := os.Lstat(source)
+		if err != nil {
+			return DiffResult{}, &PathError{Err: err}
+		}
+		d.countTree(source, fs.FileInfoToDirEntry(info), &d.result.SourceOnly)
+		return d.finish(ctx)
+	} else if err := validateTarget(target); err != nil {
+		return DiffResult{}, &PathError{Err: err}
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := newJobQueue(workers)
+	var wg sync.WaitGroup
+	for range workers {
+		go func() {
+			for {
+				job, ok := jobs.pop()
+				if !ok {
+					return
+				}
+				if ctx.Err() == nil {
+					children := d.compare(job)
+					wg.Add(len(children))
+					jobs.push(children...)
+				}
+				wg.Done()
+			}
+		}()
+	}
+	wg.Add(1)
+	jobs.push(Job{SourcePath: source, TargetPath: target})
+	wg.Wait()
+	jobs.close()
+	return d.finish(ctx)
+}
+
+// finish returns the result of the Diff, with the error to go with it
+func (d *differ) finish(ctx context.Context) (DiffResult, error) {
+	result := d.result
+	result.Failures = d.failures.list()
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if len(result.Failures) > 0 {
+		return result, &RunError{Errors: int64(len(result.Failures)), Failures: result.Failures}
+	}
+	return result, nil
+}
+
+// differ collects the counts of a Diff from concurrent workers
+type differ struct {
+	result   DiffResult
+	failures failureList
+}
+
+// compare counts the entries of a directory present on both sides and
+// returns the jobs for the subdirectories they share
+func (d *differ) compare(job Job) []Job {
+	atomic.AddInt64(&d.result.Both.Dirs, 1)
+	sourceEntries, err := os.ReadDir(job.SourcePath)
+	if err != nil {
+		d.failures.add(MoveError{Op: "readdir", SourcePath: job.SourcePath, Err: err})
+		return nil
+	}
+	targetEntries, err := os.ReadDir(job.TargetPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		d.failures.add(MoveError{Op: "readdir", SourcePath: job.SourcePath, TargetPath: job.TargetPath, Err: err})
+		return nil
+	}
+	targets := make(map[string]fs.DirEntry, len(targetEntries))
+	for _, entry := range targetEntries {
+		targets[entry.Name()] = entry
+	}
+
+	var shared []Job
+	for _, entry := range sourceEntries {
+		sourcePath := filepath.Join(job.SourcePath, entry.Name())
+		targetEntry, ok := targets[entry.Name()]
+		delete(targets, entry.Name())
+		switch {
+		case !ok:
+			d.countTree(sourcePath, entry, &d.result.SourceOnly)
+		case entry.IsDir() && targetEntry.IsDir():
+			shared = append(shared, Job{SourcePath: sourcePath, TargetPath: filepath.Join(job.TargetPath, entry.Name())})
+		case entry.IsDir() || targetEntry.IsDir():
+			atomic.AddInt64(&d.result.TypeMismatches, 1)
+		default:
+			d.countTree(sourcePath, entry, &d.result.Both)
+		}
+	}
+	for name, entry := range targets {
+		d.countTree(filepath.Join(job.TargetPath, name), entry, &d.result.TargetOnly)
+	}
+	return shared
+}
+
+// countTree adds the entry at path, with everything below it for a
+// directory, to c
+func (d *differ) countTree(path string, entry fs.DirEntry, c *DiffCount) {
+	if !entry.IsDir() {
+		d.countEntry(entry, c)
+		return
+	}
+	filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			d.failures.add(MoveError{Op: "readdir", SourcePath: p, Err: err})
+			return nil
+		}
+		if entry.IsDir() {
+			atomic.AddInt64(&c.Dirs, 1)
+		} else {
+			d.countEntry(entry, c)
+		}
+		return nil
+	})
+}
+
+// countEntry adds a file to c
+func (d *differ) countEntry(entry fs.DirEntry, c *DiffCount) {
+	atomic.AddInt64(&c.Files, 1)
+	if entry.Type().IsRegular() {
+		if info, err := entry.Info(); err == nil {
+			atomic.AddInt64(&c.Bytes, info.Size())
+		}
+	}
+}
+
+// Print writes the counts in the text format of the command line tool
+func (r *DiffResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "Only in source (would be moved): %s\n", diffCounts(r.SourceOnly))
+	fmt.Fprintf(w, "Only in target: %s\n", diffCounts(r.TargetOnly))
+	fmt.Fprintf(w, "In both (files would be skipped, directories merged): %s\n", diffCounts(r.Both))
+	if r.TypeMismatches > 0 {
+		fmt.Fprintf(w, "Of another type at the target: %d\n", r.TypeMismatches)
+	}
+	printFailures(w, r.Failures)
+}
+
+func diffCounts(c DiffCount) string {
+	s := fmt.Sprintf("%d files, %d directories", c.Files, c.Dirs)
+	switch {
+	case c.Bytes >= 1024*1024*1024:
+		s += fmt.Sprintf(", %.2f GB", float64(c.Bytes)/1024/1024/1024)
+	case c.Bytes >= 1024*1024:
+		s += fmt.Sprintf(", %.2f MB", float64(c.Bytes)/1024/1024)
+	default:
+		s += fmt.Sprintf(", %d bytes", c.Bytes)
+	}
+	return s
+}
@@ -0,0 +1,172 @@
+package mvmv
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// dirWork is the set of things to do for a directory once its subtree is done
+type dirWork uint8
+
+const (
+	// dirRestoreTimes sets the target's timestamps from the source's
+	dirRestoreTimes dirWork = 1 << iota
+	// dirPrune removes the source directory if nothing was left behind in it
+	dirPrune
+	// dirSyncMode sets the target's permissions from the source's
+	dirSyncMode
+)
+
+// pendingDir is a merged source directory with work left to do once
+// everything below it has been handled
+type pendingDir struct {
+	targetPath string
+	info       os.FileInfo
+	work       dirWork
+
+	// expanding is set until the directory's own job has finished.
+	// remaining holds its number of child jobs not yet done, which falls
+	// below zero while children queued early finish before it is known
+	expanding bool
+	remaining int
+}
+
+// dirTracker runs the deferred work of merged directories once their whole
+// subtree is done. Moving entries into a directory updates its mtime, so the
+// times of a recreated directory can only be restored after the last child
+// job, and a source directory only becomes empty at that point.
+type dirTracker struct {
+	mu   sync.Mutex
+	dirs map[string]*pendingDir
+}
+
+func newDirTracker() *dirTracker {
+	return &dirTracker{dirs: make(map[string]*pendingDir)}
+}
+
+// track registers a directory merged from sourcePath while its job runs.
+// Tracking the same directory again adds to the work to be done.
+func (t *dirTracker) track(sourcePath, targetPath string, info os.FileInfo, work dirWork) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.dirs[sourcePath]
+	if !ok {
+		d = &pendingDir{targetPath: targetPath, info: info, expanding: true}
+		t.dirs[sourcePath] = d
+	}
+	d.work |= work
+}
+
+// finish records that job is done and queued children more jobs, and
+// returns what became complete as a result
+func (t *dirTracker) finish(job Job, children int) completion {
+	if t == nil {
+		return completion{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var r completion
+	if d, ok := t.dirs[job.SourcePath]; ok && d.expanding {
+		d.expanding = false
+		d.remaining += children
+		if d.remaining == 0 {
+			t.complete(job.SourcePath, &r)
+		}
+	} else {
+		r.completed = append(r.completed, job.SourcePath)
+		t.childDone(filepath.Dir(job.SourcePath), &r)
+	}
+	return r
+}
+
+// expand counts children queued by the job of a directory before it
+// finished
+func (t *dirTracker) expand(job Job, children int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if d, ok := t.dirs[job.SourcePath]; ok && d.expanding {
+		d.remaining += children
+	}
+}
+
+// completion collects the outcome of the directories completed by one job
+type completion struct {
+	// completed lists the job's path, if it had no children, and the
+	// directories whose subtrees it finished
+	completed []string
+	pruned    []string
+	synced    []Job
+	errs      []MoveError
+}
+
+// childDone counts down the parent of a finished entry
+func (t *dirTracker) childDone(parent string, r *completion) {
+	d, ok := t.dirs[parent]
+	if !ok {
+		return
+	}
+	d.remaining--
+	if d.remaining == 0 && !d.expanding {
+		t.complete(parent, r)
+	}
+}
+
+// complete runs the deferred work of a directory whose subtree is done,
+// which in turn may complete its parent
+func (t *dirTracker) complete(sourcePath string, r *completion) {
+	d := t.dirs[sourcePath]
+	delete(t.dirs, sourcePath)
+	r.completed = append(r.completed, sourcePath)
+
+	if d.work&dirSyncMode != 0 {
+		if err := os.Chmod(d.targetPath, d.info.Mode().Perm()); err != nil {
+			r.errs = append(r.errs, MoveError{Op: "chmod", SourcePath: sourcePath, TargetPath: d.targetPath, Err: err})
+		} else {
+			r.synced = append(r.synced, Job{SourcePath: sourcePath, TargetPath: d.targetPath})
+		}
+	}
+	if d.work&dirRestoreTimes != 0 {
+		if err := os.Chtimes(d.targetPath, accessTime(d.info), d.info.ModTime()); err != nil {
+			r.errs = append(r.errs, MoveError{Op: "chtimes", SourcePath: sourcePath, TargetPath: d.targetPath, Err: err})
+		}
+	}
+	if d.work&dirPrune != 0 {
+		removed, err := removeEmptyDir(sourcePath)
+		if err != nil {
+			r.errs = append(r.errs, MoveError{Op: "prune", SourcePath: sourcePath, Err: err})
+		} else if removed {
+			r.pruned = append(r.pruned, sourcePath)
+		}
+	}
+	t.childDone(filepath.Dir(sourcePath), r)
+}
+
+// removeEmptyDir removes path if it has no entries left. A directory that
+// still holds skipped or failed entries is not an error.
+func removeEmptyDir(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	_, err = f.Readdirnames(1)
+	f.Close()
+	if !errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err := os.Remove(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,108 @@
+package mvmv
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// errorBurst is how many messages of one kind are printed before suppression starts
+	errorBurst = 5
+
+	// errorFlushInterval is how often suppressed message counts are reported
+	errorFlushInterval = 5 * time.Second
+)
+
+// errorLog logs error messages while coalescing repeats. Messages are
+// grouped by their format and underlying cause (e.g. "Failed to move file"
+// with "permission denied"); after errorBurst messages of a kind, further
+// ones are only counted and reported periodically as a single summary line.
+type errorLog struct {
+	mu         sync.Mutex
+	logger     *slog.Logger
+	kinds      map[string]*errorKind
+	suppressed int
+}
+
+type errorKind struct {
+	format     string
+	cause      string
+	printed    int
+	suppressed int
+}
+
+func newErrorLog(logger *slog.Logger) *errorLog {
+	return &errorLog{logger: logger, kinds: make(map[string]*errorKind)}
+}
+
+// log logs a "<format with path>: <err>" message with attrs unless its kind
+// is being suppressed
+func (l *errorLog) log(format, path string, err error, attrs ...any) {
+	cause := rootCause(err).Error()
+	key := format + "\x00" + cause
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kind, ok := l.kinds[key]
+	if !ok {
+		kind = &errorKind{format: format, cause: cause}
+		l.kinds[key] = kind
+	}
+
+	if kind.printed < errorBurst {
+		kind.printed++
+		l.logger.Error(fmt.Sprintf(format, path, err), attrs...)
+		return
+	}
+	kind.suppressed++
+	l.suppressed++
+}
+
+// flush reports and resets the counts of suppressed messages
+func (l *errorLog) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.suppressed == 0 {
+		return
+	}
+	for _, kind := range l.kinds {
+		if kind.suppressed == 0 {
+			continue
+		}
+		l.logger.Warn(fmt.Sprintf(kind.format+" (x%d more suppressed)", "...", kind.cause, kind.suppressed), "suppressed", kind.suppressed)
+		kind.suppressed = 0
+	}
+	l.suppressed = 0
+}
+
+// run flushes suppressed counts periodically until done is closed
+func (l *errorLog) run(done <-chan struct{}) {
+	ticker := time.NewTicker(errorFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			l.flush()
+			return
+		case <-ticker.C:
+			l.flush()
+		}
+	}
+}
+
+// rootCause unwraps err down to the innermost error, such as a syscall errno
+func rootCause(err error) error {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return err
+		}
+		err = next
+	}
+}
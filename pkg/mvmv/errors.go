@@ -0,0 +1,191 @@
+package mvmv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPrintedFailures caps the failing paths listed in the final statistics
+const maxPrintedFailures = 10
+
+// MinErrorSample is how many entries must have been scanned before
+// Options.MaxErrorPercent is applied, so that a failure among the first few
+// entries doesn't stop the run
+const MinErrorSample = 100
+
+// ErrTooManyErrors is found by errors.Is in the RunError of a run stopped by
+// Options.MaxErrors or Options.MaxErrorPercent
+var ErrTooManyErrors = errors.New("too many errors")
+
+// ErrStalled is found by errors.Is in the error of a run stopped by
+// Options.StallAbort
+var ErrStalled = errors.New("run stalled")
+
+// MoveError describes a single failed operation
+type MoveError struct {
+	// Op names the failed operation, e.g. "stat", "move", "mkdir" or "symlink"
+	Op         string
+	SourcePath string
+	// TargetPath is empty for operations that only touch the source
+	TargetPath string
+	Err        error
+}
+
+func (e *MoveError) Error() string {
+	if e.TargetPath == "" {
+		return fmt.Sprintf("%s %s: %v", e.Op, e.SourcePath, e.Err)
+	}
+	return fmt.Sprintf("%s %s -> %s: %v", e.Op, e.SourcePath, e.TargetPath, e.Err)
+}
+
+func (e *MoveError) Unwrap() error {
+	return e.Err
+}
+
+// RunError is returned by Move and Shard when a run finished but some
+// operations failed. errors.Is and errors.As see through it to the
+// individual failures.
+type RunError struct {
+	// Errors is the number of failures, including ones not tied to a path
+	Errors   int64
+	Failures []MoveError
+
+	// TooMany is set when the run was stopped for exceeding
+	// Options.MaxErrors or Options.MaxErrorPercent
+	TooMany bool
+
+	// Stalled is set when the run was stopped by Options.StallAbort
+	Stalled bool
+}
+
+func (e *RunError) Error() string {
+	if e.Stalled {
+		return "stopped after making no progress"
+	}
+	if e.TooMany {
+		return fmt.Sprintf("stopped after %d errors", e.Errors)
+	}
+	return fmt.Sprintf("completed with %d errors", e.Errors)
+}
+
+func (e *RunError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures)+1)
+	if e.TooMany {
+		errs = append(errs, ErrTooManyErrors)
+	}
+	if e.Stalled {
+		errs = append(errs, ErrStalled)
+	}
+	for i := range e.Failures {
+		errs = append(errs, &e.Failures[i])
+	}
+	return errs
+}
+
+// PathError is returned by Move, MoveAll and Shard when a source or target
+// can't be used, before anything was moved, and by ExpandSource
+type PathError struct {
+	Err error
+}
+
+func (e *PathError) Error() string { return e.Err.Error() }
+func (e *PathError) Unwrap() error { return e.Err }
+
+// OptionsError is returned by Move, MoveAll and Shard when the options are
+// invalid or contradict each other, before anything was moved
+type OptionsError struct {
+	Err error
+}
+
+func (e *OptionsError) Error() string { return e.Err.Error() }
+func (e *OptionsError) Unwrap() error { return e.Err }
+
+// failureList collects the failures of a run from concurrent workers
+type failureList struct {
+	mu       sync.Mutex
+	failures []MoveError
+}
+
+func (l *failureList) add(e MoveError) {
+	l.mu.Lock()
+	l.failures = append(l.failures, e)
+	l.mu.Unlock()
+}
+
+func (l *failureList) list() []MoveError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]MoveError(nil), l.failures...)
+}
+
+// recordError counts a failed operation, keeps it for the result and, in
+// verbose or quiet mode, reports it. format takes path and the error, in
+// that order.
+func (m *mover) recordError(e MoveError, format, path string) {
+	n := atomic.AddInt64(&m.stats.Errors, 1)
+	m.failures.add(e)
+	m.checkpoint.fail(e.SourcePath)
+	m.notify(opEvent{Op: "error", Source: e.SourcePath, Target: e.TargetPath}, e.Err)
+	if m.opts.FailFast {
+		m.stopRun(&e)
+	}
+	if m.tooManyErrors(n) && m.tooMany.CompareAndSwap(false, true) && m.cancel != nil {
+		m.cancel()
+	}
+
+	if m.out != nil {
+		rec := m.out.recordError(e, format, path)
+		if m.opts.Verbose || m.opts.DryRun {
+			m.report(e.SourcePath, func() {
+				m.out.emit(opEvent{Op: "error", Source: e.SourcePath, Target: e.TargetPath, Reason: rec.Message, Error: rec.Error})
+			})
+		}
+		return
+	}
+	switch {
+	case m.opts.DryRun:
+		// Errors belong in the plan, next to the operations around them
+		m.report(e.SourcePath, func() {
+			fmt.Println(planLine(opEvent{Op: "error", Source: e.SourcePath, Target: e.TargetPath, Error: e.Err.Error()}))
+		})
+	case m.opts.Verbose || m.opts.Quiet:
+		m.report(e.SourcePath, func() {
+			m.errLog.log(format, path, e.Err, opEvent{Op: e.Op, Source: e.SourcePath, Target: e.TargetPath, Error: e.Err.Error()}.attrs()...)
+		})
+	}
+}
+
+// tooManyErrors reports whether n failures exceed MaxErrors or
+// MaxErrorPercent
+func (m *mover) tooManyErrors(n int64) bool {
+	if m.opts.MaxErrors > 0 && n > int64(m.opts.MaxErrors) {
+		return true
+	}
+	if m.opts.MaxErrorPercent > 0 {
+		scanned := atomic.LoadInt64(&m.stats.EntriesScanned)
+		return scanned >= MinErrorSample && float64(n)*100 > m.opts.MaxErrorPercent*float64(scanned)
+	}
+	return false
+}
+
+// stopRun cancels the run with e as its error, unless an earlier failure
+// already did
+func (m *mover) stopRun(e *MoveError) {
+	if m.firstErr.CompareAndSwap(nil, e) && m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// printFailures lists the first failing operations
+func printFailures(w io.Writer, failures []MoveError) {
+	for i, f := range failures {
+		if i == maxPrintedFailures {
+			fmt.Fprintf(w, "  ... and %d more\n", len(failures)-maxPrintedFailures)
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", f.Error())
+	}
+}
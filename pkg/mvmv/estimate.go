@@ -0,0 +1,154 @@
+package mvmv
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	calibrationRenames   = 32
+	calibrationCopyBytes = 4 << 20
+)
+
+// Calibration holds storage speed measurements taken before a dry run
+type Calibration struct {
+	StatCost      time.Duration
+	RenameCost    time.Duration
+	CrossDevice   bool
+	CopyBytesPerS float64
+}
+
+// calibrate measures stat and rename latency on the source filesystem and,
+// when source and target live on different devices, copy throughput between
+// them. Scratch files are created in hidden temporary directories and removed
+// before returning.
+func calibrate(source, target string) (*Calibration, error) {
+	cal := &Calibration{}
+
+	sourceInfo, err := os.Lstat(source)
+	if err != nil {
+		return nil, err
+	}
+	targetInfo, err := os.Lstat(target)
+	if err != nil {
+		return nil, err
+	}
+	sourceDev, ok1 := deviceID(sourceInfo)
+	targetDev, ok2 := deviceID(targetInfo)
+	cal.CrossDevice = ok1 && ok2 && sourceDev != targetDev
+
+	scratch, err := os.MkdirTemp(source, ".mvmv-calibrate-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	for i := range calibrationRenames {
+		name := filepath.Join(scratch, fmt.Sprintf("f%d", i))
+		if err := os.WriteFile(name, nil, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	for i := range calibrationRenames {
+		if _, err := os.Lstat(filepath.Join(scratch, fmt.Sprintf("f%d", i))); err != nil {
+			return nil, err
+		}
+	}
+	cal.StatCost = time.Since(start) / calibrationRenames
+
+	start = time.Now()
+	for i := range calibrationRenames {
+		from := filepath.Join(scratch, fmt.Sprintf("f%d", i))
+		if err := os.Rename(from, from+".moved"); err != nil {
+			return nil, err
+		}
+	}
+	cal.RenameCost = time.Since(start) / calibrationRenames
+
+	if cal.CrossDevice {
+		rate, err := measureCopy(scratch, target)
+		if err != nil {
+			return nil, err
+		}
+		cal.CopyBytesPerS = rate
+	}
+
+	return cal, nil
+}
+
+// measureCopy copies a scratch file from srcDir to a temporary directory in
+// target and returns the observed throughput in bytes per second
+func measureCopy(srcDir, target string) (float64, error) {
+	sample := filepath.Join(srcDir, "copy-sample")
+	if err := os.WriteFile(sample, make([]byte, calibrationCopyBytes), 0600); err != nil {
+		return 0, err
+	}
+
+	dstDir, err := os.MkdirTemp(target, ".mvmv-calibrate-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dstDir)
+
+	start := time.Now()
+
+	in, err := os.Open(sample)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(filepath.Join(dstDir, "copy-sample"))
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return 0, err
+	}
+	if err := out.Sync(); err != nil {
+		return 0, err
+	}
+
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		return 0, nil
+	}
+	return calibrationCopyBytes / elapsed, nil
+}
+
+// estimateDuration projects how long a real run would take from dry-run
+// counters and calibration measurements
+func estimateDuration(stats *Statistics, cal *Calibration, workers int) time.Duration {
+	checked := stats.DirsChecked + stats.FilesChecked + stats.SymlinksSkipped + stats.SymlinksMoved
+	moves := stats.DirsRenamed + stats.FilesMoved + stats.SymlinksMoved
+
+	// Each checked entry costs a source and a target stat
+	total := time.Duration(checked*2)*cal.StatCost + time.Duration(moves)*cal.RenameCost
+	if workers > 1 {
+		total /= time.Duration(workers)
+	}
+
+	// Cross-device copies are bounded by storage throughput rather than workers
+	if cal.CrossDevice && cal.CopyBytesPerS > 0 {
+		total += time.Duration(float64(stats.BytesMoved) / cal.CopyBytesPerS * float64(time.Second))
+	}
+
+	return total
+}
+
+// printEstimate prints the projected duration of a real run
+func printEstimate(stats *Statistics, cal *Calibration, workers int) {
+	fmt.Printf("Estimated duration: %s (stat %s, rename %s",
+		formatDuration(estimateDuration(stats, cal, workers)), cal.StatCost, cal.RenameCost)
+	if cal.CrossDevice {
+		fmt.Printf(", cross-device copy %.2f MB/s", cal.CopyBytesPerS/1024/1024)
+	}
+	fmt.Println(")")
+}
@@ -0,0 +1,79 @@
+package mvmv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Decision is what an Options.Filter wants done with an entry
+type Decision int
+
+const (
+	// FilterMove handles the entry as usual. A directory missing at the
+	// target is moved as a whole, without asking about its contents
+	FilterMove Decision = iota
+	// FilterSkip leaves the entry in the source; for a directory it is the
+	// same as FilterPrune
+	FilterSkip
+	// FilterRecurse recreates a directory at the target and asks about each
+	// of its entries instead of moving it as a whole. For a file it is the
+	// same as FilterMove
+	FilterRecurse
+	// FilterPrune leaves a directory in the source with everything below it,
+	// which is never looked at
+	FilterPrune
+)
+
+// validatePatterns rejects malformed glob patterns up front, since
+// filepath.Match only reports them when a name is actually matched
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether the base name of path matches one of the patterns
+func matchAny(patterns []string, path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filterFile returns why a file is left in the source by the file filters,
+// or "" if it is to be moved
+func (m *mover) filterFile(path string, info os.FileInfo) string {
+	switch size := info.Size(); {
+	case len(m.opts.Include) > 0 && !matchAny(m.opts.Include, path):
+		return "not included"
+	case size < m.opts.MinSize:
+		return "too small"
+	case m.opts.MaxSize > 0 && size > m.opts.MaxSize:
+		return "too large"
+	case !m.opts.NewerThan.IsZero() && !info.ModTime().After(m.opts.NewerThan):
+		return "too old"
+	case !m.opts.OlderThan.IsZero() && !info.ModTime().Before(m.opts.OlderThan):
+		return "too new"
+	}
+	return ""
+}
+
+// excluded reports whether an entry matches the Exclude filter
+func (m *mover) excluded(path string) bool {
+	return matchAny(m.opts.Exclude, path)
+}
+
+// filtering reports whether some entries of a directory may be left behind,
+// in which case directories can't be moved as a whole
+func (m *mover) filtering() bool {
+	return len(m.opts.Include) > 0 || len(m.opts.Exclude) > 0 ||
+		m.opts.MinSize > 0 || m.opts.MaxSize > 0 ||
+		!m.opts.NewerThan.IsZero() || !m.opts.OlderThan.IsZero()
+}
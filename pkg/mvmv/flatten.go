@@ -0,0 +1,27 @@
+package mvmv
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// flatTarget returns where a directory entry goes with Flatten: files and
+// symlinks straight into the target root, while directories stand for the
+// target root itself so they're descended into without being created
+func flatTarget(job Job, entry os.DirEntry) string {
+	if entry.IsDir() {
+		return job.TargetRoot
+	}
+	return filepath.Join(job.TargetRoot, entry.Name())
+}
+
+// lockTarget serializes the moves to targetPath, since with Flatten files
+// from different directories can share it, and with TargetNameTransform
+// different files of one directory. It returns the unlock function.
+func (m *mover) lockTarget(targetPath string) func() {
+	v, _ := m.targetLocks.LoadOrStore(targetPath, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package mvmv
+
+// syncDir does nothing, since directories can't be synced on this platform
+func syncDir(path string) error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package mvmv
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// syncDir flushes the entries of the directory at path to disk, so that a
+// rename or create in it survives a crash. Filesystems that can't sync
+// directories are not an error.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTSUP) {
+		return err
+	}
+	return nil
+}
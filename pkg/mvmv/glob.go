@@ -0,0 +1,103 @@
+package mvmv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandSource expands the glob patterns and {a,b} alternatives in a source
+// argument, for shells that leave quoted patterns alone. A trailing slash is
+// kept on every match, and each match must be a directory. An argument
+// without metacharacters, or naming an existing path as it is, is returned
+// unchanged.
+func ExpandSource(arg string) ([]string, error) {
+	if !strings.ContainsAny(arg, "*?[{") {
+		return []string{arg}, nil
+	}
+	if _, err := os.Lstat(arg); err == nil {
+		return []string{arg}, nil
+	}
+
+	pattern := strings.TrimRight(arg, "/"+string(filepath.Separator))
+	slash := pattern != arg
+	var sources []string
+	seen := make(map[string]bool)
+	for _, p := range expandBraces(pattern) {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, &PathError{Err: fmt.Errorf("source pattern %s: %w", arg, err)}
+		}
+		for _, match := range matches {
+			if seen[match] {
+				continue
+			}
+			seen[match] = true
+			info, err := os.Lstat(match)
+			if err != nil {
+				return nil, &PathError{Err: err}
+			}
+			if !info.IsDir() {
+				return nil, &PathError{Err: fmt.Errorf("source pattern %s matches %s, which is not a directory", arg, match)}
+			}
+			if slash {
+				match += string(filepath.Separator)
+			}
+			sources = append(sources, match)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, &PathError{Err: fmt.Errorf("no source directories match %s", arg)}
+	}
+	return sources, nil
+}
+
+// expandBraces expands the first {a,b,...} group in pattern, and those in
+// each result in turn, the way a shell does. Unbalanced braces, and groups
+// without a comma, are left as they are.
+func expandBraces(pattern string) []string {
+	depth, open := 0, -1
+	var commas []int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				open = i
+				commas = commas[:0]
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if len(commas) == 0 {
+				// Not a group; look for one further on
+				rest := expandBraces(pattern[i+1:])
+				for j := range rest {
+					rest[j] = pattern[:i+1] + rest[j]
+				}
+				return rest
+			}
+			prefix, suffix := pattern[:open], pattern[i+1:]
+			bounds := append(append([]int{open}, commas...), i)
+			var out []string
+			for k := 0; k+1 < len(bounds); k++ {
+				alt := pattern[bounds[k]+1 : bounds[k+1]]
+				out = append(out, expandBraces(prefix+alt+suffix)...)
+			}
+			return out
+		}
+	}
+	return []string{pattern}
+}
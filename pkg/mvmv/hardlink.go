@@ -0,0 +1,89 @@
+package mvmv
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// linkKey identifies a file by device and inode number
+type linkKey struct {
+	dev, ino uint64
+}
+
+// linkedCopy is the copy made for the first of a file's hard links to
+// reach a cross-device move. The other links wait for it and become hard
+// links to its target.
+type linkedCopy struct {
+	done   chan struct{}
+	target string
+	err    error
+
+	// remaining counts the links not seen yet; the entry is dropped when
+	// it reaches zero, before the inode number can be reused
+	remaining int
+}
+
+// linkTable maps the hard-linked source files copied during a run to
+// their copies
+type linkTable struct {
+	mu     sync.Mutex
+	copies map[linkKey]*linkedCopy
+}
+
+func newLinkTable() *linkTable {
+	return &linkTable{copies: make(map[linkKey]*linkedCopy)}
+}
+
+// claim returns the copy for key and whether the caller is the first link,
+// which has to make the copy and close done
+func (t *linkTable) claim(key linkKey, links int, targetPath string) (*linkedCopy, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.copies[key]
+	if !ok {
+		c = &linkedCopy{done: make(chan struct{}), target: targetPath, remaining: links}
+		t.copies[key] = c
+	}
+	c.remaining--
+	if c.remaining <= 0 {
+		delete(t.copies, key)
+	}
+	return c, !ok
+}
+
+// copyHardLink moves a file with several hard links across devices. The
+// first link is copied; the others are linked to that copy at the target,
+// so the data is stored once, as in the source. It reports false when the
+// file has a single link and must be copied as usual.
+func (m *mover) copyHardLink(sourcePath, targetPath string, sourceInfo os.FileInfo, copyFile func() error) (bool, error) {
+	key, links, ok := hardLinkKey(sourceInfo)
+	if !ok {
+		return false, nil
+	}
+
+	c, first := m.links.claim(key, links, targetPath)
+	if first {
+		c.err = copyFile()
+		close(c.done)
+		return true, c.err
+	}
+
+	<-c.done
+	if c.err != nil {
+		// Without a copy to link to, this link carries the data itself
+		return false, nil
+	}
+	if err := os.Link(c.target, targetPath); err != nil {
+		// The copy may have been moved on or replaced in the meantime
+		return false, nil
+	}
+	if err := os.Remove(sourcePath); err != nil {
+		os.Remove(targetPath)
+		return true, err
+	}
+	atomic.AddInt64(&m.stats.FilesLinked, 1)
+	m.logOp(opEvent{Op: "linked", Source: sourcePath, Target: targetPath, Link: c.target}, "Hard-linking file to its copy: %s -> %s\n", targetPath, c.target)
+	return true, nil
+}
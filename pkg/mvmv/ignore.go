@@ -0,0 +1,172 @@
+package mvmv
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the per-directory file holding gitignore-style patterns
+// of entries to leave in the source
+const ignoreFileName = ".mvmvignore"
+
+// ignoreRule is a single parsed line of an ignore file
+type ignoreRule struct {
+	// base is the directory holding the ignore file; patterns match paths relative to it
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreRules is the set of rules in effect for a directory, inherited from
+// its ancestors. It is never modified once built, so jobs can share it.
+type ignoreRules struct {
+	rules []ignoreRule
+}
+
+// load returns the rules in effect inside dir: r extended with the patterns
+// of dir's ignore file, or r itself when dir has none
+func (r *ignoreRules) load(dir string) (*ignoreRules, error) {
+	f, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+
+	var parsed []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(dir, scanner.Text()); ok {
+			parsed = append(parsed, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return r, err
+	}
+	if len(parsed) == 0 {
+		return r, nil
+	}
+
+	merged := &ignoreRules{}
+	if r != nil {
+		merged.rules = append(merged.rules, r.rules...)
+	}
+	merged.rules = append(merged.rules, parsed...)
+	return merged, nil
+}
+
+// parseIgnoreRule parses one line of an ignore file in dir. It follows
+// gitignore: # starts a comment, ! negates, a trailing slash matches only
+// directories, a pattern containing a slash is anchored to dir and ** matches
+// any number of directories.
+func parseIgnoreRule(dir, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: dir}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:] // escaped leading # or !
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	rule.segments = strings.Split(line, "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	return rule, true
+}
+
+// ignored reports whether path is ignored. As in gitignore the last matching
+// rule wins, so a later negation re-includes an earlier match.
+func (r *ignoreRules) ignored(p string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+
+	ignored := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, p)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if matchSegments(rule.segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" segment matches zero or more path segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// active reports whether any rule is in effect
+func (r *ignoreRules) active() bool {
+	return r != nil && len(r.rules) > 0
+}
+
+// loadIgnore loads dir's ignore file on top of the inherited rules. A file
+// that can't be read is reported and the inherited rules stay in effect.
+func (m *mover) loadIgnore(rules *ignoreRules, dir string) *ignoreRules {
+	if m.opts.NoIgnore {
+		return nil
+	}
+	loaded, err := rules.load(dir)
+	if err != nil && m.opts.Inaccessible == InaccessibleReport && errors.Is(err, os.ErrPermission) {
+		// A directory that can't be opened at all is reported as
+		// inaccessible once it is listed
+		f, openErr := os.Open(dir)
+		if openErr != nil {
+			return loaded
+		}
+		f.Close()
+	}
+	if err != nil {
+		path := filepath.Join(dir, ignoreFileName)
+		m.recordError(MoveError{Op: "read", SourcePath: path, Err: err}, "Cannot read ignore file %s: %v", path)
+	}
+	return loaded
+}
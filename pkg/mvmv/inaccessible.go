@@ -0,0 +1,42 @@
+package mvmv
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Policies for Options.Inaccessible
+const (
+	InaccessibleError  = "error"
+	InaccessibleFail   = "fail"
+	InaccessibleReport = "report"
+)
+
+// validateInaccessible checks the Options.Inaccessible policy
+func validateInaccessible(policy string) error {
+	switch policy {
+	case "", InaccessibleError, InaccessibleFail, InaccessibleReport:
+		return nil
+	default:
+		return fmt.Errorf("unknown inaccessible directory policy %q (want %s, %s or %s)",
+			policy, InaccessibleError, InaccessibleFail, InaccessibleReport)
+	}
+}
+
+// unreadableDir leaves a source directory whose entries can't be listed in
+// place, with everything below it, and handles it by Options.Inaccessible
+func (m *mover) unreadableDir(sourcePath string, err error) {
+	e := MoveError{Op: "readdir", SourcePath: sourcePath, Err: err}
+	if m.opts.Inaccessible != InaccessibleReport {
+		m.recordError(e, "Cannot read directory %s: %v", sourcePath)
+		if m.opts.Inaccessible == InaccessibleFail {
+			m.stopRun(&e)
+		}
+		return
+	}
+
+	atomic.AddInt64(&m.stats.DirsInaccessible, 1)
+	m.inaccessible.add(e)
+	m.checkpoint.fail(sourcePath)
+	m.logOp(opEvent{Op: "inaccessible", Source: sourcePath, Error: err.Error()}, "Cannot read directory, leaving it: %s\n", sourcePath)
+}
@@ -0,0 +1,97 @@
+package mvmv
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Keys for matching source files against the target index
+const (
+	IndexByName = "name"
+	IndexByHash = "hash"
+)
+
+// targetIndex records the files present anywhere under the target roots so
+// that source files can be matched regardless of their location. It is built
+// before any moves start and is read-only afterwards, so it is safe for
+// concurrent use by workers.
+type targetIndex struct {
+	by     string
+	names  map[string]struct{}
+	sizes  map[int64]struct{}
+	hashes map[string]struct{}
+}
+
+// buildTargetIndex walks the target roots and indexes every regular file by
+// basename or by size and content hash
+func buildTargetIndex(roots []string, by string) (*targetIndex, error) {
+	idx := &targetIndex{by: by}
+	switch by {
+	case "", IndexByName:
+		idx.by = IndexByName
+		idx.names = make(map[string]struct{})
+	case IndexByHash:
+		idx.sizes = make(map[int64]struct{})
+		idx.hashes = make(map[string]struct{})
+	default:
+		return nil, fmt.Errorf("unknown index key %q (want %q or %q)", by, IndexByName, IndexByHash)
+	}
+
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			if idx.by == IndexByName {
+				idx.names[d.Name()] = struct{}{}
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			idx.sizes[info.Size()] = struct{}{}
+			idx.hashes[hashKey(info.Size(), sum)] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot index target: %w", err)
+		}
+	}
+
+	return idx, nil
+}
+
+// contains reports whether the source file is already present in the target.
+// Files are only hashed when a target file of the same size exists.
+func (idx *targetIndex) contains(path string, info os.FileInfo) (bool, error) {
+	if idx.by == IndexByName {
+		_, ok := idx.names[info.Name()]
+		return ok, nil
+	}
+
+	if _, ok := idx.sizes[info.Size()]; !ok {
+		return false, nil
+	}
+	sum, err := hashFile(path)
+	if err != nil {
+		return false, err
+	}
+	_, ok := idx.hashes[hashKey(info.Size(), sum)]
+	return ok, nil
+}
+
+func hashKey(size int64, sum string) string {
+	return fmt.Sprintf("%d:%s", size, sum)
+}
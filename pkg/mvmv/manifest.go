@@ -0,0 +1,78 @@
+package mvmv
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Manifest entry types
+const (
+	ManifestFile    = "file"
+	ManifestDir     = "dir"
+	ManifestSymlink = "symlink"
+)
+
+// ManifestEntry is one line of the manifest, recording a completed move
+type ManifestEntry struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Type is ManifestFile, ManifestDir (a whole tree moved at once) or
+	// ManifestSymlink
+	Type string `json:"type"`
+	Size int64  `json:"size,omitempty"`
+	// Replaced is set when the move overwrote an existing target file
+	Replaced bool      `json:"replaced,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// manifest appends entries to the manifest file as moves complete. Each
+// entry is written with its own unbuffered write, so the file holds every
+// move finished before a crash.
+type manifest struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func openManifest(path string) (*manifest, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open manifest: %w", err)
+	}
+	return &manifest{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// record appends an entry; it does nothing on a nil manifest
+func (mf *manifest) record(e ManifestEntry) error {
+	if mf == nil {
+		return nil
+	}
+	e.Time = time.Now()
+
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	return mf.enc.Encode(e)
+}
+
+func (mf *manifest) close() error {
+	if mf == nil {
+		return nil
+	}
+	return mf.f.Close()
+}
+
+// recordMove adds a completed move to the manifest, the summary and the
+// checksums, if
+// they are kept
+func (m *mover) recordMove(e ManifestEntry) {
+	m.summary.add(e.Target, e.Size, e.Type == ManifestDir)
+	if m.checksums != nil {
+		m.addChecksums(e.Target, e.Type)
+	}
+	if err := m.manifest.record(e); err != nil {
+		m.recordError(MoveError{Op: "manifest", SourcePath: e.Source, TargetPath: e.Target, Err: err}, "Cannot record move of %s in manifest: %v", e.Source)
+	}
+}
@@ -0,0 +1,62 @@
+package mvmv
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// counterMetrics are the statistics exported as Prometheus counters, each
+// named mvmv_<name>_total
+var counterMetrics = []struct {
+	name, help string
+	value      func(*Statistics) *int64
+}{
+	{"entries_scanned", "Source entries examined.", func(s *Statistics) *int64 { return &s.EntriesScanned }},
+	{"dirs_renamed", "Directories moved as a whole.", func(s *Statistics) *int64 { return &s.DirsRenamed }},
+	{"dirs_merged", "Directories merged into an existing target.", func(s *Statistics) *int64 { return &s.DirsMerged }},
+	{"dirs_created", "Directories recreated at the target.", func(s *Statistics) *int64 { return &s.DirsCreated }},
+	{"files_moved", "Files moved, including those copied across filesystems.", func(s *Statistics) *int64 { return &s.FilesMoved }},
+	{"files_copied", "Files copied across filesystems.", func(s *Statistics) *int64 { return &s.FilesCopied }},
+	{"files_overwritten", "Target files replaced.", func(s *Statistics) *int64 { return &s.FilesOverwritten }},
+	{"files_skipped", "Files left in the source.", func(s *Statistics) *int64 { return &s.FilesSkipped }},
+	{"bytes_moved", "Bytes of the files moved.", func(s *Statistics) *int64 { return &s.BytesMoved }},
+	{"retries", "Operations retried after a transient error.", func(s *Statistics) *int64 { return &s.Retries }},
+	{"errors", "Errors recorded.", func(s *Statistics) *int64 { return &s.Errors }},
+}
+
+// serveMetrics starts an HTTP server on l that exports stats at /metrics in
+// the Prometheus text format while the run goes on. The caller closes it
+// once the run is over.
+func serveMetrics(l net.Listener, stats *Statistics) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, stats)
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(l)
+	return srv
+}
+
+// writeMetrics writes the current statistics in the Prometheus text format
+func writeMetrics(w io.Writer, stats *Statistics) {
+	for _, c := range counterMetrics {
+		name := "mvmv_" + c.name + "_total"
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, c.help, name, name, atomic.LoadInt64(c.value(stats)))
+	}
+
+	fmt.Fprintf(w, "# HELP mvmv_skipped_total Entries left in the source, by reason.\n# TYPE mvmv_skipped_total counter\n")
+	for r := range stats.Skipped {
+		fmt.Fprintf(w, "mvmv_skipped_total{reason=%q} %d\n", SkipReason(r).String(), atomic.LoadInt64(&stats.Skipped[r]))
+	}
+
+	elapsed := time.Since(stats.StartTime)
+	fmt.Fprintf(w, "# HELP mvmv_bytes_per_second Average rate of data moved since the start.\n# TYPE mvmv_bytes_per_second gauge\n")
+	fmt.Fprintf(w, "mvmv_bytes_per_second %g\n", perSecond(atomic.LoadInt64(&stats.BytesMoved), elapsed))
+	fmt.Fprintf(w, "# HELP mvmv_elapsed_seconds Time since the start of the run.\n# TYPE mvmv_elapsed_seconds gauge\n")
+	fmt.Fprintf(w, "mvmv_elapsed_seconds %g\n", elapsed.Seconds())
+}
@@ -0,0 +1,54 @@
+package mvmv
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+// targetNotDir reports whether the existing target of a source directory
+// is something it can't be merged into: a file, or a symlink that doesn't
+// lead to a directory. Directories are merged through symlinks to
+// directories like into the directories themselves.
+func (m *mover) targetNotDir(targetPath string, targetInfo os.FileInfo) bool {
+	if targetInfo.IsDir() {
+		return false
+	}
+	if targetInfo.Mode()&os.ModeSymlink != 0 {
+		info, err := m.statTarget(targetPath)
+		return err != nil || !info.IsDir()
+	}
+	return true
+}
+
+// dirOntoNonDir handles a source directory whose target is not a directory.
+// With ReplaceMismatched the target is removed and true returned, so the
+// directory can take its place; otherwise the directory is left in the
+// source as a failure of its own, rather than one for every entry in it.
+func (m *mover) dirOntoNonDir(sourcePath, targetPath string) bool {
+	atomic.AddInt64(&m.stats.TypeMismatches, 1)
+	if !m.opts.ReplaceMismatched {
+		m.progress.treeDone(sourcePath)
+		m.recordError(MoveError{Op: "move", SourcePath: sourcePath, TargetPath: targetPath, Err: syscall.ENOTDIR}, "Cannot merge directory %s into its target: %v", sourcePath)
+		return false
+	}
+	if err := m.removeMismatched(sourcePath, targetPath); err != nil {
+		m.progress.treeDone(sourcePath)
+		return false
+	}
+	return true
+}
+
+// removeMismatched removes a target of another type than its source, with
+// everything below it for a directory. A dry run only reports it.
+func (m *mover) removeMismatched(sourcePath, targetPath string) error {
+	m.logOp(opEvent{Op: "removed", Source: sourcePath, Target: targetPath, Reason: "type mismatch"}, "Removing target of another type: %s\n", targetPath)
+	if m.opts.DryRun {
+		return nil
+	}
+	if err := os.RemoveAll(targetPath); err != nil {
+		m.recordError(MoveError{Op: "remove", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Cannot remove the target of %s: %v", sourcePath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,2086 @@
+// Package mvmv merges directory trees by moving every file and directory
+// that doesn't exist in the target yet, using a pool of parallel workers.
+package mvmv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options holds the configuration for the move operation
+type Options struct {
+	// Workers is the number of parallel workers; 0 means one per CPU core
+	// and AutoWorkers picks it by storage type
+	Workers int
+	// Buffer is the number of queued jobs room is made for up front; the
+	// queue grows past it as needed
+	Buffer  int
+	Stats   bool
+	Verbose bool
+	DryRun  bool
+	ShardBy string
+
+	// StatsInterval is how often the live statistics line is printed with
+	// Stats; zero means DefaultStatsInterval and a negative value prints
+	// only the final statistics. The progress bar keeps its own pace
+	StatsInterval time.Duration
+
+	// ShowConflicts narrows a dry run down to the source files whose target
+	// already exists, reported as "conflict" operations saying how size and
+	// modification time differ, and errors. It requires DryRun
+	ShowConflicts bool
+
+	// ShowSkipped narrows a dry run down to the entries that would be left
+	// in the source because they already exist at the target, reported as
+	// "skipped" operations with how size and modification time differ, and
+	// errors. It requires DryRun and can't be combined with ShowConflicts
+	ShowSkipped bool
+
+	// Quiet silences the statistics, progress and informational messages
+	// while logging every error as it happens, since no final summary
+	// lists them. It can't be combined with Verbose
+	Quiet bool
+
+	// Watch keeps moving files that appear in the source for this long after
+	// the main pass, once they have gone WatchSettle without changes
+	Watch       time.Duration
+	WatchSettle time.Duration
+
+	// CountDirBytes adds the size of the files in every directory renamed
+	// as a whole to BytesMoved, which otherwise only counts files moved one
+	// by one. It costs a walk of each renamed tree before the rename
+	CountDirBytes bool
+
+	// ResourceStats adds CPU time and peak memory to the final statistics
+	ResourceStats bool
+
+	// MoveSymlinks recreates symlinks at the target verbatim instead of
+	// skipping them
+	MoveSymlinks bool
+
+	// RewriteSymlinks recreates symlinks at the target, rewriting links into the source tree
+	RewriteSymlinks bool
+
+	// FollowSymlinks replaces links to regular files inside the source tree
+	// with copies of those files; other links are handled as without it
+	FollowSymlinks bool
+
+	// SkipIfInTarget skips source files present anywhere in the target, matched by IndexBy
+	SkipIfInTarget bool
+	IndexBy        string
+
+	// HashDenylist is a file of SHA-256 digests; matching files are never moved
+	// and are removed from the source when DeleteDenied is set
+	HashDenylist string
+	DeleteDenied bool
+
+	// CreateTarget creates a missing target directory before moving
+	CreateTarget bool
+
+	// DirMode gives every directory mvmv creates exactly these permissions,
+	// regardless of the umask: the target and its parents with
+	// CreateTarget or TargetSubdir, the directories recreated at the target
+	// to receive entries one by one, and the parents of files picked up
+	// with Watch. Zero keeps the source directory's permissions for
+	// recreated directories, and the umask applies to the others. Only the
+	// permission bits are used
+	DirMode os.FileMode
+
+	// Overwrite replaces existing target files with the source version
+	Overwrite bool
+
+	// OverwriteNewer replaces existing target files only when the source has a
+	// strictly newer modification time
+	OverwriteNewer bool
+
+	// SkipSpecial leaves named pipes, sockets and device nodes in the
+	// source. Otherwise they are renamed like files, or recreated with
+	// mknod across filesystems where supported (Linux)
+	SkipSpecial bool
+
+	// ReplaceMismatched removes a target of another type than its source,
+	// a file where a directory is moved or a directory, with everything in
+	// it, where a file is, so that the source takes its place. By default
+	// a directory onto a file fails and a file onto a directory is skipped
+	ReplaceMismatched bool
+
+	// DeleteIdentical removes a source file instead of skipping it when the
+	// target file has the same contents. Contents are only hashed when the
+	// sizes match. It takes precedence over the other conflict options
+	DeleteIdentical bool
+
+	// ConflictRename keeps both files when the target exists, moving the
+	// source under the first free name of the form "name (N).ext". It can't
+	// be combined with Overwrite or OverwriteNewer
+	ConflictRename bool
+
+	// PreserveHardLinks keeps files that are hard links to each other linked
+	// when they are copied across devices: the first one is copied and the
+	// others are linked to the copy instead of storing the data again
+	PreserveHardLinks bool
+
+	// MaxDepth stops merging at this many levels below the source root:
+	// entries at that depth are only ever moved as a unit, and a directory
+	// there that already exists at the target is left in the source as a
+	// conflict instead of being merged. Zero means unlimited
+	MaxDepth int
+
+	// CaseCollisions decides what happens to source entries whose names
+	// differ only in case when the target filesystem ignores case:
+	// CaseCollisionError (the default) records an error for each of them
+	// and moves none, CaseCollisionKeep moves the first in byte order and
+	// skips the others. Case-sensitive targets are unaffected
+	CaseCollisions string
+
+	// SyncDirPerms sets the permissions of every directory merged into an
+	// existing target directory to the source directory's, once everything
+	// below it has been handled
+	SyncDirPerms bool
+
+	// CheckSpace makes sure, before anything is moved, that every target
+	// filesystem has room for the data copied onto it from other
+	// filesystems, and fails the run otherwise. Files the filters or
+	// existing targets leave behind are not counted
+	CheckSpace bool
+
+	// AllowCrossDevice falls back to copy and delete when a rename fails
+	// because source and target are on different filesystems
+	AllowCrossDevice bool
+
+	// MaxOpenFiles bounds the file descriptors held by concurrent copies
+	// across filesystems, independently of Workers; each copy holds two.
+	// Zero derives it from the process's descriptor limit, and a negative
+	// value means no bound. Renames hold no descriptors and are unaffected
+	MaxOpenFiles int
+
+	// NoTempFile writes copies across filesystems straight to the target
+	// name instead of a temporary file in the same directory renamed into
+	// place once complete. An interrupted run may then leave a partial file
+	// under the real name, which the next run skips as existing. Temporary
+	// files left by an interrupted run are removed by the next one that
+	// copies into their directory
+	NoTempFile bool
+
+	// CopyBufferSize is the size in bytes of the buffers data copied across
+	// filesystems passes through; zero means DefaultCopyBufferSize. Larger
+	// buffers mean fewer, bigger reads, which helps on high-latency
+	// storage. Buffers are reused between files. Where the kernel copies a
+	// file by itself, as Linux may without Verify or RateLimit, no buffer
+	// is used
+	CopyBufferSize int
+
+	// RateLimit caps the combined rate of data copied across filesystems,
+	// in bytes per second; zero means unlimited. Renames are unaffected
+	RateLimit int64
+
+	// Verify checks the checksum of every copied file before the source is
+	// deleted; renames need no verification
+	Verify bool
+
+	// Fsync syncs the parent directories of every entry renamed, copied or
+	// created, so that the move survives a crash once it is reported.
+	// Copied files are synced anyway. It does nothing where directories
+	// can't be synced, such as on Windows
+	Fsync bool
+
+	// PreserveOwnership gives copied files and created directories the
+	// source's uid and gid. It has no effect on Windows
+	PreserveOwnership bool
+
+	// PreserveXattrs gives copied files and created directories the
+	// source's extended attributes, including SELinux labels and POSIX
+	// ACLs. Linux only; a target filesystem without extended attributes
+	// gets a warning rather than an error
+	PreserveXattrs bool
+
+	// NoReplace has the kernel refuse renames onto existing targets (Linux renameat2)
+	NoReplace bool
+
+	// AtomicDirs moves the files of each merged directory all-or-nothing.
+	// It can't be combined with Overwrite, OverwriteNewer or
+	// ReplaceMismatched, since a replaced target can't be brought back
+	AtomicDirs bool
+
+	// Flatten moves every file straight into the target directory,
+	// whatever its depth in the source, and never creates directories
+	// below the target. Files sharing a name are conflicts like any other,
+	// resolved by the conflict options in the order they are moved. It
+	// can't be combined with AtomicDirs
+	Flatten bool
+
+	// TargetNameTransform, if set, renames every file on its way to the
+	// target: it gets the file's path relative to its source root and
+	// returns the file's new name, in the directory it would have gone to
+	// anyway. Directories keep their names, and are merged entry by entry
+	// rather than moved as a whole. A transformed name that already exists
+	// is a conflict like any other. It can't be combined with AtomicDirs
+	TargetNameTransform func(relPath string) string
+
+	// PruneEmpty removes source directories left empty once everything
+	// below them has been handled. Source roots are kept
+	PruneEmpty bool
+
+	// KeepTree leaves the source directory tree in place, emptied of the
+	// files moved out of it. Directories are then never renamed as a whole
+	// but recreated at the target and moved entry by entry, which is slower
+	// for directories missing at the target. It can't be combined with
+	// PruneEmpty or DeleteSourceOnSuccess
+	KeepTree bool
+
+	// DeleteSourceOnSuccess removes each source root once the run finishes
+	// without errors. Nothing is removed after errors or an interruption.
+	// When the run left entries in the source on purpose, such as files
+	// skipped or filtered out, directories left at MaxDepth or files still
+	// changing when Watch ended, only the directories it emptied are removed
+	DeleteSourceOnSuccess bool
+
+	// Timings measures every rename and copy. Verbose output then reports
+	// how long each took, and the slowest are listed in Result.Slowest
+	Timings bool
+
+	// ChecksumManifest writes a SHA256SUMS file, readable by sha256sum -c,
+	// to each target root listing the files moved into it. Files renamed on
+	// the same filesystem are read back to be hashed, so this costs a full
+	// read of everything moved; MinSize and MaxSize limit which files count
+	ChecksumManifest bool
+
+	// DebugSignal dumps queued jobs and per-worker paths to stderr on SIGUSR1
+	DebugSignal bool
+
+	// StallTimeout, when positive, warns if no statistics counter advances
+	// for this long while workers are busy, as when a hung network mount
+	// blocks them in a rename, naming the path each busy worker is on.
+	// Copies then count bytes as they go, which keeps them from using the
+	// kernel's in-place copy.
+	StallTimeout time.Duration
+
+	// StallAbort stops the run on a stall found with StallTimeout. Move
+	// then returns without waiting for the stuck operations, which are left
+	// blocked, and its RunError matches ErrStalled.
+	StallAbort bool
+
+	// MetricsAddr is a TCP address such as ":9090" on which the live
+	// statistics are served at /metrics in the Prometheus text format for
+	// the duration of the run; empty serves nothing
+	MetricsAddr string
+
+	// Include restricts the move to files whose base name matches one of
+	// these glob patterns; directories are always traversed
+	Include []string
+
+	// Exclude leaves files and whole directory subtrees whose base name
+	// matches one of these glob patterns in the source. It takes precedence
+	// over Include
+	Exclude []string
+
+	// MinSize and MaxSize restrict the move to files of at least and at
+	// most this many bytes; zero means no limit
+	MinSize int64
+	MaxSize int64
+
+	// NewerThan and OlderThan restrict the move to files modified after and
+	// before these times; the zero time means no limit. All file filters
+	// must pass for a file to be moved
+	NewerThan time.Time
+	OlderThan time.Time
+
+	// NoIgnore disables .mvmvignore files
+	NoIgnore bool
+
+	// Filter, if set, decides for every entry below a source root whether it
+	// is moved, left in the source or, for a directory, descended into, before
+	// any other filter is applied. It is called from all workers
+	// concurrently, so it must be safe for concurrent use
+	Filter func(path string, info os.FileInfo) Decision
+
+	// Retries is how many times a rename or copy failing with a transient
+	// error such as EIO or EINTR is repeated before the failure is recorded.
+	// RetryDelay is the wait before the first retry, doubling after each one;
+	// zero means DefaultRetryDelay
+	Retries    int
+	RetryDelay time.Duration
+
+	// faultInjector, if set, is called with the source path before every
+	// rename of a file or directory, and an error it returns is treated as
+	// the rename's own. It exists to exercise error handling without a
+	// broken filesystem: tests set it directly and the CLI through
+	// testhooks.SetFaultInjector
+	faultInjector func(path string) error
+
+	// ManifestPath names a file to which a JSON line is appended for every
+	// completed move of a file, directory tree or symlink, as it happens.
+	// Dry runs write nothing
+	ManifestPath string
+
+	// SummaryDepth, when positive, has Result.Summary count the completed
+	// moves per target directory, down to this many levels below each
+	// target root. Only the counts per directory are kept, not the paths
+	// moved, and dry runs count nothing
+	SummaryDepth int
+
+	// Ordered reports operations and errors sorted by source path instead
+	// of in the order workers happen to finish them, so the dry-run plan and
+	// verbose output are the same from run to run. Reports are held until
+	// the work is done; the move itself stays parallel
+	Ordered bool
+
+	// CheckpointPath names a file where the source paths completed so far
+	// are saved every few seconds and at the end of the run. Dry runs write
+	// nothing
+	CheckpointPath string
+
+	// Resume loads CheckpointPath, if it exists, and skips the paths an
+	// earlier run completed without looking into them
+	Resume bool
+
+	// OnProgress, if set, is called for every operation as it is carried
+	// out or planned, whether or not Verbose is set: each move, skip, merge
+	// and so on, and an "error" event for each failure, which follows the
+	// event of the operation that failed. It is called from the worker
+	// goroutines concurrently and must be safe for that; a slow callback
+	// holds up the workers
+	OnProgress func(ev ProgressEvent)
+
+	// Logger receives verbose operations, errors and informational
+	// messages, with the operation, paths and size as attributes. Nil logs
+	// as text to stderr. JSON output and the dry-run plan still go to stdout
+	Logger *slog.Logger
+
+	// FailFast stops the run at the first failed operation instead of
+	// continuing with the remaining entries
+	FailFast bool
+
+	// MaxErrors stops the run once more than this many operations failed,
+	// and MaxErrorPercent once failures exceed this percentage of the
+	// entries scanned, judged only after the first MinErrorSample entries.
+	// Zero means no limit. The RunError returned then has TooMany set
+	MaxErrors       int
+	MaxErrorPercent float64
+
+	// Inaccessible decides what becomes of source directories whose entries
+	// can't be listed, e.g. for lack of permission. Each is left in the
+	// source with everything below it and, with InaccessibleError (the
+	// default), recorded as a failure. InaccessibleFail also stops the run
+	// as FailFast would. InaccessibleReport lists them in
+	// Result.Inaccessible instead, apart from the failures, and they don't
+	// fail the run
+	Inaccessible string
+
+	// Progress counts the source files up front and shows a progress bar
+	// with percentage, rate and ETA instead of the Stats ticker
+	Progress bool
+
+	// Output selects the report format, OutputText (the default) or
+	// OutputJSON. JSON output writes verbose operations as one object per
+	// line and always ends with a report object.
+	Output string
+}
+
+// Statistics tracks metrics during the move operation
+type Statistics struct {
+	// EntriesScanned counts every source entry examined: directories,
+	// files and symlinks, including filtered ones
+	EntriesScanned int64 `json:"entries_scanned"`
+
+	// Every checked directory was either renamed to the target as a whole,
+	// merged into an existing target directory, recreated at the target to
+	// receive its entries one by one, left as a conflict at MaxDepth, or
+	// failed
+	DirsChecked  int64 `json:"dirs_checked"`
+	DirsRenamed  int64 `json:"dirs_renamed"`
+	DirsMerged   int64 `json:"dirs_merged"`
+	DirsCreated  int64 `json:"dirs_created"`
+	DirConflicts int64 `json:"dir_conflicts"`
+
+	// DirsInaccessible counts the directories left unread with
+	// InaccessibleReport
+	DirsInaccessible int64 `json:"dirs_inaccessible"`
+
+	// SpecialFilesMoved counts the named pipes, sockets and device nodes
+	// among the moved files
+	SpecialFilesMoved int64 `json:"special_files_moved"`
+
+	// TypeMismatches counts the sources whose target was of another type,
+	// removed with ReplaceMismatched
+	TypeMismatches int64 `json:"type_mismatches"`
+
+	DirsFiltered      int64     `json:"dirs_filtered"`
+	DirsPruned        int64     `json:"dirs_pruned"`
+	DirModesSynced    int64     `json:"dir_modes_synced"`
+	FilesChecked      int64     `json:"files_checked"`
+	FilesSkipped      int64     `json:"files_skipped"`
+	FileConflicts     int64     `json:"file_conflicts"`
+	FilesOverwritten  int64     `json:"files_overwritten"`
+	FilesRenamed      int64     `json:"files_renamed"`
+	FilesDeduplicated int64     `json:"files_deduplicated"`
+	FilesMoved        int64     `json:"files_moved"`
+	FilesCopied       int64     `json:"files_copied"`
+	FilesLinked       int64     `json:"files_linked"`
+	FilesDenied       int64     `json:"files_denied"`
+	FilesFiltered     int64     `json:"files_filtered"`
+	BytesMoved        int64     `json:"bytes_moved"`
+	BytesVerified     int64     `json:"bytes_verified"`
+	DirsRolledBack    int64     `json:"dirs_rolled_back"`
+	FilesRolledBack   int64     `json:"files_rolled_back"`
+	SymlinksSkipped   int64     `json:"symlinks_skipped"`
+	SymlinksMoved     int64     `json:"symlinks_moved"`
+	SymlinksFollowed  int64     `json:"symlinks_followed"`
+	Retries           int64     `json:"retries"`
+	SourcesDeleted    int64     `json:"sources_deleted"`
+	Resumed           int64     `json:"resumed"`
+	Errors            int64     `json:"errors"`
+	TotalFiles        int64     `json:"total_files"`
+	TotalBytes        int64     `json:"total_bytes"`
+	StartTime         time.Time `json:"start_time"`
+
+	// Skipped counts every entry left in the source by why it was skipped
+	Skipped SkipCounts `json:"skipped"`
+
+	// targetStats counts the targets stated, for the tests
+	targetStats int64
+}
+
+// Job represents a single move operation
+type Job struct {
+	SourcePath string
+	TargetPath string
+
+	// SourceRoot and TargetRoot are the top-level directories this job descends from
+	SourceRoot string
+	TargetRoot string
+
+	// ignore holds the .mvmvignore rules in effect for the job's directory
+	ignore *ignoreRules
+
+	// caseTwin names a sibling whose name differs only in case, set when
+	// the target is case-insensitive
+	caseTwin string
+
+	// targetMissing is set when TargetPath is known not to exist
+	targetMissing bool
+}
+
+// Result summarizes a completed move operation
+type Result struct {
+	Statistics
+
+	// Elapsed is the wall time of the run, from the start of the work
+	Elapsed time.Duration
+
+	// Interrupted is set when the run was cancelled before all work was done
+	Interrupted bool
+
+	// Failures lists every failed operation
+	Failures []MoveError
+
+	// Inaccessible lists the source directories that couldn't be read with
+	// InaccessibleReport
+	Inaccessible []MoveError
+
+	// Summary holds a tree of the target directories that received entries
+	// for each target root, with SummaryDepth
+	Summary []*SummaryNode
+
+	// Slowest lists the slowest renames and copies, slowest first, with
+	// Timings
+	Slowest []OpTiming
+
+	// Shards lists where Shard sent each top-level entry
+	Shards []ShardAssignment
+}
+
+// Transfer pairs a source directory with the directory it is merged into
+type Transfer struct {
+	Source string
+	Target string
+}
+
+// ParseTransfer resolves a source argument the way rsync does: with a
+// trailing slash, or as ".", the directory's contents are merged into
+// target; otherwise the directory itself is, as target/<name>. A relative
+// arg is taken from the working directory.
+func ParseTransfer(arg, target string) Transfer {
+	source, err := filepath.Abs(arg)
+	if err != nil {
+		source = filepath.Clean(arg)
+	}
+	if strings.HasSuffix(arg, "/") || strings.HasSuffix(arg, string(filepath.Separator)) || filepath.Base(arg) == "." {
+		return Transfer{Source: source, Target: target}
+	}
+	return Transfer{Source: source, Target: filepath.Join(target, filepath.Base(source))}
+}
+
+// Move executes the parallel move operation, merging every source directory
+// into target. Paths should be absolute and cleaned.
+func Move(ctx context.Context, sources []string, target string, opts Options) (Result, error) {
+	transfers := make([]Transfer, 0, len(sources))
+	for _, source := range sources {
+		transfers = append(transfers, Transfer{Source: source, Target: target})
+	}
+	if err := checkTransfers(transfers); err != nil {
+		return Result{}, &PathError{Err: err}
+	}
+	if err := ensureTarget(target, sources[0], &opts); err != nil {
+		return Result{}, &PathError{Err: err}
+	}
+	return runJobs(ctx, transferJobs(transfers), &opts, nil)
+}
+
+// MoveAll merges the source of every transfer into its target in a single
+// run. A target that doesn't exist yet is handled like any missing entry:
+// the source is moved there whole, so only its parent has to exist, or be
+// created with CreateTarget. Paths should be absolute and cleaned.
+func MoveAll(ctx context.Context, transfers []Transfer, opts Options) (Result, error) {
+	if err := checkTransfers(transfers); err != nil {
+		return Result{}, &PathError{Err: err}
+	}
+	checked := make(map[string]bool)
+	for _, t := range transfers {
+		target := existingTarget(t.Target)
+		if checked[target] {
+			continue
+		}
+		checked[target] = true
+		if err := ensureTarget(target, t.Source, &opts); err != nil {
+			return Result{}, &PathError{Err: err}
+		}
+	}
+	return runJobs(ctx, transferJobs(transfers), &opts, nil)
+}
+
+// checkTransfers validates the sources and refuses targets that overlap them
+func checkTransfers(transfers []Transfer) error {
+	if len(transfers) == 0 {
+		return fmt.Errorf("at least one source is required")
+	}
+	for _, t := range transfers {
+		if err := validateSource(t.Source); err != nil {
+			return err
+		}
+		if err := checkNesting(t.Source, t.Target); err != nil {
+			return err
+		}
+		if err := checkOverlap(t.Source, t.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferJobs returns the seed job of every transfer
+func transferJobs(transfers []Transfer) []Job {
+	seeds := make([]Job, 0, len(transfers))
+	for _, t := range transfers {
+		seeds = append(seeds, Job{
+			SourcePath: t.Source,
+			TargetPath: t.Target,
+			SourceRoot: t.Source,
+			TargetRoot: t.Target,
+		})
+	}
+	return seeds
+}
+
+// existingTarget returns target, or its parent when target doesn't exist
+// yet and a source will be moved there as a whole
+func existingTarget(target string) string {
+	if _, err := os.Lstat(target); errors.Is(err, os.ErrNotExist) {
+		return filepath.Dir(target)
+	}
+	return target
+}
+
+// validateSource checks that source is an existing directory and not a symlink
+func validateSource(source string) error {
+	// Verify source exists using Lstat to not follow symlinks
+	sourceInfo, err := os.Lstat(source)
+	if err != nil {
+		return fmt.Errorf("source path error: %w", err)
+	}
+	if !sourceInfo.IsDir() {
+		return fmt.Errorf("source must be a directory")
+	}
+	if sourceInfo.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("source cannot be a symlink")
+	}
+	return nil
+}
+
+// errTargetInSource is recorded for a target directory that resolves back
+// into the source tree
+var errTargetInSource = errors.New("target resolves into the source tree")
+
+// checkNesting refuses a target below the source and a source below the
+// target, comparing the cleaned absolute paths. checkOverlap catches the
+// cases this misses, where the same directory is reached by another path.
+func checkNesting(source, target string) error {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	if rel, ok := relativeTo(absSource, absTarget); ok && rel != "." {
+		return fmt.Errorf("target %s is inside source %s", target, source)
+	}
+	if rel, ok := relativeTo(absTarget, absSource); ok && rel != "." {
+		return fmt.Errorf("source %s is inside target %s", source, target)
+	}
+	return nil
+}
+
+// checkOverlap refuses a target that is the source directory or lies inside
+// it, however either is reached: through symlinks, bind mounts or another
+// path to the same directory. Entries moved there would be found again by
+// the traversal. A target that doesn't exist yet is judged by its nearest
+// existing parent.
+func checkOverlap(source, target string) error {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return nil
+	}
+
+	dir, err := filepath.Abs(target)
+	if err != nil {
+		return nil
+	}
+	exact := true
+	for {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = real
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir, exact = parent, false
+	}
+
+	for {
+		if info, err := os.Stat(dir); err == nil && sameFile(info, sourceInfo) {
+			if exact {
+				return fmt.Errorf("target %s is the same directory as source %s", target, source)
+			}
+			return fmt.Errorf("target %s is inside source %s", target, source)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir, exact = parent, false
+	}
+}
+
+// resolvesInto reports whether path, once symlinks are resolved, lies
+// inside root
+func resolvesInto(path, root string) bool {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	_, ok := relativeTo(realRoot, realPath)
+	return ok
+}
+
+// ensureTarget validates target, first creating it when it is missing and
+// CreateTarget is set. The created directories get DirMode, or else the
+// source's permissions.
+func ensureTarget(target, source string, opts *Options) error {
+	if opts.CreateTarget {
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			sourceInfo, err := os.Lstat(source)
+			if err != nil {
+				return fmt.Errorf("source path error: %w", err)
+			}
+
+			if (opts.Verbose || opts.DryRun) && opts.Output != OutputJSON {
+				fmt.Printf("Creating target directory: %s\n", target)
+			}
+			if opts.DryRun {
+				// Nothing exists to validate yet
+				return nil
+			}
+			if err := mkdirTarget(target, sourceInfo.Mode().Perm(), opts); err != nil {
+				return fmt.Errorf("cannot create target: %w", err)
+			}
+		}
+	}
+
+	return validateTarget(target)
+}
+
+// validateTarget checks that target is an existing directory and not a symlink
+func validateTarget(target string) error {
+	targetInfo, err := os.Lstat(target)
+	if err != nil {
+		return fmt.Errorf("target path error: %w", err)
+	}
+	if !targetInfo.IsDir() {
+		return fmt.Errorf("target must be a directory")
+	}
+	if targetInfo.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("target cannot be a symlink")
+	}
+	return nil
+}
+
+// mover holds the state shared by the workers of a single run
+type mover struct {
+	opts     *Options
+	stats    *Statistics
+	index    *targetIndex
+	denylist *hashDenylist
+	tracker  *jobTracker
+	log      *slog.Logger
+	errLog   *errorLog
+	failures failureList
+
+	// inaccessible collects the unreadable directories with InaccessibleReport
+	inaccessible failureList
+	progress     *progress
+	dirs         *dirTracker
+	limiter      *rateLimiter
+
+	// manifest records completed moves, nil if not kept
+	manifest *manifest
+
+	// summary aggregates completed moves by target directory, nil unless
+	// SummaryDepth is set
+	summary *treeSummary
+
+	// checkpoint tracks completed paths, nil if not kept, and resume holds
+	// the paths an earlier run completed, nil unless resuming
+	checkpoint *checkpoint
+	resume     *sync.Map
+
+	// links maps hard-linked files copied across devices to their copies,
+	// nil unless PreserveHardLinks is set
+	links *linkTable
+
+	// xattrWarning reports a target without extended attributes only once
+	xattrWarning sync.Once
+
+	// claimed holds the names picked by conflictName during the run, so two
+	// workers never settle on the same one
+	claimed sync.Map
+
+	// targetLocks holds a mutex per target path with Flatten or
+	// TargetNameTransform
+	targetLocks sync.Map
+
+	// foldCase holds the target roots on case-insensitive filesystems
+	foldCase map[string]bool
+
+	// disjointTargets is set when no two seeds share target paths
+	disjointTargets bool
+
+	// spawn queues the children of a directory whose job is still running,
+	// nil outside of a run
+	spawn func(parent Job, children []Job)
+
+	// slowest keeps the slowest operations with Timings, nil otherwise
+	slowest *slowestList
+
+	// checksums collects the digests of moved files with ChecksumManifest,
+	// nil otherwise
+	checksums *checksumList
+
+	// copySlots is a semaphore bounding concurrent copies, nil if unbounded
+	copySlots chan struct{}
+
+	// buffers holds copy buffers of CopyBufferSize for reuse
+	buffers sync.Pool
+
+	// copied counts the bytes read by copies with StallTimeout, so the
+	// watchdog sees a long copy advance
+	copied atomic.Int64
+
+	// stallAbort is closed when StallAbort stops a stalled run, which also
+	// sets stalled; nil without StallAbort
+	stallAbort chan struct{}
+	stallOnce  sync.Once
+	stalled    atomic.Bool
+
+	// unsettled is the number of files the watch left in the source
+	// because they were still changing when it ended
+	unsettled atomic.Int64
+
+	// noReplace holds the devices found not to support renameNoReplace
+	noReplace noReplaceDevices
+
+	// tempDirs holds a sync.Once per target directory copied into, which
+	// clears it of stale temporary files before the first copy
+	tempDirs sync.Map
+
+	// cancel stops the run; with FailFast it is called on the first error,
+	// which is kept in firstErr, and tooMany is set when it is called for
+	// exceeding MaxErrors or MaxErrorPercent
+	cancel   context.CancelFunc
+	firstErr atomic.Pointer[MoveError]
+	tooMany  atomic.Bool
+
+	// out is set when writing JSON output
+	out *jsonOutput
+
+	// reports holds operations to be reported in order, nil unless Ordered
+	reports *reportBuffer
+}
+
+// validateOptions rejects option values that are invalid or can't be combined
+func validateOptions(opts *Options) error {
+	if err := validateOutput(opts.Output); err != nil {
+		return err
+	}
+	if err := validateCaseCollisions(opts.CaseCollisions); err != nil {
+		return err
+	}
+	if err := validateInaccessible(opts.Inaccessible); err != nil {
+		return err
+	}
+	if err := validatePatterns(opts.Include); err != nil {
+		return err
+	}
+	if err := validatePatterns(opts.Exclude); err != nil {
+		return err
+	}
+	if opts.ConflictRename && (opts.Overwrite || opts.OverwriteNewer) {
+		return fmt.Errorf("renaming on conflict can't be combined with overwriting")
+	}
+	if opts.AtomicDirs && (opts.Overwrite || opts.OverwriteNewer || opts.ReplaceMismatched) {
+		return fmt.Errorf("atomic directories can't be combined with replacing targets, which a rollback couldn't restore")
+	}
+	if opts.Flatten && opts.AtomicDirs {
+		return fmt.Errorf("flattening can't be combined with atomic directories")
+	}
+	if opts.TargetNameTransform != nil && opts.AtomicDirs {
+		return fmt.Errorf("renaming files can't be combined with atomic directories")
+	}
+	if opts.KeepTree && (opts.PruneEmpty || opts.DeleteSourceOnSuccess) {
+		return fmt.Errorf("keeping the source tree can't be combined with removing source directories")
+	}
+	if opts.Quiet && opts.Verbose {
+		return fmt.Errorf("quiet and verbose output can't be combined")
+	}
+	if opts.ShowConflicts && !opts.DryRun {
+		return fmt.Errorf("showing conflicts requires a dry run")
+	}
+	if opts.ShowSkipped && !opts.DryRun {
+		return fmt.Errorf("showing skipped entries requires a dry run")
+	}
+	if opts.ShowSkipped && opts.ShowConflicts {
+		return fmt.Errorf("skipped entries and conflicts can't be shown together")
+	}
+	if opts.SummaryDepth < 0 {
+		return fmt.Errorf("summary depth %d is negative", opts.SummaryDepth)
+	}
+	if opts.MaxErrors < 0 {
+		return fmt.Errorf("maximum error count %d is negative", opts.MaxErrors)
+	}
+	if opts.StallTimeout < 0 {
+		return fmt.Errorf("stall timeout %s is negative", opts.StallTimeout)
+	}
+	if opts.StallAbort && opts.StallTimeout == 0 {
+		return fmt.Errorf("stopping on a stall requires a stall timeout")
+	}
+	if opts.CopyBufferSize < 0 {
+		return fmt.Errorf("copy buffer size %d is negative", opts.CopyBufferSize)
+	}
+	if opts.MaxErrorPercent < 0 || opts.MaxErrorPercent >= 100 {
+		return fmt.Errorf("maximum error percentage %g is not between 0 and 100", opts.MaxErrorPercent)
+	}
+	if opts.Resume && opts.CheckpointPath == "" {
+		return fmt.Errorf("resuming requires a checkpoint file")
+	}
+	if opts.MaxSize > 0 && opts.MinSize > opts.MaxSize {
+		return fmt.Errorf("minimum size %d is larger than maximum size %d", opts.MinSize, opts.MaxSize)
+	}
+	if !opts.NewerThan.IsZero() && !opts.OlderThan.IsZero() && !opts.NewerThan.Before(opts.OlderThan) {
+		return fmt.Errorf("no file can be newer than %s and older than %s",
+			opts.NewerThan.Format(time.RFC3339), opts.OlderThan.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// runJobs processes the seed jobs and everything they expand to with a pool
+// of workers. shards holds the assignments of a Shard run for the result.
+func runJobs(ctx context.Context, seeds []Job, opts *Options, shards []ShardAssignment) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	switch {
+	case opts.Workers == AutoWorkers:
+		var rot bool
+		opts.Workers, rot = autoWorkers(seeds)
+		if rot && opts.Verbose {
+			newLogger(opts).Info("Using fewer workers for a spinning disk", "workers", opts.Workers)
+		}
+	case opts.Workers <= 0:
+		opts.Workers = runtime.NumCPU()
+	}
+	if err := validateOptions(opts); err != nil {
+		return Result{}, &OptionsError{Err: err}
+	}
+	if opts.PreserveOwnership && !ownershipSupported {
+		newLogger(opts).Warn("Preserving ownership is not supported on this platform, files will be owned by the current user")
+	}
+	if opts.PreserveXattrs && !xattrsSupported {
+		newLogger(opts).Warn("Preserving extended attributes is only supported on Linux")
+	}
+
+	// Index the target before anything is moved into it
+	var index *targetIndex
+	if opts.SkipIfInTarget {
+		roots := make([]string, 0, len(seeds))
+		seen := make(map[string]bool)
+		for _, seed := range seeds {
+			root := existingTarget(seed.TargetRoot)
+			if !seen[root] {
+				seen[root] = true
+				roots = append(roots, root)
+			}
+		}
+
+		var err error
+		index, err = buildTargetIndex(roots, opts.IndexBy)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	var denylist *hashDenylist
+	if opts.HashDenylist != "" {
+		var err error
+		denylist, err = loadDenylist(opts.HashDenylist)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	// Calibrate before any work starts so the scratch files don't affect the scan
+	var cal *Calibration
+	if opts.DryRun && !opts.ShowConflicts && !opts.ShowSkipped && len(seeds) > 0 {
+		var err error
+		cal, err = calibrate(seeds[0].SourceRoot, existingTarget(seeds[0].TargetRoot))
+		if err != nil {
+			newLogger(opts).Warn("Cannot calibrate storage speed", "error", err)
+		}
+	}
+
+	// Names that differ only in case collide on some targets
+	foldCase := probeCaseFolding(seeds, opts)
+
+	stats := &Statistics{}
+	var prog *progress
+	if opts.Progress && opts.Output != OutputJSON && !opts.Quiet {
+		fmt.Print("Scanning source...")
+		prog = scanSources(seeds, stats)
+	}
+	stats.StartTime = time.Now()
+
+	bufferSize := opts.Buffer
+	if bufferSize == 0 {
+		bufferSize = 100000
+	}
+	if bufferSize < len(seeds) {
+		bufferSize = len(seeds)
+	}
+	jobs := newJobQueue(bufferSize)
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var mf *manifest
+	if opts.ManifestPath != "" && !opts.DryRun {
+		var err error
+		if mf, err = openManifest(opts.ManifestPath); err != nil {
+			return Result{}, err
+		}
+		defer mf.close()
+	}
+
+	if opts.MetricsAddr != "" {
+		l, err := net.Listen("tcp", opts.MetricsAddr)
+		if err != nil {
+			return Result{}, fmt.Errorf("metrics: %w", err)
+		}
+		defer serveMetrics(l, stats).Close()
+	}
+
+	var completed []string
+	if opts.Resume {
+		var err error
+		if completed, err = loadCheckpoint(opts.CheckpointPath); err != nil {
+			return Result{}, err
+		}
+	}
+
+	logger := newLogger(opts)
+	m := &mover{
+		opts:     opts,
+		stats:    stats,
+		index:    index,
+		denylist: denylist,
+		log:      logger,
+		errLog:   newErrorLog(logger),
+		cancel:   cancel,
+		progress: prog,
+		dirs:     newDirTracker(),
+		manifest: mf,
+		foldCase: foldCase,
+
+		disjointTargets: disjointTargets(seeds),
+	}
+	if len(completed) > 0 {
+		m.resume = &sync.Map{}
+		for _, path := range completed {
+			m.resume.Store(path, true)
+		}
+	}
+	if opts.CheckpointPath != "" && !opts.DryRun {
+		m.checkpoint = newCheckpoint(opts.CheckpointPath, completed)
+	}
+	if opts.PreserveHardLinks {
+		m.links = newLinkTable()
+	}
+	if opts.SummaryDepth > 0 {
+		m.summary = newTreeSummary(seeds, opts.SummaryDepth)
+	}
+	if opts.RateLimit > 0 {
+		m.limiter = newRateLimiter(opts.RateLimit)
+	}
+	if slots := copySlotCount(opts.MaxOpenFiles); slots > 0 {
+		m.copySlots = make(chan struct{}, slots)
+	}
+	if opts.Output == OutputJSON {
+		m.out = newJSONOutput(os.Stdout)
+	}
+	if opts.Ordered {
+		m.reports = &reportBuffer{}
+	}
+	if opts.Timings {
+		m.slowest = &slowestList{}
+	}
+	if opts.ChecksumManifest && !opts.DryRun {
+		m.checksums = newChecksumList(seeds)
+	}
+
+	if opts.CheckSpace {
+		if err := m.checkSpace(seeds); err != nil {
+			return Result{}, err
+		}
+	}
+
+	errLogDone := make(chan struct{})
+	errLogStopped := make(chan struct{})
+	go func() {
+		m.errLog.run(errLogDone)
+		close(errLogStopped)
+	}()
+
+	var checkpointDone chan struct{}
+	if m.checkpoint != nil {
+		checkpointDone = make(chan struct{})
+		go m.checkpoint.run(checkpointDone, logger)
+	}
+
+	if opts.DebugSignal || opts.StallTimeout > 0 {
+		m.tracker = newJobTracker(opts.Workers)
+	}
+	if opts.StallTimeout > 0 {
+		if opts.StallAbort {
+			m.stallAbort = make(chan struct{})
+		}
+		stallDone := make(chan struct{})
+		defer close(stallDone)
+		go m.watchStalls(stallDone)
+	}
+	if opts.DebugSignal {
+		sigs := make(chan os.Signal, 1)
+		notifyDumpSignal(sigs)
+		defer signal.Stop(sigs)
+		go func() {
+			for range sigs {
+				m.tracker.dump(os.Stderr)
+			}
+		}()
+	}
+
+	var jobsWg sync.WaitGroup
+	m.spawn = func(parent Job, children []Job) {
+		if ctx.Err() != nil {
+			return
+		}
+		m.dirs.expand(parent, len(children))
+		m.queue(jobs, &jobsWg, children)
+	}
+	for i := range opts.Workers {
+		go m.worker(ctx, i, jobs, &jobsWg)
+	}
+
+	// The live progress line would corrupt JSON output. Closing statsDone
+	// stops the reporter, which closes reporterStopped once its last line
+	// is finished or cleared.
+	var statsDone chan struct{}
+	var reporterStopped chan struct{}
+	if m.progress != nil {
+		statsDone = make(chan struct{})
+		reporterStopped = make(chan struct{})
+		go func() {
+			progressReporter(m.progress, stats, statsDone)
+			close(reporterStopped)
+		}()
+	} else if opts.Stats && m.out == nil && !opts.Quiet && opts.StatsInterval >= 0 {
+		interval := opts.StatsInterval
+		if interval == 0 {
+			interval = DefaultStatsInterval
+		}
+		statsDone = make(chan struct{})
+		reporterStopped = make(chan struct{})
+		go func() {
+			statsReporter(os.Stdout, IsTerminal(os.Stdout), stats, interval, statsDone)
+			close(reporterStopped)
+		}()
+	}
+
+	jobsWg.Add(len(seeds))
+	for _, seed := range seeds {
+		m.tracker.queue(seed)
+	}
+	jobs.push(seeds...)
+
+	finished := m.waitJobs(&jobsWg)
+	m.flushReports()
+
+	if opts.Watch > 0 && finished {
+		if err := m.watch(ctx, seeds, jobs, &jobsWg); err != nil {
+			atomic.AddInt64(&stats.Errors, 1)
+			logger.Error(err.Error())
+		}
+		m.waitJobs(&jobsWg)
+	}
+	jobs.close()
+
+	if opts.DeleteSourceOnSuccess && ctx.Err() == nil {
+		m.deleteSources(seeds)
+	}
+	if m.checksums != nil {
+		m.writeChecksums()
+	}
+
+	if checkpointDone != nil {
+		close(checkpointDone)
+		if err := m.checkpoint.save(); err != nil {
+			m.recordError(MoveError{Op: "checkpoint", SourcePath: opts.CheckpointPath, Err: err}, "Cannot save checkpoint %s: %v", opts.CheckpointPath)
+		}
+	}
+	m.flushReports()
+
+	close(errLogDone)
+	<-errLogStopped
+
+	if statsDone != nil {
+		close(statsDone)
+	}
+	if reporterStopped != nil {
+		// Let the final redraw land, or the ticker line be cleared, before
+		// the summary
+		<-reporterStopped
+	}
+	failures := m.failures.list()
+	inaccessible := m.inaccessible.list()
+	if opts.Ordered {
+		slices.SortStableFunc(failures, func(a, b MoveError) int { return comparePaths(a.SourcePath, b.SourcePath) })
+		slices.SortStableFunc(inaccessible, func(a, b MoveError) int { return comparePaths(a.SourcePath, b.SourcePath) })
+	}
+
+	result := Result{
+		Statistics:  *stats,
+		Elapsed:     time.Since(stats.StartTime),
+		Interrupted: ctx.Err() != nil,
+		Failures:    failures,
+
+		Inaccessible: inaccessible,
+		Summary:      m.summary.nodes(),
+		Slowest:      m.slowest.list(),
+		Shards:       shards,
+	}
+
+	if m.out != nil {
+		var estimate time.Duration
+		if cal != nil {
+			estimate = estimateDuration(stats, cal, opts.Workers)
+		}
+		m.out.report(&result, opts, estimate)
+	} else if cal != nil && !opts.Quiet {
+		printEstimate(stats, cal, opts.Workers)
+	}
+
+	if first := m.firstErr.Load(); first != nil {
+		return result, first
+	}
+	if err := parent.Err(); err != nil {
+		return result, err
+	}
+	if result.Errors > 0 {
+		return result, &RunError{Errors: result.Errors, Failures: failures, TooMany: m.tooMany.Load(), Stalled: m.stalled.Load()}
+	}
+
+	return result, nil
+}
+
+// worker processes jobs until the queue is closed. Once ctx is cancelled,
+// queued jobs are drained without being processed and no new jobs are
+// queued; an operation already in progress is allowed to finish.
+func (m *mover) worker(ctx context.Context, id int, jobs *jobQueue, jobsWg *sync.WaitGroup) {
+	for {
+		job, ok := jobs.pop()
+		if !ok {
+			return
+		}
+		m.tracker.start(id, job)
+		if ctx.Err() != nil {
+			m.tracker.finish(id)
+			jobsWg.Done()
+			continue
+		}
+
+		newJobs := m.processPath(job)
+		m.tracker.finish(id)
+		if ctx.Err() != nil {
+			newJobs = nil
+		}
+
+		done := m.dirs.finish(job, len(newJobs))
+		// Work cut short by cancellation counts as unfinished
+		if ctx.Err() == nil {
+			m.checkpoint.complete(done.completed)
+		}
+		for _, dir := range done.pruned {
+			atomic.AddInt64(&m.stats.DirsPruned, 1)
+			m.logOp(opEvent{Op: "pruned", Source: dir}, "Removed empty directory: %s\n", dir)
+		}
+		for _, dir := range done.synced {
+			atomic.AddInt64(&m.stats.DirModesSynced, 1)
+			m.logOp(opEvent{Op: "chmod", Source: dir.SourcePath, Target: dir.TargetPath}, "Set mode of directory: %s\n", dir.TargetPath)
+		}
+		for _, e := range done.errs {
+			switch e.Op {
+			case "prune":
+				m.recordError(e, "Cannot remove empty directory %s: %v", e.SourcePath)
+			case "chmod":
+				m.recordError(e, "Cannot set mode of %s: %v", e.TargetPath)
+			default:
+				m.recordError(e, "Cannot restore times of %s: %v", e.TargetPath)
+			}
+		}
+
+		m.queue(jobs, jobsWg, newJobs)
+		jobsWg.Done()
+	}
+}
+
+// queue adds newJobs to the queue and the jobs to wait for
+func (m *mover) queue(jobs *jobQueue, jobsWg *sync.WaitGroup, newJobs []Job) {
+	jobsWg.Add(len(newJobs))
+	for _, newJob := range newJobs {
+		m.tracker.queue(newJob)
+	}
+	jobs.push(newJobs...)
+}
+
+func (m *mover) processPath(job Job) []Job {
+	sourcePath, targetPath := job.SourcePath, job.TargetPath
+	if sourcePath == targetPath {
+		return nil
+	}
+	if m.resumed(sourcePath) {
+		return nil
+	}
+
+	sourceInfo, err := os.Lstat(sourcePath)
+	if err != nil {
+		m.recordError(MoveError{Op: "stat", SourcePath: sourcePath, Err: err}, "Cannot stat %s: %v", sourcePath)
+		return nil
+	}
+
+	atomic.AddInt64(&m.stats.EntriesScanned, 1)
+
+	if m.opts.TargetNameTransform != nil && !sourceInfo.IsDir() {
+		targetPath, err = m.transformTarget(job.SourceRoot, sourcePath, targetPath)
+		if err != nil {
+			m.progress.fileDone(sourceInfo.Size())
+			m.recordError(MoveError{Op: "move", SourcePath: sourcePath, Err: err}, "Cannot rename %s: %v", sourcePath)
+			return nil
+		}
+		job.TargetPath = targetPath
+	}
+
+	if (m.opts.Flatten || m.opts.TargetNameTransform != nil) && !sourceInfo.IsDir() {
+		// Another file of the same name may land between the stat and the move
+		unlock := m.lockTarget(targetPath)
+		defer unlock()
+	}
+
+	var targetInfo os.FileInfo
+	if !job.targetMissing {
+		targetInfo, err = m.lstatTarget(targetPath)
+		if err != nil {
+			if m.opts.DryRun && !errors.Is(err, os.ErrNotExist) {
+				// A real run would fail creating the target, e.g. below a file
+				m.recordError(MoveError{Op: "stat", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Cannot stat target of %s: %v", sourcePath)
+				return nil
+			}
+			targetInfo = nil
+		}
+	}
+	targetExists := targetInfo != nil
+
+	// Merging through a target symlink that leads back into the source would
+	// move entries into directories still being traversed
+	if sourceInfo.IsDir() && targetExists && targetInfo.Mode()&os.ModeSymlink != 0 && resolvesInto(targetPath, job.SourceRoot) {
+		m.recordError(MoveError{Op: "move", SourcePath: sourcePath, TargetPath: targetPath, Err: errTargetInSource}, "Refusing to merge %s: %v", sourcePath)
+		return nil
+	}
+
+	// The source root itself is never filtered, only what it contains
+	descend := false
+	if m.opts.Filter != nil && sourcePath != job.SourceRoot {
+		switch m.opts.Filter(sourcePath, sourceInfo) {
+		case FilterSkip, FilterPrune:
+			m.skipFiltered(sourcePath, sourceInfo, "filter")
+			return nil
+		case FilterRecurse:
+			descend = true
+		}
+	}
+	if sourcePath != job.SourceRoot && m.excluded(sourcePath) {
+		m.skipFiltered(sourcePath, sourceInfo, "excluded")
+		return nil
+	}
+	if job.ignore.ignored(sourcePath, sourceInfo.IsDir()) {
+		m.skipFiltered(sourcePath, sourceInfo, "ignored")
+		return nil
+	}
+	if job.caseTwin != "" {
+		m.caseCollision(job, sourceInfo)
+		return nil
+	}
+
+	if sourceInfo.Mode()&os.ModeSymlink != 0 {
+		if m.opts.FollowSymlinks && m.followSymlink(job, targetExists) {
+			return nil
+		}
+		if m.opts.MoveSymlinks || m.opts.RewriteSymlinks {
+			m.processSymlink(job, targetExists)
+			return nil
+		}
+
+		atomic.AddInt64(&m.stats.SymlinksSkipped, 1)
+		m.skip(SkipSymlink, opEvent{Source: sourcePath}, "Skipping symlink: %s\n", sourcePath)
+		return nil
+	}
+
+	if sourceInfo.IsDir() {
+		if targetExists && m.targetNotDir(targetPath, targetInfo) {
+			if !m.dirOntoNonDir(sourcePath, targetPath) {
+				return nil
+			}
+			targetInfo = nil
+		}
+		return m.processDir(job, sourceInfo, targetInfo, descend)
+	}
+
+	m.processFile(sourcePath, targetPath, sourceInfo, targetInfo)
+	return nil
+}
+
+// jobDepth is how many levels below its source root the job's path is
+func jobDepth(job Job) int {
+	rel, err := filepath.Rel(job.SourceRoot, job.SourcePath)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// skipFiltered leaves an excluded or ignored entry, with its whole subtree
+// for a directory, in the source
+func (m *mover) skipFiltered(sourcePath string, sourceInfo os.FileInfo, reason string) {
+	if sourceInfo.IsDir() {
+		atomic.AddInt64(&m.stats.DirsFiltered, 1)
+		m.progress.treeDone(sourcePath)
+	} else {
+		atomic.AddInt64(&m.stats.FilesFiltered, 1)
+		m.progress.fileDone(sourceInfo.Size())
+	}
+	m.skip(SkipFiltered, opEvent{Source: sourcePath, Reason: reason}, "Skipping %s path: %s\n", reason, sourcePath)
+}
+
+// processDir moves, merges or recreates a directory and returns the jobs
+// for its entries. targetInfo is nil when nothing exists at the target.
+func (m *mover) processDir(job Job, sourceInfo, targetInfo os.FileInfo, descend bool) []Job {
+	sourcePath, targetPath := job.SourcePath, job.TargetPath
+	targetExists := targetInfo != nil
+	atomic.AddInt64(&m.stats.DirsChecked, 1)
+
+	// Merging would descend past MaxDepth, so the directory is a conflict
+	if targetExists && m.opts.MaxDepth > 0 && jobDepth(job) >= m.opts.MaxDepth {
+		atomic.AddInt64(&m.stats.DirConflicts, 1)
+		m.progress.treeDone(sourcePath)
+		m.skip(SkipMaxDepth, opEvent{Source: sourcePath, Target: targetPath}, "Skipping existing directory at max depth: %s\n", targetPath)
+		return nil
+	}
+
+	// Load the directory's own ignore file first, since any rule in effect
+	// means the directory can't be moved as a whole
+	rules := m.loadIgnore(job.ignore, sourcePath)
+
+	created := false
+	if !targetExists && (descend || m.filtering() || rules.active() || m.opts.Flatten || m.opts.TargetNameTransform != nil || m.opts.KeepTree) {
+		// Only some files may be moved, or the source directory must stay,
+		// so recreate the directory and descend. When flattening, only a
+		// missing target root gets here
+		if !m.opts.DryRun {
+			err := m.createDir(sourcePath, targetPath, sourceInfo)
+			if err != nil && !errors.Is(err, os.ErrExist) {
+				m.recordError(MoveError{Op: "mkdir", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Failed to create directory %s: %v", targetPath)
+				return nil
+			}
+			created = err == nil
+		} else {
+			created = true
+		}
+		atomic.AddInt64(&m.stats.DirsCreated, 1)
+	} else if !targetExists {
+		var size int64
+		if m.opts.CountDirBytes {
+			size = treeSize(sourcePath)
+		}
+		m.logOp(opEvent{Op: "moved", Source: sourcePath, Target: targetPath, Size: size}, "Moving directory: %s -> %s\n", sourcePath, targetPath)
+
+		if m.opts.DryRun {
+			atomic.AddInt64(&m.stats.DirsRenamed, 1)
+			atomic.AddInt64(&m.stats.BytesMoved, size)
+			m.progress.treeDone(sourcePath)
+			return nil
+		}
+
+		err := m.timed("rename", sourcePath, targetPath, func() error {
+			return m.retry(sourcePath, targetPath, func() error {
+				if err := m.injectFault(sourcePath); err != nil {
+					return err
+				}
+				return m.rename(sourcePath, targetPath)
+			})
+		})
+		if err == nil {
+			atomic.AddInt64(&m.stats.DirsRenamed, 1)
+			atomic.AddInt64(&m.stats.BytesMoved, size)
+			m.progress.treeDone(sourcePath)
+			m.recordMove(ManifestEntry{Source: sourcePath, Target: targetPath, Type: ManifestDir, Size: size})
+			return nil
+		}
+		switch {
+		case errors.Is(err, os.ErrExist):
+			// The target appeared since we checked, so merge into it instead
+			m.logOp(opEvent{Op: "merged", Source: sourcePath, Target: targetPath, Reason: "appeared at target"}, "Directory appeared at target, merging: %s\n", targetPath)
+			atomic.AddInt64(&m.stats.DirsMerged, 1)
+		case isCrossDevice(err) && m.opts.AllowCrossDevice:
+			// Recreate the directory and move its entries one by one
+			m.logOp(opEvent{Op: "merged", Source: sourcePath, Target: targetPath, Reason: "cross-device"}, "Cross-device directory, copying contents: %s\n", sourcePath)
+			if err := m.createDir(sourcePath, targetPath, sourceInfo); err != nil {
+				m.recordError(MoveError{Op: "mkdir", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Failed to create directory %s: %v", targetPath)
+				return nil
+			}
+			created = true
+			atomic.AddInt64(&m.stats.DirsCreated, 1)
+			m.dirs.track(sourcePath, targetPath, sourceInfo, dirRestoreTimes)
+		default:
+			m.recordError(MoveError{Op: "move", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Failed to move directory %s: %v", sourcePath)
+			m.progress.treeDone(sourcePath)
+			return nil
+		}
+	}
+
+	if targetExists && !m.opts.Flatten {
+		m.logOp(opEvent{Op: "merged", Source: sourcePath, Target: targetPath, Reason: "exists"}, "Merging into existing directory: %s\n", targetPath)
+		atomic.AddInt64(&m.stats.DirsMerged, 1)
+	}
+	var work dirWork
+	if m.opts.PruneEmpty && !m.opts.DryRun && sourcePath != job.SourceRoot {
+		work |= dirPrune
+	}
+	if targetExists && !m.opts.Flatten && m.opts.SyncDirPerms && m.syncDirMode(sourcePath, targetPath, sourceInfo, targetInfo) {
+		work |= dirSyncMode
+	}
+	// The checkpoint needs to learn when every subtree is done
+	if work != 0 || m.checkpoint != nil {
+		m.dirs.track(sourcePath, targetPath, sourceInfo, work)
+	}
+
+	dir, err := os.Open(sourcePath)
+	if err != nil {
+		m.unreadableDir(sourcePath, err)
+		return nil
+	}
+	defer dir.Close()
+	entries, err := dir.ReadDir(dirChunk)
+	if err != nil && err != io.EOF {
+		m.unreadableDir(sourcePath, err)
+		return nil
+	}
+
+	// A large directory is queued chunk by chunk while it is read, so
+	// workers get going before the listing is complete. Case twins and
+	// atomic moves need to see every entry at once.
+	if len(entries) == dirChunk && m.spawn != nil && !m.foldCase[job.TargetRoot] && !m.opts.AtomicDirs {
+		mark := m.missingTargets(job, created, dirChunk)
+		for {
+			newJobs := m.childJobs(job, rules, entries)
+			if mark != nil {
+				mark(newJobs)
+			}
+			entries, err = dir.ReadDir(dirChunk)
+			if len(entries) == 0 {
+				if err != io.EOF {
+					m.unreadableDir(sourcePath, err)
+				}
+				return newJobs
+			}
+			m.spawn(job, newJobs)
+		}
+	}
+
+	rest, err := dir.ReadDir(-1)
+	if err != nil {
+		m.unreadableDir(sourcePath, err)
+		return nil
+	}
+	newJobs := m.childJobs(job, rules, append(entries, rest...))
+
+	if m.foldCase[job.TargetRoot] {
+		markCaseTwins(newJobs, m.opts.CaseCollisions)
+	}
+	if mark := m.missingTargets(job, created, len(newJobs)); mark != nil {
+		mark(newJobs)
+	}
+
+	if m.opts.AtomicDirs {
+		return m.processFilesAtomically(sourcePath, newJobs)
+	}
+
+	return newJobs
+}
+
+// childJobs returns the jobs for a directory's entries, sorted by name
+func (m *mover) childJobs(job Job, rules *ignoreRules, entries []os.DirEntry) []Job {
+	slices.SortFunc(entries, func(a, b os.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	newJobs := make([]Job, 0, len(entries))
+	for _, entry := range entries {
+		// Ignore files describe the source tree, so they stay with it
+		if !m.opts.NoIgnore && entry.Name() == ignoreFileName {
+			continue
+		}
+
+		childTarget := filepath.Join(job.TargetPath, entry.Name())
+		if m.opts.Flatten {
+			childTarget = flatTarget(job, entry)
+		}
+		newJobs = append(newJobs, Job{
+			SourcePath: filepath.Join(job.SourcePath, entry.Name()),
+			TargetPath: childTarget,
+			SourceRoot: job.SourceRoot,
+			TargetRoot: job.TargetRoot,
+			ignore:     rules,
+		})
+	}
+	return newJobs
+}
+
+// processFile moves a single file unless it must be skipped. It returns
+// where the file was moved, which differs from targetPath when it was
+// renamed on conflict, or "" if it wasn't moved, and the error of a failed
+// move, which has already been recorded in the statistics. targetInfo is nil
+// when nothing exists at targetPath.
+func (m *mover) processFile(sourcePath, targetPath string, sourceInfo, targetInfo os.FileInfo) (string, error) {
+	return m.processFileWith(m.recordMove, sourcePath, targetPath, sourceInfo, targetInfo)
+}
+
+// processFileWith is processFile handing a completed move to record
+// instead of recording it
+func (m *mover) processFileWith(record func(ManifestEntry), sourcePath, targetPath string, sourceInfo, targetInfo os.FileInfo) (string, error) {
+	atomic.AddInt64(&m.stats.FilesChecked, 1)
+	m.progress.fileDone(sourceInfo.Size())
+
+	if reason := m.filterFile(sourcePath, sourceInfo); reason != "" {
+		atomic.AddInt64(&m.stats.FilesFiltered, 1)
+		m.skip(SkipFiltered, opEvent{Source: sourcePath, Reason: reason}, "Skipping file (%s): %s\n", reason, sourcePath)
+		return "", nil
+	}
+	// Special files have no contents to compare or hash, and their size
+	// means something else if anything
+	special := isSpecial(sourceInfo.Mode())
+	size := sourceInfo.Size()
+	if special {
+		if m.opts.SkipSpecial {
+			m.skip(SkipSpecial, opEvent{Source: sourcePath}, "Skipping special file: %s\n", sourcePath)
+			return "", nil
+		}
+		size = 0
+	}
+	if targetInfo != nil {
+		m.noteConflict(sourcePath, targetPath, sourceInfo, targetInfo)
+	}
+
+	if targetInfo != nil && m.opts.DeleteIdentical && !special && targetInfo.Mode().IsRegular() {
+		identical, err := sameContents(sourcePath, targetPath, sourceInfo, targetInfo)
+		if err != nil {
+			m.recordError(MoveError{Op: "compare", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Cannot compare %s with its target: %v", sourcePath)
+			return "", err
+		}
+		if identical {
+			m.dedupFile(sourcePath, targetPath)
+			return "", nil
+		}
+	}
+
+	replace, renamed, clearDir := false, false, false
+	if targetInfo != nil && targetInfo.IsDir() {
+		atomic.AddInt64(&m.stats.TypeMismatches, 1)
+	}
+	if targetInfo != nil && targetInfo.IsDir() && m.opts.ReplaceMismatched {
+		clearDir = true
+	} else if targetInfo != nil && m.opts.ConflictRename {
+		targetPath, renamed = m.conflictName(targetPath), true
+	} else if targetInfo != nil && targetInfo.IsDir() {
+		atomic.AddInt64(&m.stats.FilesSkipped, 1)
+		m.skip(SkipExists, opEvent{Source: sourcePath, Target: targetPath, Reason: "target is a directory"}, "Skipping file, target is a directory: %s\n", targetPath)
+		return "", nil
+	} else if targetInfo != nil {
+		if !(m.opts.Overwrite || m.opts.OverwriteNewer) {
+			atomic.AddInt64(&m.stats.FilesSkipped, 1)
+			m.skip(SkipExists, opEvent{Source: sourcePath, Target: targetPath, Diff: m.skipDiff(sourceInfo, targetInfo)}, "Skipping existing file: %s\n", targetPath)
+			return "", nil
+		}
+
+		// ModTime carries the full timestamp precision the filesystem stores
+		if !m.opts.Overwrite && !sourceInfo.ModTime().After(targetInfo.ModTime()) {
+			atomic.AddInt64(&m.stats.FilesSkipped, 1)
+			m.skip(SkipNotOlder, opEvent{Source: sourcePath, Target: targetPath, Diff: m.skipDiff(sourceInfo, targetInfo)}, "Skipping file, target is not older: %s\n", targetPath)
+			return "", nil
+		}
+		replace = true
+	}
+
+	if m.index != nil && !special {
+		found, err := m.index.contains(sourcePath, sourceInfo)
+		if err != nil {
+			m.recordError(MoveError{Op: "index", SourcePath: sourcePath, Err: err}, "Cannot check %s against target index: %v", sourcePath)
+			return "", err
+		}
+		if found {
+			atomic.AddInt64(&m.stats.FilesSkipped, 1)
+			m.skip(SkipInTarget, opEvent{Source: sourcePath}, "Skipping file already in target: %s\n", sourcePath)
+			return "", nil
+		}
+	}
+
+	if m.denylist != nil && !special {
+		denied, err := m.denylist.match(sourcePath, sourceInfo)
+		if err != nil {
+			m.recordError(MoveError{Op: "denylist", SourcePath: sourcePath, Err: err}, "Cannot check %s against hash denylist: %v", sourcePath)
+			return "", err
+		}
+		if denied {
+			m.denyFile(sourcePath)
+			return "", nil
+		}
+	}
+
+	if clearDir {
+		if err := m.removeMismatched(sourcePath, targetPath); err != nil {
+			return "", err
+		}
+	}
+	if replace {
+		m.logOp(opEvent{Op: "overwritten", Source: sourcePath, Target: targetPath, Size: size}, "Overwriting file: %s -> %s\n", sourcePath, targetPath)
+	} else if renamed {
+		m.logOp(opEvent{Op: "renamed", Source: sourcePath, Target: targetPath, Reason: "exists", Size: size}, "Target exists, moving file under a new name: %s -> %s\n", sourcePath, targetPath)
+	} else {
+		m.logOp(opEvent{Op: "moved", Source: sourcePath, Target: targetPath, Size: size}, "Moving file: %s -> %s\n", sourcePath, targetPath)
+	}
+
+	if !m.opts.DryRun {
+		if err := m.moveFile(sourcePath, targetPath, sourceInfo, replace); err != nil {
+			if !replace && errors.Is(err, os.ErrExist) {
+				// Another writer created the target after our existence check
+				atomic.AddInt64(&m.stats.FilesSkipped, 1)
+				m.skip(SkipExists, opEvent{Source: sourcePath, Target: targetPath}, "Skipping existing file: %s\n", targetPath)
+				return "", nil
+			}
+			m.recordError(MoveError{Op: "move", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Failed to move file %s: %v", sourcePath)
+			return "", err
+		}
+	}
+
+	if replace {
+		atomic.AddInt64(&m.stats.FilesOverwritten, 1)
+	} else {
+		atomic.AddInt64(&m.stats.FilesMoved, 1)
+	}
+	if renamed {
+		atomic.AddInt64(&m.stats.FilesRenamed, 1)
+	}
+	if special {
+		atomic.AddInt64(&m.stats.SpecialFilesMoved, 1)
+	}
+	atomic.AddInt64(&m.stats.BytesMoved, size)
+	if !m.opts.DryRun {
+		record(ManifestEntry{Source: sourcePath, Target: targetPath, Type: ManifestFile, Size: size, Replaced: replace})
+	}
+	return targetPath, nil
+}
+
+// moveFile renames a file, falling back to copy and delete across
+// filesystems when allowed. With replace set, an existing target file is
+// replaced; otherwise the rename may fail with an error matching os.ErrExist.
+func (m *mover) moveFile(sourcePath, targetPath string, sourceInfo os.FileInfo, replace bool) error {
+	err := m.timed("rename", sourcePath, targetPath, func() error {
+		return m.retry(sourcePath, targetPath, func() error {
+			if err := m.injectFault(sourcePath); err != nil {
+				return err
+			}
+			if replace {
+				return os.Rename(sourcePath, targetPath)
+			}
+			return m.rename(sourcePath, targetPath)
+		})
+	})
+	if err == nil || !isCrossDevice(err) || !m.opts.AllowCrossDevice {
+		return err
+	}
+
+	if replace {
+		if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if m.links != nil && !isSpecial(sourceInfo.Mode()) {
+		handled, err := m.copyHardLink(sourcePath, targetPath, sourceInfo, func() error {
+			return m.copyAcross(sourcePath, targetPath, sourceInfo)
+		})
+		if handled {
+			return err
+		}
+	}
+	return m.copyAcross(sourcePath, targetPath, sourceInfo)
+}
+
+// copyAcross moves a file to another filesystem by copying it
+func (m *mover) copyAcross(sourcePath, targetPath string, sourceInfo os.FileInfo) error {
+	m.logOp(opEvent{Op: "copied", Source: sourcePath, Target: targetPath, Reason: "cross-device"}, "Cross-device file, copying: %s -> %s\n", sourcePath, targetPath)
+	// A failed copy leaves the source in place and no target, so it can be
+	// repeated as a whole
+	special := isSpecial(sourceInfo.Mode())
+	err := m.timed("copy", sourcePath, targetPath, func() error {
+		return m.retry(sourcePath, targetPath, func() error {
+			if special {
+				return m.copySpecial(sourcePath, targetPath, sourceInfo)
+			}
+			return m.copyFile(sourcePath, targetPath, sourceInfo)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.stats.FilesCopied, 1)
+	if m.opts.Verify && !special {
+		atomic.AddInt64(&m.stats.BytesVerified, sourceInfo.Size())
+	}
+	return nil
+}
+
+// dedupFile removes a source file whose contents are already at the target
+func (m *mover) dedupFile(sourcePath, targetPath string) {
+	m.logOp(opEvent{Op: "deleted", Source: sourcePath, Target: targetPath, Reason: "identical"}, "Deleting file identical to target: %s\n", sourcePath)
+	if !m.opts.DryRun {
+		if err := os.Remove(sourcePath); err != nil {
+			m.recordError(MoveError{Op: "delete", SourcePath: sourcePath, Err: err}, "Failed to delete identical file %s: %v", sourcePath)
+			return
+		}
+	}
+	atomic.AddInt64(&m.stats.FilesDeduplicated, 1)
+}
+
+// denyFile skips a file whose contents are on the hash denylist, removing it
+// from the source if requested
+func (m *mover) denyFile(sourcePath string) {
+	atomic.AddInt64(&m.stats.FilesDenied, 1)
+
+	if !m.opts.DeleteDenied {
+		m.skip(SkipDenied, opEvent{Source: sourcePath}, "Skipping denied file: %s\n", sourcePath)
+		return
+	}
+
+	m.logOp(opEvent{Op: "deleted", Source: sourcePath, Reason: "denied"}, "Deleting denied file: %s\n", sourcePath)
+	if !m.opts.DryRun {
+		if err := os.Remove(sourcePath); err != nil {
+			m.recordError(MoveError{Op: "delete", SourcePath: sourcePath, Err: err}, "Failed to delete denied file %s: %v", sourcePath)
+		}
+	}
+}
+
+// DefaultStatsInterval is how often the live statistics line is printed
+const DefaultStatsInterval = time.Second
+
+// statsReporter prints statistics to w every interval until done is
+// closed. In place, as on a terminal, each line overwrites the previous one
+// and the last is blanked out on return, so what follows starts on a clean
+// line; otherwise every line is written out in full and ends in a newline.
+func statsReporter(w io.Writer, inPlace bool, stats *Statistics, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	width := 0
+	for {
+		select {
+		case <-done:
+			if width > 0 {
+				fmt.Fprintf(w, "\r%s\r", strings.Repeat(" ", width))
+			}
+			return
+		case <-ticker.C:
+			line := statsLine(stats)
+			if !inPlace {
+				fmt.Fprintln(w, line)
+				continue
+			}
+			// A shorter line must cover the rest of the previous one
+			fmt.Fprintf(w, "\r%-*s", width, line)
+			width = max(width, len(line))
+		}
+	}
+}
+
+// IsTerminal reports whether f is a terminal rather than a file or pipe
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// statsLine formats the current statistics as one line
+func statsLine(stats *Statistics) string {
+	elapsed := time.Since(stats.StartTime)
+	dirsChecked := atomic.LoadInt64(&stats.DirsChecked)
+	dirsRenamed := atomic.LoadInt64(&stats.DirsRenamed)
+	filesChecked := atomic.LoadInt64(&stats.FilesChecked)
+	filesMoved := atomic.LoadInt64(&stats.FilesMoved)
+	filesOverwritten := atomic.LoadInt64(&stats.FilesOverwritten)
+	bytesMoved := atomic.LoadInt64(&stats.BytesMoved)
+	symlinksSkipped := atomic.LoadInt64(&stats.SymlinksSkipped)
+	errors := atomic.LoadInt64(&stats.Errors)
+
+	rate := float64(bytesMoved) / elapsed.Seconds() / 1024 / 1024 // MB/s
+
+	return fmt.Sprintf("[%s] Dirs: %d/%d, Files: %d/%d, Symlinks skipped: %d, Data: %.2f GB, Rate: %.2f MB/s, %.0f files/s, %.0f dirs/s, Errors: %d",
+		formatDuration(elapsed),
+		dirsRenamed, dirsChecked,
+		filesMoved, filesChecked,
+		symlinksSkipped,
+		float64(bytesMoved)/1024/1024/1024,
+		rate,
+		perSecond(filesMoved+filesOverwritten, elapsed),
+		perSecond(dirsRenamed, elapsed),
+		errors)
+}
+
+// perSecond is the rate of n events over elapsed
+func perSecond(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// PrintStats writes the final statistics of a completed or interrupted run
+// in the text format of the command line tool, including the first failures
+// and, with opts.ResourceStats, the process's resource usage
+func (r *Result) PrintStats(w io.Writer, opts *Options) {
+	stats := &r.Statistics
+	elapsed := r.Elapsed
+	if r.Interrupted {
+		fmt.Fprintf(w, "\n\nOperation interrupted after %s\n", formatDuration(elapsed))
+	} else {
+		fmt.Fprintf(w, "\n\nOperation completed in %s\n", formatDuration(elapsed))
+	}
+	fmt.Fprintf(w, "Scanned: %d entries\n", stats.EntriesScanned)
+	fmt.Fprintf(w, "Directories: %d renamed, %d merged, %d created, %d checked\n",
+		stats.DirsRenamed, stats.DirsMerged, stats.DirsCreated, stats.DirsChecked)
+	fmt.Fprintf(w, "Files: %d moved, %d skipped, %d checked\n",
+		stats.FilesMoved, stats.FilesSkipped, stats.FilesChecked)
+	if stats.Skipped.Total() > 0 {
+		fmt.Fprintf(w, "Skipped: %s\n", stats.Skipped.String())
+	}
+	if stats.FileConflicts > 0 {
+		fmt.Fprintf(w, "Files already at target: %d\n", stats.FileConflicts)
+	}
+	if stats.FilesOverwritten > 0 {
+		fmt.Fprintf(w, "Files overwritten: %d\n", stats.FilesOverwritten)
+	}
+	if stats.SpecialFilesMoved > 0 {
+		fmt.Fprintf(w, "Special files moved (pipes, sockets, devices): %d\n", stats.SpecialFilesMoved)
+	}
+	if stats.FilesDeduplicated > 0 {
+		fmt.Fprintf(w, "Files identical to target, deleted: %d\n", stats.FilesDeduplicated)
+	}
+	if stats.FilesRenamed > 0 {
+		fmt.Fprintf(w, "Files renamed on conflict: %d\n", stats.FilesRenamed)
+	}
+
+	if stats.FilesCopied > 0 || stats.FilesLinked > 0 {
+		fmt.Fprintf(w, "Cross-device: %d files copied, %d hard links recreated\n", stats.FilesCopied, stats.FilesLinked)
+	}
+	if stats.BytesVerified > 0 {
+		fmt.Fprintf(w, "Verified: %.2f GB of copied data\n", float64(stats.BytesVerified)/1024/1024/1024)
+	}
+
+	if stats.DirsRolledBack > 0 {
+		fmt.Fprintf(w, "Rolled back: %d files in %d directories\n", stats.FilesRolledBack, stats.DirsRolledBack)
+	}
+
+	if stats.Retries > 0 {
+		fmt.Fprintf(w, "Retries: %d\n", stats.Retries)
+	}
+
+	if stats.FilesDenied > 0 {
+		fmt.Fprintf(w, "Files denied: %d\n", stats.FilesDenied)
+	}
+	if stats.DirModesSynced > 0 {
+		fmt.Fprintf(w, "Directory modes synced: %d\n", stats.DirModesSynced)
+	}
+	if stats.DirsPruned > 0 {
+		fmt.Fprintf(w, "Empty source directories removed: %d\n", stats.DirsPruned)
+	}
+	if stats.DirConflicts > 0 {
+		fmt.Fprintf(w, "Directory conflicts at max depth: %d\n", stats.DirConflicts)
+	}
+	if stats.FilesFiltered > 0 || stats.DirsFiltered > 0 {
+		fmt.Fprintf(w, "Filtered: %d files, %d directories\n", stats.FilesFiltered, stats.DirsFiltered)
+	}
+
+	if stats.SymlinksSkipped > 0 {
+		fmt.Fprintf(w, "Symlinks skipped: %d\n", stats.SymlinksSkipped)
+	}
+	if stats.SymlinksMoved > 0 {
+		fmt.Fprintf(w, "Symlinks moved: %d\n", stats.SymlinksMoved)
+	}
+	if stats.SymlinksFollowed > 0 {
+		fmt.Fprintf(w, "Symlinks followed: %d\n", stats.SymlinksFollowed)
+	}
+
+	if stats.Resumed > 0 {
+		fmt.Fprintf(w, "Skipped from checkpoint: %d\n", stats.Resumed)
+	}
+
+	if stats.SourcesDeleted > 0 {
+		if opts.DryRun {
+			fmt.Fprintf(w, "Sources to remove: %d\n", stats.SourcesDeleted)
+		} else {
+			fmt.Fprintf(w, "Sources removed: %d\n", stats.SourcesDeleted)
+		}
+	}
+
+	// Only show data stats if we have file-level data
+	if stats.BytesMoved > 0 {
+		scope := "file data only"
+		if opts.CountDirBytes {
+			scope = "including renamed directories"
+		}
+		fmt.Fprintf(w, "Total data moved: %.2f GB (%s)\n", float64(stats.BytesMoved)/1024/1024/1024, scope)
+		if elapsed.Seconds() > 0 {
+			fmt.Fprintf(w, "Average rate: %.2f MB/s\n", float64(stats.BytesMoved)/elapsed.Seconds()/1024/1024)
+		}
+	}
+	// Small files are bound by operations rather than bytes
+	if files := stats.FilesMoved + stats.FilesOverwritten; (files > 0 || stats.DirsRenamed > 0) && elapsed > 0 {
+		fmt.Fprintf(w, "Average rate: %.0f files/s, %.0f dirs/s (renamed whole)\n", perSecond(files, elapsed), perSecond(stats.DirsRenamed, elapsed))
+	}
+
+	if stats.Errors > 0 {
+		fmt.Fprintf(w, "Errors: %d\n", stats.Errors)
+		printFailures(w, r.Failures)
+	}
+	if stats.TypeMismatches > 0 {
+		if opts.ReplaceMismatched {
+			fmt.Fprintf(w, "Targets of another type replaced: %d\n", stats.TypeMismatches)
+		} else {
+			fmt.Fprintf(w, "Targets of another type, left in the source: %d\n", stats.TypeMismatches)
+		}
+	}
+	if stats.DirsInaccessible > 0 {
+		fmt.Fprintf(w, "Inaccessible directories, left in the source: %d\n", stats.DirsInaccessible)
+		printFailures(w, r.Inaccessible)
+	}
+
+	if len(r.Slowest) > 0 {
+		printSlowest(w, r.Slowest)
+	}
+	if opts.ResourceStats {
+		printResourceStats(w, elapsed)
+	}
+}
+
+// printResourceStats prints CPU time and peak memory consumed by the process
+func printResourceStats(w io.Writer, elapsed time.Duration) {
+	user, system, maxRSS, ok := resourceUsage()
+	if !ok {
+		fmt.Fprintln(w, "Resource usage: unavailable on this platform")
+		return
+	}
+
+	cpu := user + system
+	fmt.Fprintf(w, "CPU time: %s (user %s, system %s)", cpu.Round(time.Millisecond),
+		user.Round(time.Millisecond), system.Round(time.Millisecond))
+	if elapsed > 0 {
+		fmt.Fprintf(w, ", %.0f%% of wall time", float64(cpu)/float64(elapsed)*100)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Peak memory: %.2f MB\n", float64(maxRSS)/1024/1024)
+}
+
+// formatDuration formats a duration in human-readable format
+func formatDuration(d time.Duration) string {
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+
+	if h > 0 {
+		return fmt.Sprintf("%dh%02dm%02ds", h, m, s)
+	}
+	if m > 0 {
+		return fmt.Sprintf("%dm%02ds", m, s)
+	}
+	return fmt.Sprintf("%ds", s)
+}
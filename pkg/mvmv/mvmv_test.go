@@ -0,0 +1,4676 @@
+package mvmv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMvMv(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T) (src, dst string)
+		validate func(t *testing.T, src, dst string)
+	}{
+		{
+			name: "move_entire_directory_when_not_exists_in_target",
+			setup: func(t *testing.T) (string, string) {
+				src := t.TempDir()
+				dst := t.TempDir()
+
+				// Create source structure
+				createFile(t, filepath.Join(src, "dir1", "file1.txt"), "content1")
+				createFile(t, filepath.Join(src, "dir1", "subdir", "file2.txt"), "content2")
+
+				return src, dst
+			},
+			validate: func(t *testing.T, src, dst string) {
+				// Source should be empty
+				assertNotExists(t, filepath.Join(src, "dir1"))
+
+				// Destination should have the moved structure
+				assertFileContent(t, filepath.Join(dst, "dir1", "file1.txt"), "content1")
+				assertFileContent(t, filepath.Join(dst, "dir1", "subdir", "file2.txt"), "content2")
+			},
+		},
+		{
+			name: "skip_existing_files_and_move_only_new_ones",
+			setup: func(t *testing.T) (string, string) {
+				src := t.TempDir()
+				dst := t.TempDir()
+
+				// Create overlapping structure
+				createFile(t, filepath.Join(src, "dir1", "existing.txt"), "new_content")
+				createFile(t, filepath.Join(src, "dir1", "new.txt"), "new_file")
+				createFile(t, filepath.Join(dst, "dir1", "existing.txt"), "old_content")
+
+				return src, dst
+			},
+			validate: func(t *testing.T, src, dst string) {
+				// Existing file should not be overwritten
+				assertFileContent(t, filepath.Join(dst, "dir1", "existing.txt"), "old_content")
+
+				// New file should be moved
+				assertNotExists(t, filepath.Join(src, "dir1", "new.txt"))
+				assertFileContent(t, filepath.Join(dst, "dir1", "new.txt"), "new_file")
+
+				// Source existing file should remain
+				assertFileContent(t, filepath.Join(src, "dir1", "existing.txt"), "new_content")
+			},
+		},
+		{
+			name: "handle_deeply_nested_structures",
+			setup: func(t *testing.T) (string, string) {
+				src := t.TempDir()
+				dst := t.TempDir()
+
+				// Create deep structure
+				deepPath := filepath.Join(src, "a", "b", "c", "d", "e", "f")
+				createFile(t, filepath.Join(deepPath, "deep.txt"), "deep_content")
+
+				// Partial overlap
+				createFile(t, filepath.Join(dst, "a", "b", "existing.txt"), "existing")
+
+				return src, dst
+			},
+			validate: func(t *testing.T, src, dst string) {
+				// Deep structure should be moved
+				assertNotExists(t, filepath.Join(src, "a", "b", "c"))
+				assertFileContent(t, filepath.Join(dst, "a", "b", "c", "d", "e", "f", "deep.txt"), "deep_content")
+
+				// Existing file should remain
+				assertFileContent(t, filepath.Join(dst, "a", "b", "existing.txt"), "existing")
+			},
+		},
+		{
+			name: "preserve_permissions_and_timestamps",
+			setup: func(t *testing.T) (string, string) {
+				src := t.TempDir()
+				dst := t.TempDir()
+
+				file := filepath.Join(src, "perm_test.txt")
+				createFile(t, file, "content")
+				if err := os.Chmod(file, 0755); err != nil {
+					t.Fatalf("Failed to chmod %s: %v", file, err)
+				}
+
+				return src, dst
+			},
+			validate: func(t *testing.T, src, dst string) {
+				dstFile := filepath.Join(dst, "perm_test.txt")
+				info, err := os.Stat(dstFile)
+				if err != nil {
+					t.Fatalf("Failed to stat moved file: %v", err)
+				}
+
+				if info.Mode().Perm() != 0755 {
+					t.Errorf("Permissions not preserved: got %v, want %v", info.Mode().Perm(), 0755)
+				}
+			},
+		},
+		{
+			name: "handle_empty_directories",
+			setup: func(t *testing.T) (string, string) {
+				src := t.TempDir()
+				dst := t.TempDir()
+
+				// Create empty directories
+				if err := os.MkdirAll(filepath.Join(src, "empty", "nested", "dirs"), 0755); err != nil {
+					t.Fatalf("Failed to create directories: %v", err)
+				}
+
+				return src, dst
+			},
+			validate: func(t *testing.T, src, dst string) {
+				// Empty directories should be moved
+				assertNotExists(t, filepath.Join(src, "empty"))
+				assertDirExists(t, filepath.Join(dst, "empty", "nested", "dirs"))
+			},
+		},
+		{
+			name: "move_mixed_files_and_directories_at_root",
+			setup: func(t *testing.T) (string, string) {
+				src := t.TempDir()
+				dst := t.TempDir()
+
+				// Create mixed content at root level
+				createFile(t, filepath.Join(src, "file_at_root.txt"), "root_file")
+				createFile(t, filepath.Join(src, "another_file.log"), "log_content")
+				createFile(t, filepath.Join(src, "dir1", "file1.txt"), "dir1_file")
+				createFile(t, filepath.Join(src, "dir1", "data.json"), "json_data")
+				createFile(t, filepath.Join(src, "dir2", "file3.txt"), "dir2_file")
+				if err := os.MkdirAll(filepath.Join(src, "dir3", "subdir1"), 0755); err != nil {
+					t.Fatalf("Failed to create directories: %v", err)
+				}
+
+				return src, dst
+			},
+			validate: func(t *testing.T, src, dst string) {
+				// All files at root should be moved
+				assertNotExists(t, filepath.Join(src, "file_at_root.txt"))
+				assertNotExists(t, filepath.Join(src, "another_file.log"))
+				assertFileContent(t, filepath.Join(dst, "file_at_root.txt"), "root_file")
+				assertFileContent(t, filepath.Join(dst, "another_file.log"), "log_content")
+
+				// All directories should be moved
+				assertNotExists(t, filepath.Join(src, "dir1"))
+				assertNotExists(t, filepath.Join(src, "dir2"))
+				assertNotExists(t, filepath.Join(src, "dir3"))
+				assertFileContent(t, filepath.Join(dst, "dir1", "file1.txt"), "dir1_file")
+				assertFileContent(t, filepath.Join(dst, "dir1", "data.json"), "json_data")
+				assertFileContent(t, filepath.Join(dst, "dir2", "file3.txt"), "dir2_file")
+				assertDirExists(t, filepath.Join(dst, "dir3", "subdir1"))
+			},
+		},
+		{
+			name: "merge_directories_with_new_subdirs_and_files",
+			setup: func(t *testing.T) (string, string) {
+				src := t.TempDir()
+				dst := t.TempDir()
+
+				// Create initial target structure
+				createFile(t, filepath.Join(dst, "dir1", "existing.txt"), "existing_content")
+				createFile(t, filepath.Join(dst, "file_at_root.txt"), "existing_root")
+				createFile(t, filepath.Join(dst, "dir2", "old.txt"), "old_content")
+
+				// Create source with overlapping and new content
+				createFile(t, filepath.Join(src, "dir1", "existing.txt"), "new_version")
+				createFile(t, filepath.Join(src, "dir1", "newfile.txt"), "new_file")
+				createFile(t, filepath.Join(src, "dir1", "newsubdir", "nested.txt"), "nested_content")
+				createFile(t, filepath.Join(src, "dir4", "file4.txt"), "dir4_content")
+				createFile(t, filepath.Join(src, "newfile_at_root.txt"), "new_root_file")
+
+				return src, dst
+			},
+			validate: func(t *testing.T, src, dst string) {
+				// Existing files should not be overwritten
+				assertFileContent(t, filepath.Join(dst, "dir1", "existing.txt"), "existing_content")
+				assertFileContent(t, filepath.Join(dst, "file_at_root.txt"), "existing_root")
+
+				// New files and directories should be moved
+				assertNotExists(t, filepath.Join(src, "dir1", "newfile.txt"))
+				assertNotExists(t, filepath.Join(src, "dir1", "newsubdir"))
+				assertNotExists(t, filepath.Join(src, "dir4"))
+				assertNotExists(t, filepath.Join(src, "newfile_at_root.txt"))
+
+				assertFileContent(t, filepath.Join(dst, "dir1", "newfile.txt"), "new_file")
+				assertFileContent(t, filepath.Join(dst, "dir1", "newsubdir", "nested.txt"), "nested_content")
+				assertFileContent(t, filepath.Join(dst, "dir4", "file4.txt"), "dir4_content")
+				assertFileContent(t, filepath.Join(dst, "newfile_at_root.txt"), "new_root_file")
+
+				// Source versions of existing files should remain
+				assertFileContent(t, filepath.Join(src, "dir1", "existing.txt"), "new_version")
+			},
+		},
+		{
+			name: "skip_symlinks",
+			setup: func(t *testing.T) (string, string) {
+				src := t.TempDir()
+				dst := t.TempDir()
+
+				// Create a file and a symlink to it
+				createFile(t, filepath.Join(src, "original.txt"), "content")
+				if err := os.Symlink(filepath.Join(src, "original.txt"), filepath.Join(src, "link.txt")); err != nil {
+					t.Fatalf("Failed to create symlink: %v", err)
+				}
+
+				// Create a directory and a symlink to it
+				if err := os.MkdirAll(filepath.Join(src, "dir"), 0755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+				if err := os.Symlink(filepath.Join(src, "dir"), filepath.Join(src, "dirlink")); err != nil {
+					t.Fatalf("Failed to create directory symlink: %v", err)
+				}
+
+				return src, dst
+			},
+			validate: func(t *testing.T, src, dst string) {
+				// Original file should be moved
+				assertNotExists(t, filepath.Join(src, "original.txt"))
+				assertFileContent(t, filepath.Join(dst, "original.txt"), "content")
+
+				// Symlinks should remain in source
+				assertSymlinkExists(t, filepath.Join(src, "link.txt"))
+				assertSymlinkExists(t, filepath.Join(src, "dirlink"))
+
+				// Symlinks should not exist in destination
+				assertNotExists(t, filepath.Join(dst, "link.txt"))
+				assertNotExists(t, filepath.Join(dst, "dirlink"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := tt.setup(t)
+
+			_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000})
+			if err != nil {
+				t.Fatalf("mvmv failed: %v", err)
+			}
+
+			tt.validate(t, src, dst)
+		})
+	}
+}
+
+func TestMultipleSources(t *testing.T) {
+	t.Run("handle_multiple_source_directories", func(t *testing.T) {
+		src1 := t.TempDir()
+		src2 := t.TempDir()
+		dst := t.TempDir()
+
+		createFile(t, filepath.Join(src1, "from_src1.txt"), "src1_content")
+		createFile(t, filepath.Join(src2, "from_src2.txt"), "src2_content")
+		createFile(t, filepath.Join(src1, "shared", "a.txt"), "a")
+		createFile(t, filepath.Join(src2, "shared", "b.txt"), "b")
+
+		_, err := Move(context.Background(), []string{src1, src2}, dst, Options{Workers: 2, Buffer: 10000})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+
+		// Both sources should be moved
+		assertFileContent(t, filepath.Join(dst, "from_src1.txt"), "src1_content")
+		assertFileContent(t, filepath.Join(dst, "from_src2.txt"), "src2_content")
+		assertFileContent(t, filepath.Join(dst, "shared", "a.txt"), "a")
+		assertFileContent(t, filepath.Join(dst, "shared", "b.txt"), "b")
+	})
+
+	t.Run("reject_invalid_source_among_many", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		_, err := Move(context.Background(), []string{src, "/non/existent/path"}, dst, Options{Workers: 1, Buffer: 10000})
+		if err == nil {
+			t.Fatal("Expected error for non-existent source")
+		}
+	})
+}
+
+func TestParallelism(t *testing.T) {
+	t.Run("concurrent_directory_processing", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		// Create many directories to test parallelism
+		for i := 0; i < 100; i++ {
+			createFile(t, filepath.Join(src, fmt.Sprintf("dir%d", i), "file.txt"), "content")
+		}
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 8, Buffer: 10000})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+
+		// Verify all directories were moved
+		for i := 0; i < 100; i++ {
+			assertFileContent(t, filepath.Join(dst, fmt.Sprintf("dir%d", i), "file.txt"), "content")
+		}
+	})
+
+	t.Run("large_directory_parallel_processing", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		// Create a directory with many files to test parallel processing
+		largeDir := filepath.Join(src, "largedir")
+		if err := os.MkdirAll(largeDir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		// Create 2000 files
+		for i := 0; i < 2000; i++ {
+			createFile(t, filepath.Join(largeDir, fmt.Sprintf("file%04d.txt", i)), fmt.Sprintf("content%d", i))
+		}
+
+		// Also create some files that should be skipped
+		if err := os.MkdirAll(filepath.Join(dst, "largedir"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			createFile(t, filepath.Join(dst, "largedir", fmt.Sprintf("file%04d.txt", i)), "existing")
+		}
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 4, Buffer: 10000})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+
+		// Verify files were moved correctly
+		for i := 0; i < 100; i++ {
+			// First 100 should be skipped (remain as "existing")
+			assertFileContent(t, filepath.Join(dst, "largedir", fmt.Sprintf("file%04d.txt", i)), "existing")
+		}
+		for i := 100; i < 2000; i++ {
+			// Rest should be moved
+			assertFileContent(t, filepath.Join(dst, "largedir", fmt.Sprintf("file%04d.txt", i)), fmt.Sprintf("content%d", i))
+		}
+	})
+
+	t.Run("fan_out_beyond_buffer", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		// Every directory exists at the target, so each one is descended into
+		// and queues far more children than the buffer has room for. Its
+		// deepest branch does the same at every level.
+		var dirs []string
+		for i := 0; i < 50; i++ {
+			dirs = append(dirs, fmt.Sprintf("wide%02d", i))
+		}
+		deep := ""
+		for i := 0; i < 30; i++ {
+			deep = filepath.Join(deep, fmt.Sprintf("deep%02d", i))
+			dirs = append(dirs, deep)
+		}
+		for _, dir := range dirs {
+			for i := 0; i < 20; i++ {
+				createFile(t, filepath.Join(src, dir, fmt.Sprintf("file%02d.txt", i)), dir)
+			}
+			if err := os.MkdirAll(filepath.Join(dst, dir), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 1})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("mvmv failed: %v", err)
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("Move did not finish; workers are stuck queueing jobs")
+		}
+
+		for _, dir := range dirs {
+			for i := 0; i < 20; i++ {
+				assertFileContent(t, filepath.Join(dst, dir, fmt.Sprintf("file%02d.txt", i)), dir)
+			}
+		}
+	})
+
+	t.Run("wide_tree_small_buffer", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		for i := 0; i < 300; i++ {
+			dir := fmt.Sprintf("dir%03d", i)
+			for j := 0; j < 5; j++ {
+				createFile(t, filepath.Join(src, dir, fmt.Sprintf("file%d.txt", j)), dir)
+			}
+			if err := os.MkdirAll(filepath.Join(dst, dir), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 4, Buffer: 4})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("mvmv failed: %v", err)
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("Move did not finish with a buffer smaller than a directory")
+		}
+
+		for i := 0; i < 300; i++ {
+			dir := fmt.Sprintf("dir%03d", i)
+			for j := 0; j < 5; j++ {
+				assertFileContent(t, filepath.Join(dst, dir, fmt.Sprintf("file%d.txt", j)), dir)
+			}
+		}
+	})
+}
+
+func TestParseTransfer(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		arg  string
+		want Transfer
+	}{
+		{"/data/src", Transfer{Source: "/data/src", Target: "/target/src"}},
+		{"/data/src/", Transfer{Source: "/data/src", Target: "/target"}},
+		{"/data/src//", Transfer{Source: "/data/src", Target: "/target"}},
+		{"/data/src/.", Transfer{Source: "/data/src", Target: "/target"}},
+		{"src", Transfer{Source: filepath.Join(wd, "src"), Target: "/target/src"}},
+		{".", Transfer{Source: wd, Target: "/target"}},
+		{"/", Transfer{Source: "/", Target: "/target"}},
+	}
+	for _, tt := range tests {
+		if got := ParseTransfer(tt.arg, "/target"); got != tt.want {
+			t.Errorf("ParseTransfer(%q) = %+v, want %+v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestMoveAll(t *testing.T) {
+	base := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(base, "nested", "a.txt"), "a")
+	createFile(t, filepath.Join(base, "contents", "b.txt"), "b")
+	createFile(t, filepath.Join(base, "merged", "c.txt"), "c")
+	createFile(t, filepath.Join(dst, "merged", "existing.txt"), "existing")
+
+	transfers := []Transfer{
+		ParseTransfer(filepath.Join(base, "nested"), dst),
+		ParseTransfer(filepath.Join(base, "contents")+"/", dst),
+		ParseTransfer(filepath.Join(base, "merged"), dst),
+	}
+	if _, err := MoveAll(context.Background(), transfers, Options{Workers: 2}); err != nil {
+		t.Fatalf("MoveAll failed: %v", err)
+	}
+
+	// Without a trailing slash the directory itself lands in the target
+	assertFileContent(t, filepath.Join(dst, "nested", "a.txt"), "a")
+	assertNotExists(t, filepath.Join(base, "nested"))
+	// With one only its contents do, and the directory stays behind
+	assertFileContent(t, filepath.Join(dst, "b.txt"), "b")
+	assertDirExists(t, filepath.Join(base, "contents"))
+	// A directory of the same name at the target is merged into
+	assertFileContent(t, filepath.Join(dst, "merged", "c.txt"), "c")
+	assertFileContent(t, filepath.Join(dst, "merged", "existing.txt"), "existing")
+
+	// Only the parent of a missing target has to exist
+	createFile(t, filepath.Join(base, "orphan", "d.txt"), "d")
+	orphan := []Transfer{{Source: filepath.Join(base, "orphan"), Target: filepath.Join(dst, "missing", "orphan")}}
+	if _, err := MoveAll(context.Background(), orphan, Options{Workers: 1}); err == nil {
+		t.Error("Expected an error for a target without a parent")
+	}
+	if _, err := MoveAll(context.Background(), orphan, Options{Workers: 1, CreateTarget: true}); err != nil {
+		t.Fatalf("MoveAll with CreateTarget failed: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dst, "missing", "orphan", "d.txt"), "d")
+}
+
+func TestReadTransfers(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "pairs.tsv")
+	content := "# migration\n\n/data/a\t/archive/a\n/data/with space/\t/archive/b\r\nrel\t/archive/c\n"
+	if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	transfers, err := ReadTransfers(list)
+	if err != nil {
+		t.Fatalf("ReadTransfers failed: %v", err)
+	}
+	rel, _ := filepath.Abs("rel")
+	want := []Transfer{
+		{Source: "/data/a", Target: "/archive/a"},
+		{Source: "/data/with space", Target: "/archive/b"},
+		{Source: rel, Target: "/archive/c"},
+	}
+	if !slices.Equal(transfers, want) {
+		t.Errorf("ReadTransfers = %v, want %v", transfers, want)
+	}
+
+	for name, content := range map[string]string{
+		"no_tab":      "/data/a /archive/a\n",
+		"extra_field": "/data/a\t/archive/a\t/archive/b\n",
+		"empty":       "# nothing\n",
+	} {
+		if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadTransfers(list); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTargetSubdir(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a.txt"), "a")
+	createFile(t, filepath.Join(dst, "incoming", "old.txt"), "old")
+
+	target, err := TargetSubdir(dst, "incoming/2024", Options{Quiet: true})
+	if err != nil {
+		t.Fatalf("TargetSubdir failed: %v", err)
+	}
+	if want := filepath.Join(dst, "incoming", "2024"); target != want {
+		t.Errorf("TargetSubdir = %s, want %s", target, want)
+	}
+	assertDirExists(t, target)
+	if _, err := Move(context.Background(), []string{src}, target, Options{Quiet: true}); err != nil {
+		t.Fatalf("mvmv failed: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dst, "incoming", "2024", "a.txt"), "a")
+
+	// An existing subdirectory is reused
+	if _, err := TargetSubdir(dst, "incoming", Options{}); err != nil {
+		t.Errorf("TargetSubdir of an existing directory: %v", err)
+	}
+
+	var optsErr *OptionsError
+	for _, subdir := range []string{"", ".", "../escape", "/abs"} {
+		if _, err := TargetSubdir(dst, subdir, Options{}); !errors.As(err, &optsErr) {
+			t.Errorf("TargetSubdir(%q) = %v, want an OptionsError", subdir, err)
+		}
+	}
+
+	var pathErr *PathError
+	if _, err := TargetSubdir(filepath.Join(dst, "missing"), "sub", Options{}); !errors.As(err, &pathErr) {
+		t.Errorf("TargetSubdir of a missing target = %v, want a PathError", err)
+	}
+	if _, err := TargetSubdir(dst, "incoming/old.txt", Options{}); !errors.As(err, &pathErr) {
+		t.Errorf("TargetSubdir onto a file = %v, want a PathError", err)
+	}
+
+	created, err := TargetSubdir(filepath.Join(dst, "new"), "sub", Options{CreateTarget: true})
+	if err != nil {
+		t.Fatalf("TargetSubdir with CreateTarget failed: %v", err)
+	}
+	assertDirExists(t, created)
+}
+
+func TestCancellation(t *testing.T) {
+	t.Run("cancelled_before_start", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "file.txt"), "content")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := Move(ctx, []string{src}, dst, Options{})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context.Canceled, got %v", err)
+		}
+		assertFileContent(t, filepath.Join(src, "file.txt"), "content")
+		assertNotExists(t, filepath.Join(dst, "file.txt"))
+	})
+
+	t.Run("queued_jobs_abandoned", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "a.txt"), "a")
+		createFile(t, filepath.Join(src, "b.txt"), "b")
+
+		m := &mover{opts: &Options{}, stats: &Statistics{}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		jobs := newJobQueue(2)
+		var jobsWg sync.WaitGroup
+		for _, name := range []string{"a.txt", "b.txt"} {
+			jobsWg.Add(1)
+			jobs.push(Job{SourcePath: filepath.Join(src, name), TargetPath: filepath.Join(dst, name)})
+		}
+		go m.worker(ctx, 0, jobs, &jobsWg)
+		jobsWg.Wait()
+		jobs.close()
+
+		if m.stats.FilesChecked != 0 {
+			t.Errorf("Expected no files checked after cancellation, got %d", m.stats.FilesChecked)
+		}
+		assertFileContent(t, filepath.Join(src, "a.txt"), "a")
+		assertFileContent(t, filepath.Join(src, "b.txt"), "b")
+	})
+}
+
+func TestTargetInSource(t *testing.T) {
+	t.Run("refuses_overlapping_roots", func(t *testing.T) {
+		src := t.TempDir()
+		createFile(t, filepath.Join(src, "sub", "file.txt"), "content")
+		link := filepath.Join(t.TempDir(), "link")
+		if err := os.Symlink(src, link); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+
+		targets := map[string]string{
+			"same":        src,
+			"inside":      filepath.Join(src, "sub"),
+			"via_symlink": filepath.Join(link, "sub"),
+			"not_created": filepath.Join(src, "sub", "new"),
+		}
+		for name, target := range targets {
+			_, err := Move(context.Background(), []string{src}, target, Options{Workers: 1, Buffer: 10000, CreateTarget: true})
+			if err == nil {
+				t.Errorf("%s: Move into %s succeeded", name, target)
+			}
+		}
+		assertFileContent(t, filepath.Join(src, "sub", "file.txt"), "content")
+		assertNotExists(t, filepath.Join(src, "sub", "new"))
+
+		// The same directory is named as such, however it is reached
+		for _, target := range []string{src, link, filepath.Join(src, "sub", "..")} {
+			_, err := Move(context.Background(), []string{src}, target, Options{Workers: 1})
+			if err == nil || !strings.Contains(err.Error(), "is the same directory as source") {
+				t.Errorf("Move into %s = %v, want a same-directory error", target, err)
+			}
+		}
+
+		if _, err := Shard(context.Background(), src, []string{t.TempDir(), filepath.Join(src, "sub")}, Options{Workers: 1, Buffer: 10000}); err == nil {
+			t.Error("Shard into the source succeeded")
+		}
+	})
+
+	t.Run("refuses_nested_paths", func(t *testing.T) {
+		parent := t.TempDir()
+		createFile(t, filepath.Join(parent, "a", "b", "file.txt"), "content")
+
+		tests := []struct{ source, target, want string }{
+			{filepath.Join(parent, "a"), filepath.Join(parent, "a", "b"), "target"},
+			{filepath.Join(parent, "a", "b"), filepath.Join(parent, "a"), "source"},
+			{filepath.Join(parent, "a", "b"), filepath.Join(parent, "a", "..", "a"), "source"},
+		}
+		for _, tt := range tests {
+			_, err := Move(context.Background(), []string{tt.source}, tt.target, Options{Workers: 1, Buffer: 10000})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want+" ") {
+				t.Errorf("Move(%s, %s) = %v, want a %s-inside error", tt.source, tt.target, err, tt.want)
+			}
+		}
+		assertFileContent(t, filepath.Join(parent, "a", "b", "file.txt"), "content")
+	})
+
+	t.Run("refuses_target_symlink_into_source", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "a", "file.txt"), "content")
+		createFile(t, filepath.Join(src, "b", "other.txt"), "other")
+		if err := os.Symlink(filepath.Join(src, "b"), filepath.Join(dst, "a")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000})
+		if !errors.Is(err, errTargetInSource) {
+			t.Fatalf("Expected errTargetInSource, got %v", err)
+		}
+		assertFileContent(t, filepath.Join(src, "a", "file.txt"), "content")
+		assertNotExists(t, filepath.Join(src, "b", "file.txt"))
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	t.Run("dry_run_does_not_move_files", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		// Create source structure
+		createFile(t, filepath.Join(src, "file.txt"), "content")
+		createFile(t, filepath.Join(src, "dir1", "file2.txt"), "content2")
+
+		// Run in dry-run mode
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000, DryRun: true})
+		if err != nil {
+			t.Fatalf("Dry run failed: %v", err)
+		}
+
+		// Source files should still exist
+		assertFileContent(t, filepath.Join(src, "file.txt"), "content")
+		assertFileContent(t, filepath.Join(src, "dir1", "file2.txt"), "content2")
+
+		// Destination should be empty
+		assertNotExists(t, filepath.Join(dst, "file.txt"))
+		assertNotExists(t, filepath.Join(dst, "dir1"))
+	})
+}
+
+func TestManifest(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	manifestPath := filepath.Join(t.TempDir(), "manifest.jsonl")
+
+	createFile(t, filepath.Join(src, "file.txt"), "content")
+	createFile(t, filepath.Join(src, "tree", "nested.txt"), "nested")
+	createFile(t, filepath.Join(src, "merged", "old.txt"), "new")
+	createFile(t, filepath.Join(dst, "merged", "old.txt"), "old")
+	if err := os.Symlink("file.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	opts := Options{Workers: 2, Buffer: 10000, MoveSymlinks: true, Overwrite: true, ManifestPath: manifestPath}
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	entries := make(map[string]ManifestEntry)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e ManifestEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Invalid manifest line %q: %v", line, err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("Entry for %s has no time", e.Source)
+		}
+		entries[e.Source] = e
+	}
+
+	want := map[string]ManifestEntry{
+		filepath.Join(src, "file.txt"):          {Target: filepath.Join(dst, "file.txt"), Type: ManifestFile, Size: 7},
+		filepath.Join(src, "tree"):              {Target: filepath.Join(dst, "tree"), Type: ManifestDir},
+		filepath.Join(src, "merged", "old.txt"): {Target: filepath.Join(dst, "merged", "old.txt"), Type: ManifestFile, Size: 3, Replaced: true},
+		filepath.Join(src, "link"):              {Target: filepath.Join(dst, "link"), Type: ManifestSymlink},
+	}
+	if len(entries) != len(want) {
+		t.Errorf("Manifest has %d entries, want %d:\n%s", len(entries), len(want), data)
+	}
+	for source, w := range want {
+		got := entries[source]
+		if got.Target != w.Target || got.Type != w.Type || got.Size != w.Size || got.Replaced != w.Replaced {
+			t.Errorf("Entry for %s = %+v, want %+v", source, got, w)
+		}
+	}
+
+	// A dry run leaves the manifest alone
+	createFile(t, filepath.Join(src, "later.txt"), "later")
+	opts.DryRun = true
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if after, _ := os.ReadFile(manifestPath); !bytes.Equal(after, data) {
+		t.Errorf("Dry run changed the manifest:\n%s", after)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "new.txt"), "12345")
+	createFile(t, filepath.Join(src, "shared", "both.txt"), "source")
+	createFile(t, filepath.Join(src, "shared", "sub", "deep.txt"), "abc")
+	createFile(t, filepath.Join(src, "mismatch"), "file")
+	createFile(t, filepath.Join(dst, "shared", "both.txt"), "target")
+	createFile(t, filepath.Join(dst, "shared", "old.txt"), "xy")
+	createFile(t, filepath.Join(dst, "mismatch", "file.txt"), "")
+
+	result, err := Diff(context.Background(), src, dst, Options{Workers: 2})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	want := DiffResult{
+		SourceOnly:     DiffCount{Files: 2, Dirs: 1, Bytes: 8},
+		TargetOnly:     DiffCount{Files: 1, Bytes: 2},
+		Both:           DiffCount{Files: 1, Dirs: 2, Bytes: 6},
+		TypeMismatches: 1,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Diff = %+v, want %+v", result, want)
+	}
+	// Nothing was touched
+	assertFileContent(t, filepath.Join(src, "new.txt"), "12345")
+	assertNotExists(t, filepath.Join(dst, "new.txt"))
+
+	// A missing target takes the whole source
+	result, err = Diff(context.Background(), src, filepath.Join(dst, "missing"), Options{})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if want := (DiffCount{Files: 4, Dirs: 3, Bytes: 18}); result.SourceOnly != want {
+		t.Errorf("SourceOnly = %+v, want %+v", result.SourceOnly, want)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	manifestPath := filepath.Join(t.TempDir(), "manifest.jsonl")
+
+	createFile(t, filepath.Join(src, "file.txt"), "file")
+	createFile(t, filepath.Join(src, "tree", "nested.txt"), "nested")
+	createFile(t, filepath.Join(src, "merged", "a.txt"), "a")
+	createFile(t, filepath.Join(src, "merged", "b.txt"), "b")
+	createFile(t, filepath.Join(dst, "merged", "existing.txt"), "existing")
+	if err := os.Symlink("file.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	opts := Options{Workers: 2, Buffer: 10000, MoveSymlinks: true, PruneEmpty: true, ManifestPath: manifestPath}
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	assertNotExists(t, filepath.Join(src, "merged"))
+
+	// One target is gone and one original path has been taken again
+	if err := os.Remove(filepath.Join(dst, "merged", "b.txt")); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	createFile(t, filepath.Join(src, "file.txt"), "replacement")
+
+	result, err := Undo(context.Background(), manifestPath, Options{})
+	var runErr *RunError
+	if !errors.As(err, &runErr) || !errors.Is(err, errSourceOccupied) {
+		t.Fatalf("Expected a conflict error, got %v", err)
+	}
+	if result.Restored != 3 || result.Missing != 1 || result.Conflicts != 1 {
+		t.Errorf("Undo = %+v, want 3 restored, 1 missing, 1 conflict", result)
+	}
+
+	assertFileContent(t, filepath.Join(src, "tree", "nested.txt"), "nested")
+	assertFileContent(t, filepath.Join(src, "merged", "a.txt"), "a")
+	assertFileContent(t, filepath.Join(src, "file.txt"), "replacement")
+	assertFileContent(t, filepath.Join(dst, "file.txt"), "file")
+	assertFileContent(t, filepath.Join(dst, "merged", "existing.txt"), "existing")
+	if link, err := os.Readlink(filepath.Join(src, "link")); err != nil || link != "file.txt" {
+		t.Errorf("Symlink not restored: %q, %v", link, err)
+	}
+}
+
+func TestUndoReplaced(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	manifestPath := filepath.Join(t.TempDir(), "manifest.jsonl")
+
+	createFile(t, filepath.Join(src, "dir", "new.txt"), "new")
+	createFile(t, filepath.Join(src, "dir", "other.txt"), "other")
+	createFile(t, filepath.Join(dst, "dir", "new.txt"), "original")
+
+	opts := Options{Overwrite: true, ManifestPath: manifestPath, Quiet: true}
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	result, err := Undo(context.Background(), manifestPath, Options{Logger: slog.New(slog.NewTextHandler(&buf, nil))})
+	if err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if result.Restored != 2 || result.Replaced != 1 {
+		t.Errorf("Undo = %+v, want 2 restored, 1 replaced", result)
+	}
+
+	// The moved file goes back, but what it overwrote can't be restored
+	assertFileContent(t, filepath.Join(src, "dir", "new.txt"), "new")
+	assertNotExists(t, filepath.Join(dst, "dir", "new.txt"))
+	if !strings.Contains(buf.String(), "level=WARN") || !strings.Contains(buf.String(), filepath.Join(dst, "dir", "new.txt")) {
+		t.Errorf("No warning for the overwritten file, got log:\n%s", buf.String())
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.jsonl")
+
+	// A crash can cut the last line short
+	createFile(t, path, `{"source":"/s/a","target":"/t/a","type":"file"}`+"\n"+`{"source":"/s/b","tar`)
+	entries, err := readManifest(path)
+	if err != nil || len(entries) != 1 || entries[0].Source != "/s/a" {
+		t.Errorf("readManifest = %+v, %v; want the complete entry", entries, err)
+	}
+
+	createFile(t, path, `{"source":"/s/a","tar`+"\n"+`{"source":"/s/b","target":"/t/b","type":"file"}`+"\n")
+	if _, err := readManifest(path); err == nil {
+		t.Error("Expected an error for a malformed line before the last")
+	}
+}
+
+func TestDryRunPlan(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "new.txt"), "new")
+	createFile(t, filepath.Join(src, "old.txt"), "old")
+	createFile(t, filepath.Join(dst, "old.txt"), "existing")
+	createFile(t, filepath.Join(src, "blocked", "file.txt"), "blocked")
+	createFile(t, filepath.Join(dst, "blocked"), "not a directory")
+
+	var buf bytes.Buffer
+	opts := &Options{DryRun: true, Output: OutputJSON}
+	m := &mover{opts: opts, stats: &Statistics{}, out: newJSONOutput(&buf)}
+
+	pending := []Job{{SourcePath: src, TargetPath: dst, SourceRoot: src, TargetRoot: dst}}
+	for len(pending) > 0 {
+		job := pending[0]
+		pending = append(pending[1:], m.processPath(job)...)
+	}
+
+	plan := make(map[string]opEvent)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var ev opEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("Invalid event %q: %v", line, err)
+		}
+		plan[ev.Source] = ev
+	}
+
+	want := map[string]opEvent{
+		src:                           {Op: "merged", Target: dst, Reason: "exists"},
+		filepath.Join(src, "new.txt"): {Op: "moved", Target: filepath.Join(dst, "new.txt")},
+		filepath.Join(src, "old.txt"): {Op: "skipped", Target: filepath.Join(dst, "old.txt"), Reason: "exists"},
+		filepath.Join(src, "blocked"): {Op: "error", Target: filepath.Join(dst, "blocked")},
+	}
+	if len(plan) != len(want) {
+		t.Errorf("Plan has %d entries, want %d:\n%s", len(plan), len(want), buf.String())
+	}
+	for source, w := range want {
+		got, ok := plan[source]
+		if !ok {
+			t.Errorf("No plan entry for %s", source)
+			continue
+		}
+		if got.Op != w.Op || got.Target != w.Target || (w.Reason != "" && got.Reason != w.Reason) {
+			t.Errorf("Plan for %s = %+v, want %+v", source, got, w)
+		}
+	}
+
+	// Nothing was touched
+	assertFileContent(t, filepath.Join(src, "new.txt"), "new")
+	assertNotExists(t, filepath.Join(dst, "new.txt"))
+}
+
+func TestTypeMismatch(t *testing.T) {
+	setup := func(t *testing.T) (string, string) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "dir", "a.txt"), "a")
+		createFile(t, filepath.Join(dst, "dir"), "file at target")
+		createFile(t, filepath.Join(src, "file"), "file")
+		createFile(t, filepath.Join(dst, "file", "b.txt"), "directory at target")
+		return src, dst
+	}
+
+	t.Run("left_in_source", func(t *testing.T) {
+		src, dst := setup(t)
+		result, err := Move(context.Background(), []string{src}, dst, Options{Quiet: true})
+		var runErr *RunError
+		if !errors.As(err, &runErr) || len(runErr.Failures) != 1 {
+			t.Fatalf("Expected one failure, got %v", err)
+		}
+		// The directory fails as a whole, not entry by entry
+		f := runErr.Failures[0]
+		if f.SourcePath != filepath.Join(src, "dir") || !errors.Is(f.Err, syscall.ENOTDIR) {
+			t.Errorf("Unexpected failure: %+v", f)
+		}
+		if result.TypeMismatches != 2 || result.Skipped[SkipExists] != 1 {
+			t.Errorf("TypeMismatches = %d, skipped = %v; want 2 and 1 exists", result.TypeMismatches, result.Skipped.String())
+		}
+		assertFileContent(t, filepath.Join(src, "dir", "a.txt"), "a")
+		assertFileContent(t, filepath.Join(src, "file"), "file")
+		assertFileContent(t, filepath.Join(dst, "dir"), "file at target")
+		assertFileContent(t, filepath.Join(dst, "file", "b.txt"), "directory at target")
+	})
+
+	t.Run("replaced_dry_run", func(t *testing.T) {
+		src, dst := setup(t)
+		var buf bytes.Buffer
+		opts := &Options{DryRun: true, ReplaceMismatched: true, Output: OutputJSON}
+		m := &mover{opts: opts, stats: &Statistics{}, out: newJSONOutput(&buf)}
+		pending := []Job{{SourcePath: src, TargetPath: dst, SourceRoot: src, TargetRoot: dst}}
+		for len(pending) > 0 {
+			job := pending[0]
+			pending = append(pending[1:], m.processPath(job)...)
+		}
+		for _, want := range []string{`{"op":"removed","source":"` + filepath.Join(src, "dir"), `{"op":"removed","source":"` + filepath.Join(src, "file")} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("Plan lacks %s:\n%s", want, buf.String())
+			}
+		}
+		assertFileContent(t, filepath.Join(dst, "dir"), "file at target")
+		assertFileContent(t, filepath.Join(dst, "file", "b.txt"), "directory at target")
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		src, dst := setup(t)
+		result, err := Move(context.Background(), []string{src}, dst, Options{ReplaceMismatched: true, Quiet: true})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+		if result.TypeMismatches != 2 {
+			t.Errorf("TypeMismatches = %d, want 2", result.TypeMismatches)
+		}
+		assertFileContent(t, filepath.Join(dst, "dir", "a.txt"), "a")
+		assertFileContent(t, filepath.Join(dst, "file"), "file")
+		assertNotExists(t, filepath.Join(src, "file"))
+	})
+}
+
+// TestLongPaths moves entries whose paths exceed the 260 characters of
+// MAX_PATH on Windows, where the os package prefixes absolute paths with
+// \\?\ itself
+func TestLongPaths(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	deep := ""
+	for i := 0; i < 6; i++ {
+		deep = filepath.Join(deep, fmt.Sprintf("%02d-%s", i, strings.Repeat("x", 45)))
+	}
+	createFile(t, filepath.Join(src, deep, "file.txt"), "deep")
+	createFile(t, filepath.Join(src, deep, "sub", "other.txt"), "other")
+	// Merging down to the deepest directory moves the entries one by one
+	if err := os.MkdirAll(filepath.Join(dst, deep), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(filepath.Join(dst, deep, "file.txt")); n <= 260 {
+		t.Fatalf("Path of %d characters is not long enough", n)
+	}
+
+	if _, err := Move(context.Background(), []string{src}, dst, Options{Quiet: true}); err != nil {
+		t.Fatalf("mvmv failed: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dst, deep, "file.txt"), "deep")
+	assertFileContent(t, filepath.Join(dst, deep, "sub", "other.txt"), "other")
+	assertNotExists(t, filepath.Join(src, deep, "file.txt"))
+}
+
+func TestOnProgress(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a.txt"), "moved")
+	createFile(t, filepath.Join(src, "b.txt"), "skipped")
+	createFile(t, filepath.Join(dst, "b.txt"), "existing")
+	createFile(t, filepath.Join(src, "blocked", "c.txt"), "c")
+	createFile(t, filepath.Join(dst, "blocked"), "not a directory")
+
+	var mu sync.Mutex
+	events := make(map[string][]ProgressEvent)
+	opts := Options{Workers: 4, OnProgress: func(ev ProgressEvent) {
+		mu.Lock()
+		events[ev.Source] = append(events[ev.Source], ev)
+		mu.Unlock()
+	}}
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err == nil {
+		t.Fatal("Expected an error for blocked")
+	}
+
+	if got := events[filepath.Join(src, "a.txt")]; len(got) != 1 || got[0].Action != "moved" || got[0].Bytes != 5 {
+		t.Errorf("Events for a.txt = %+v, want one move of 5 bytes", got)
+	}
+	if got := events[filepath.Join(src, "b.txt")]; len(got) != 1 || got[0].Action != "skipped" || got[0].Reason != "exists" {
+		t.Errorf("Events for b.txt = %+v, want one skip", got)
+	}
+	got := events[filepath.Join(src, "blocked")]
+	if len(got) == 0 || got[len(got)-1].Action != "error" || !errors.Is(got[len(got)-1].Err, syscall.ENOTDIR) {
+		t.Errorf("Events for blocked = %+v, want them to end in an ENOTDIR error", got)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a.txt"), "a")
+	createFile(t, filepath.Join(src, "blocked", "b.txt"), "b")
+	createFile(t, filepath.Join(dst, "blocked"), "not a directory")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	opts := Options{Workers: 2, Quiet: true, DeleteSourceOnSuccess: true, Logger: logger}
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err == nil {
+		t.Fatal("Expected an error for blocked")
+	}
+
+	// The error is logged, the message about keeping the source is not
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "level=ERROR") || !strings.Contains(lines[0], filepath.Join(src, "blocked")) {
+		t.Errorf("Quiet run logged:\n%s", buf.String())
+	}
+	assertFileContent(t, filepath.Join(dst, "a.txt"), "a")
+
+	opts.Verbose = true
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err == nil {
+		t.Error("Expected an error combining quiet and verbose")
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	for _, rel := range []string{"a.txt", "a/1.txt", "a/2.txt", "b/c/3.txt", "b/4.txt", "c.txt"} {
+		createFile(t, filepath.Join(src, rel), rel)
+	}
+	createFile(t, filepath.Join(dst, "a", "existing"), "existing")
+	createFile(t, filepath.Join(dst, "b", "c", "existing"), "existing")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	opts := Options{Workers: 8, Buffer: 10000, Verbose: true, Ordered: true, Logger: logger}
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	var sources []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec struct{ Source string }
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		sources = append(sources, rec.Source)
+	}
+
+	var want []string
+	for _, rel := range []string{"", "a", "a/1.txt", "a/2.txt", "a.txt", "b", "b/4.txt", "b/c", "b/c/3.txt", "c.txt"} {
+		want = append(want, filepath.Join(src, rel))
+	}
+	if !slices.Equal(sources, want) {
+		t.Errorf("Reported sources = %v, want %v", sources, want)
+	}
+}
+
+func TestPlanLine(t *testing.T) {
+	tests := []struct {
+		ev   opEvent
+		want string
+	}{
+		{opEvent{Op: "moved", Source: "/s/a", Target: "/t/a"}, "move      /s/a -> /t/a"},
+		{opEvent{Op: "skipped", Source: "/s/a", Target: "/t/a", Reason: "exists"}, "skip      /s/a -> /t/a (exists)"},
+		{opEvent{Op: "skipped", Source: "/s/l", Reason: "symlink"}, "skip      /s/l (symlink)"},
+		{opEvent{Op: "error", Source: "/s/a", Target: "/t/a", Reason: "Failed", Error: "not a directory"}, "error     /s/a -> /t/a: not a directory"},
+	}
+	for _, tt := range tests {
+		if got := planLine(tt.ev); got != tt.want {
+			t.Errorf("planLine(%+v) = %q, want %q", tt.ev, got, tt.want)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	cal, err := calibrate(src, dst)
+	if err != nil {
+		t.Fatalf("Calibration failed: %v", err)
+	}
+	if cal.RenameCost <= 0 {
+		t.Errorf("Expected a positive rename cost, got %v", cal.RenameCost)
+	}
+
+	// Scratch files must not be left behind
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatalf("Failed to read source: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Calibration left %d entries in source", len(entries))
+	}
+
+	stats := &Statistics{FilesChecked: 1000, FilesMoved: 1000}
+	cal = &Calibration{StatCost: time.Millisecond, RenameCost: 2 * time.Millisecond}
+	if got, want := estimateDuration(stats, cal, 1), 4*time.Second; got != want {
+		t.Errorf("estimateDuration = %v, want %v", got, want)
+	}
+
+	cal.CrossDevice = true
+	cal.CopyBytesPerS = 1024
+	stats.BytesMoved = 10 * 1024
+	if got, want := estimateDuration(stats, cal, 2), 12*time.Second; got != want {
+		t.Errorf("estimateDuration with copy = %v, want %v", got, want)
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	t.Run("statistics_tracking", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		// Create test structure with known sizes
+		createFile(t, filepath.Join(src, "file1.txt"), "12345")       // 5 bytes
+		createFile(t, filepath.Join(src, "file2.txt"), "1234567890")  // 10 bytes
+		createFile(t, filepath.Join(src, "dir1", "file3.txt"), "123") // 3 bytes
+		createFile(t, filepath.Join(dst, "existing.txt"), "old")      // Should be skipped
+
+		// Create a file that will be skipped
+		createFile(t, filepath.Join(src, "existing.txt"), "new")
+
+		// Run with stats enabled
+		opts := Options{Workers: 1, Buffer: 10000, Stats: true}
+		_, err := Move(context.Background(), []string{src}, dst, opts)
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		// Verify files were moved
+		assertFileContent(t, filepath.Join(dst, "file1.txt"), "12345")
+		assertFileContent(t, filepath.Join(dst, "file2.txt"), "1234567890")
+		assertFileContent(t, filepath.Join(dst, "dir1", "file3.txt"), "123")
+
+		// Verify existing file was not overwritten
+		assertFileContent(t, filepath.Join(dst, "existing.txt"), "old")
+	})
+
+	t.Run("ticker_lines_in_file", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "stats.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		stats := &Statistics{StartTime: time.Now()}
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			statsReporter(f, false, stats, 5*time.Millisecond, done)
+			close(stopped)
+		}()
+		time.Sleep(30 * time.Millisecond)
+		close(done)
+		<-stopped
+
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := string(data)
+		if strings.Contains(out, "\r") || !strings.HasSuffix(out, "\n") {
+			t.Errorf("Expected newline-terminated lines without carriage returns, got %q", out)
+		}
+		if lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n"); len(lines) < 2 || !strings.HasPrefix(lines[1], "[") {
+			t.Errorf("Expected one statistics line per tick, got %q", out)
+		}
+	})
+
+	t.Run("ticker_line_cleared", func(t *testing.T) {
+		var buf bytes.Buffer
+		stats := &Statistics{StartTime: time.Now()}
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			statsReporter(&buf, true, stats, 5*time.Millisecond, done)
+			close(stopped)
+		}()
+		time.Sleep(30 * time.Millisecond)
+		close(done)
+		<-stopped
+
+		// The final statistics start at the beginning of a blank line
+		out := buf.String()
+		segments := strings.Split(out, "\r")
+		if strings.Contains(out, "\n") || len(segments) < 3 || segments[len(segments)-1] != "" {
+			t.Fatalf("Expected ticker lines ended by a carriage return, got %q", out)
+		}
+		last := segments[len(segments)-3]
+		if blank := segments[len(segments)-2]; len(blank) < len(last) || strings.TrimSpace(blank) != "" {
+			t.Errorf("Expected the last line %q to be blanked out, got %q", last, blank)
+		}
+	})
+}
+
+func TestErrorHandling(t *testing.T) {
+	t.Run("handle_missing_source", func(t *testing.T) {
+		src := "/non/existent/path"
+		dst := t.TempDir()
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000})
+		if err == nil {
+			t.Fatal("Expected error for non-existent source")
+		}
+	})
+
+	t.Run("handle_file_as_source", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "file.txt")
+		dst := t.TempDir()
+
+		createFile(t, src, "content")
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000})
+		if err == nil {
+			t.Fatal("Expected error for file as source")
+		}
+	})
+
+	t.Run("handle_symlink_as_source", func(t *testing.T) {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "source_link")
+		dst := t.TempDir()
+
+		// Create a directory and symlink to it
+		realDir := filepath.Join(tmp, "real_dir")
+		if err := os.Mkdir(realDir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.Symlink(realDir, src); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000})
+		if err == nil {
+			t.Fatal("Expected error for symlink as source")
+		}
+	})
+
+	t.Run("handle_missing_target", func(t *testing.T) {
+		src := t.TempDir()
+		dst := "/non/existent/target"
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000})
+		if err == nil {
+			t.Fatal("Expected error for non-existent target")
+		}
+	})
+
+	t.Run("create_missing_target", func(t *testing.T) {
+		src := t.TempDir()
+		dst := filepath.Join(t.TempDir(), "new", "target")
+
+		createFile(t, filepath.Join(src, "file.txt"), "content")
+		if err := os.Chmod(src, 0750); err != nil {
+			t.Fatalf("Failed to chmod: %v", err)
+		}
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000, CreateTarget: true})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(dst, "file.txt"), "content")
+		assertDirExists(t, src)
+	})
+
+	t.Run("create_target_keeps_file_error", func(t *testing.T) {
+		src := t.TempDir()
+		dst := filepath.Join(t.TempDir(), "file.txt")
+
+		createFile(t, dst, "content")
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000, CreateTarget: true})
+		if err == nil {
+			t.Fatal("Expected error for file as target")
+		}
+	})
+
+	t.Run("failures_reported_per_path", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		// A file where the target expects a directory makes the merge fail
+		createFile(t, filepath.Join(src, "dir", "file.txt"), "content")
+		createFile(t, filepath.Join(dst, "dir"), "not a directory")
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000})
+		var runErr *RunError
+		if !errors.As(err, &runErr) {
+			t.Fatalf("Expected *RunError, got %v", err)
+		}
+		if len(runErr.Failures) != 1 || len(result.Failures) != 1 {
+			t.Fatalf("Expected one failure, got %+v", runErr.Failures)
+		}
+
+		f := runErr.Failures[0]
+		if f.Op != "move" || f.SourcePath != filepath.Join(src, "dir") || f.TargetPath != filepath.Join(dst, "dir") {
+			t.Errorf("Unexpected failure: %+v", f)
+		}
+		if !errors.Is(err, syscall.ENOTDIR) {
+			t.Errorf("Expected errors.Is to find ENOTDIR in %v", err)
+		}
+		assertFileContent(t, filepath.Join(src, "dir", "file.txt"), "content")
+	})
+
+	t.Run("fail_fast", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		// a fails and is processed before the entries of z
+		createFile(t, filepath.Join(src, "a", "file.txt"), "content")
+		createFile(t, filepath.Join(dst, "a"), "not a directory")
+		for i := range 20 {
+			createFile(t, filepath.Join(src, "z", fmt.Sprintf("file%d.txt", i)), "content")
+		}
+		if err := os.MkdirAll(filepath.Join(dst, "z"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000, FailFast: true})
+		var moveErr *MoveError
+		if !errors.As(err, &moveErr) {
+			t.Fatalf("Expected *MoveError, got %v", err)
+		}
+		if moveErr.SourcePath != filepath.Join(src, "a") {
+			t.Errorf("Unexpected failing path: %s", moveErr.SourcePath)
+		}
+		if result.FilesMoved != 0 {
+			t.Errorf("Expected queued files to be abandoned, %d moved", result.FilesMoved)
+		}
+		assertFileContent(t, filepath.Join(src, "z", "file0.txt"), "content")
+	})
+
+	t.Run("max_errors", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		// a, b and c fail and are processed before the entries of z
+		for _, dir := range []string{"a", "b", "c"} {
+			createFile(t, filepath.Join(src, dir, "file.txt"), "content")
+			createFile(t, filepath.Join(dst, dir), "not a directory")
+		}
+		for i := range 20 {
+			createFile(t, filepath.Join(src, "z", fmt.Sprintf("file%d.txt", i)), "content")
+		}
+		if err := os.MkdirAll(filepath.Join(dst, "z"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, MaxErrors: 2})
+		var runErr *RunError
+		if !errors.As(err, &runErr) || !runErr.TooMany || !errors.Is(err, ErrTooManyErrors) {
+			t.Fatalf("Expected a RunError for too many errors, got %v", err)
+		}
+		if result.Errors != 3 || result.FilesMoved != 0 || !result.Interrupted {
+			t.Errorf("Errors = %d, FilesMoved = %d, Interrupted = %v; want 3, 0, true", result.Errors, result.FilesMoved, result.Interrupted)
+		}
+		assertFileContent(t, filepath.Join(src, "z", "file0.txt"), "content")
+
+		// Below the limit the run completes as usual
+		for _, dir := range []string{"a", "b", "c"} {
+			os.Remove(filepath.Join(dst, dir))
+			createFile(t, filepath.Join(dst, dir), "not a directory")
+		}
+		_, err = Move(context.Background(), []string{src}, dst, Options{Workers: 1, MaxErrors: 3})
+		if !errors.As(err, &runErr) || runErr.TooMany {
+			t.Fatalf("Expected a completed run with errors, got %v", err)
+		}
+		assertFileContent(t, filepath.Join(dst, "z", "file0.txt"), "content")
+	})
+
+	t.Run("max_error_percent", func(t *testing.T) {
+		m := &mover{opts: &Options{MaxErrorPercent: 10}, stats: &Statistics{}}
+		m.stats.EntriesScanned = MinErrorSample - 1
+		if m.tooManyErrors(50) {
+			t.Error("Error percentage applied before MinErrorSample entries were scanned")
+		}
+		m.stats.EntriesScanned = 200
+		if m.tooManyErrors(20) || !m.tooManyErrors(21) {
+			t.Error("Expected more than 10% of 200 entries, 21 errors, to be too many")
+		}
+	})
+
+	t.Run("handle_file_as_target", func(t *testing.T) {
+		src := t.TempDir()
+		dst := filepath.Join(t.TempDir(), "file.txt")
+
+		createFile(t, dst, "content")
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Buffer: 10000})
+		if err == nil {
+			t.Fatal("Expected error for file as target")
+		}
+	})
+}
+
+func TestInaccessible(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		policy       string
+		errors       int64
+		inaccessible int
+		stopsTheRun  bool
+	}{
+		{InaccessibleError, 1, 0, false},
+		{InaccessibleFail, 1, 0, true},
+		{InaccessibleReport, 0, 1, false},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			stopped := false
+			m := &mover{opts: &Options{Inaccessible: tt.policy}, stats: &Statistics{}, cancel: func() { stopped = true }}
+			m.unreadableDir(dir, os.ErrPermission)
+
+			if m.stats.Errors != tt.errors || len(m.inaccessible.list()) != tt.inaccessible || stopped != tt.stopsTheRun {
+				t.Errorf("Errors = %d, inaccessible = %d, stopped = %v; want %d, %d, %v",
+					m.stats.Errors, len(m.inaccessible.list()), stopped, tt.errors, tt.inaccessible, tt.stopsTheRun)
+			}
+		})
+	}
+
+	t.Run("report_run", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root can read any directory")
+		}
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "locked", "secret.txt"), "secret")
+		createFile(t, filepath.Join(src, "open", "a.txt"), "a")
+		createFile(t, filepath.Join(dst, "locked", "other.txt"), "other")
+		if err := os.Chmod(filepath.Join(src, "locked"), 0); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(filepath.Join(src, "locked"), 0755)
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Inaccessible: InaccessibleReport})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+		assertFileContent(t, filepath.Join(dst, "open", "a.txt"), "a")
+		if len(result.Inaccessible) != 1 || result.Inaccessible[0].SourcePath != filepath.Join(src, "locked") || result.DirsInaccessible != 1 {
+			t.Errorf("Inaccessible = %v, want the locked directory", result.Inaccessible)
+		}
+		if !errors.Is(result.Inaccessible[0].Err, os.ErrPermission) {
+			t.Errorf("Inaccessible error = %v, want permission denied", result.Inaccessible[0].Err)
+		}
+	})
+}
+
+func TestVerboseOutput(t *testing.T) {
+	t.Run("verbose_mode_shows_operations", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		createFile(t, filepath.Join(src, "file.txt"), "content")
+		createFile(t, filepath.Join(src, "dir1", "file2.txt"), "content2")
+
+		// Capture verbose output
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, Verbose: true})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		// Verify files were moved
+		assertFileContent(t, filepath.Join(dst, "file.txt"), "content")
+		assertFileContent(t, filepath.Join(dst, "dir1", "file2.txt"), "content2")
+	})
+}
+
+func TestJSONOutput(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "new.txt"), "new")
+	createFile(t, filepath.Join(src, "old.txt"), "old")
+	createFile(t, filepath.Join(dst, "old.txt"), "existing")
+
+	var buf bytes.Buffer
+	opts := &Options{Verbose: true, Output: OutputJSON}
+	stats := &Statistics{StartTime: time.Now()}
+	m := &mover{opts: opts, stats: stats, out: newJSONOutput(&buf)}
+
+	for _, name := range []string{"new.txt", "old.txt"} {
+		sourcePath, targetPath := filepath.Join(src, name), filepath.Join(dst, name)
+		targetInfo, _ := os.Lstat(targetPath)
+		m.processFile(sourcePath, targetPath, statFile(t, sourcePath), targetInfo)
+	}
+	m.recordError(MoveError{Op: "move", SourcePath: "/src/locked", TargetPath: "/dst/locked", Err: os.ErrPermission}, "Failed to move file %s: %v", "/src/locked")
+	m.out.report(&Result{Statistics: *stats}, opts, 0)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 3 events and a report, got %d lines:\n%s", len(lines), buf.String())
+	}
+
+	var ops []string
+	for _, line := range lines[:3] {
+		var ev opEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("Invalid event %q: %v", line, err)
+		}
+		ops = append(ops, ev.Op)
+	}
+	if want := []string{"moved", "skipped", "error"}; !slices.Equal(ops, want) {
+		t.Errorf("Events = %v, want %v", ops, want)
+	}
+
+	var report struct {
+		Statistics struct {
+			FilesMoved   int64 `json:"files_moved"`
+			FilesSkipped int64 `json:"files_skipped"`
+			Errors       int64 `json:"errors"`
+		} `json:"statistics"`
+		DurationSeconds *float64      `json:"duration_seconds"`
+		Errors          []errorRecord `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(lines[3]), &report); err != nil {
+		t.Fatalf("Invalid report %q: %v", lines[3], err)
+	}
+	if report.Statistics.FilesMoved != 1 || report.Statistics.FilesSkipped != 1 || report.Statistics.Errors != 1 {
+		t.Errorf("Unexpected statistics in report: %+v", report.Statistics)
+	}
+	if report.DurationSeconds == nil {
+		t.Error("Report is missing duration_seconds")
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Path != "/src/locked" {
+		t.Errorf("Unexpected errors in report: %+v", report.Errors)
+	}
+}
+
+func TestRewriteSymlinks(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	outside := t.TempDir()
+
+	createFile(t, filepath.Join(src, "file.txt"), "content")
+	createFile(t, filepath.Join(outside, "external.txt"), "external")
+	createFile(t, filepath.Join(dst, "sub", "existing.txt"), "existing")
+
+	links := map[string]string{
+		filepath.Join(src, "abs"):        filepath.Join(src, "file.txt"),
+		filepath.Join(src, "sub", "rel"): filepath.Join("..", "file.txt"),
+		filepath.Join(src, "ext"):        filepath.Join(outside, "external.txt"),
+	}
+	for link, target := range links {
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, RewriteSymlinks: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertLink(t, filepath.Join(dst, "abs"), filepath.Join(dst, "file.txt"))
+	assertLink(t, filepath.Join(dst, "sub", "rel"), filepath.Join("..", "file.txt"))
+	assertLink(t, filepath.Join(dst, "ext"), filepath.Join(outside, "external.txt"))
+	assertNotExists(t, filepath.Join(src, "abs"))
+	assertFileContent(t, filepath.Join(dst, "abs"), "content")
+}
+
+func TestMoveSymlinks(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "file.txt"), "content")
+	if err := os.Symlink(filepath.Join(src, "file.txt"), filepath.Join(src, "abs")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("file.txt", filepath.Join(src, "rel")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, MoveSymlinks: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	// Links are kept verbatim, so the absolute one still points into the source
+	assertLink(t, filepath.Join(dst, "abs"), filepath.Join(src, "file.txt"))
+	assertLink(t, filepath.Join(dst, "rel"), "file.txt")
+	assertFileContent(t, filepath.Join(dst, "rel"), "content")
+	assertNotExists(t, filepath.Join(src, "rel"))
+	if result.SymlinksMoved != 2 {
+		t.Errorf("SymlinksMoved = %d, want 2", result.SymlinksMoved)
+	}
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	outside := t.TempDir()
+
+	createFile(t, filepath.Join(src, "data", "file.txt"), "content")
+	createFile(t, filepath.Join(outside, "external.txt"), "external")
+
+	links := map[string]string{
+		filepath.Join(src, "link"):    filepath.Join("data", "file.txt"),
+		filepath.Join(src, "ext"):     filepath.Join(outside, "external.txt"),
+		filepath.Join(src, "dirlink"): "data",
+		filepath.Join(src, "loop1"):   "loop2",
+		filepath.Join(src, "loop2"):   "loop1",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "data", "file.txt"), "content")
+	if info, err := os.Lstat(filepath.Join(dst, "link")); err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("Followed link should be a regular file at the target: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dst, "link"), "content")
+	assertNotExists(t, filepath.Join(src, "link"))
+
+	// Escaping links, directory links and loops are skipped as usual
+	for _, name := range []string{"ext", "dirlink", "loop1", "loop2"} {
+		assertSymlinkExists(t, filepath.Join(src, name))
+		assertNotExists(t, filepath.Join(dst, name))
+	}
+	if result.SymlinksFollowed != 1 || result.SymlinksSkipped != 4 {
+		t.Errorf("Symlinks followed/skipped = %d/%d, want 1/4", result.SymlinksFollowed, result.SymlinksSkipped)
+	}
+
+	t.Run("file_already_moved", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(dst, "file.txt"), "moved")
+		if err := os.Symlink("file.txt", filepath.Join(src, "link")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+
+		job := Job{SourcePath: filepath.Join(src, "link"), TargetPath: filepath.Join(dst, "link"), SourceRoot: src, TargetRoot: dst}
+		path, _, ok := resolveLink(job)
+		if !ok || path != filepath.Join(dst, "file.txt") {
+			t.Errorf("resolveLink = %q, %v; want the moved file", path, ok)
+		}
+	})
+
+	t.Run("filtered_and_recorded", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "data", "small.txt"), "s")
+		createFile(t, filepath.Join(src, "data", "large.txt"), "large contents")
+		createFile(t, filepath.Join(dst, "data", "other.txt"), "other")
+		for link, target := range map[string]string{"small": "data/small.txt", "large": "data/large.txt"} {
+			if err := os.Symlink(target, filepath.Join(src, link)); err != nil {
+				t.Fatalf("Failed to create symlink: %v", err)
+			}
+		}
+		manifestPath := filepath.Join(t.TempDir(), "manifest.jsonl")
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{FollowSymlinks: true, MinSize: 5, ManifestPath: manifestPath, Quiet: true})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+		assertSymlinkExists(t, filepath.Join(src, "small"))
+		assertNotExists(t, filepath.Join(dst, "small"))
+		assertFileContent(t, filepath.Join(dst, "large"), "large contents")
+		if result.SymlinksFollowed != 1 || result.FilesFiltered != 2 {
+			t.Errorf("SymlinksFollowed = %d, FilesFiltered = %d, want 1 and 2", result.SymlinksFollowed, result.FilesFiltered)
+		}
+
+		entries, err := readManifest(manifestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded := false
+		for _, e := range entries {
+			if e.Source == filepath.Join(src, "large") && e.Target == filepath.Join(dst, "large") && e.Type == ManifestFile {
+				recorded = true
+			}
+		}
+		if !recorded {
+			t.Errorf("Followed link missing from the manifest: %+v", entries)
+		}
+	})
+}
+
+func TestOverwrite(t *testing.T) {
+	setup := func(t *testing.T) (string, string) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "dir", "existing.txt"), "new")
+		createFile(t, filepath.Join(src, "dir", "fresh.txt"), "fresh")
+		createFile(t, filepath.Join(dst, "dir", "existing.txt"), "old")
+		return src, dst
+	}
+
+	t.Run("replaces_existing_files", func(t *testing.T) {
+		src, dst := setup(t)
+
+		if _, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, Overwrite: true}); err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(dst, "dir", "existing.txt"), "new")
+		assertFileContent(t, filepath.Join(dst, "dir", "fresh.txt"), "fresh")
+		assertNotExists(t, filepath.Join(src, "dir", "existing.txt"))
+	})
+
+	t.Run("counts_overwrites_separately", func(t *testing.T) {
+		src, dst := setup(t)
+
+		stats := &Statistics{}
+		m := &mover{opts: &Options{Overwrite: true, DryRun: true}, stats: stats}
+		for _, name := range []string{"existing.txt", "fresh.txt"} {
+			sourcePath := filepath.Join(src, "dir", name)
+			targetPath := filepath.Join(dst, "dir", name)
+			targetInfo, _ := os.Lstat(targetPath)
+			m.processFile(sourcePath, targetPath, statFile(t, sourcePath), targetInfo)
+		}
+
+		if stats.FilesOverwritten != 1 || stats.FilesMoved != 1 || stats.FilesSkipped != 0 {
+			t.Errorf("Unexpected stats: overwritten=%d moved=%d skipped=%d",
+				stats.FilesOverwritten, stats.FilesMoved, stats.FilesSkipped)
+		}
+
+		// Dry run leaves everything in place
+		assertFileContent(t, filepath.Join(dst, "dir", "existing.txt"), "old")
+		assertFileContent(t, filepath.Join(src, "dir", "existing.txt"), "new")
+	})
+}
+
+func TestDeleteIdentical(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "same.txt"), "same content")
+	createFile(t, filepath.Join(dst, "same.txt"), "same content")
+	createFile(t, filepath.Join(src, "dir", "differs.txt"), "source version")
+	createFile(t, filepath.Join(dst, "dir", "differs.txt"), "target version")
+	createFile(t, filepath.Join(src, "dir", "size.txt"), "short")
+	createFile(t, filepath.Join(dst, "dir", "size.txt"), "much longer")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, DeleteIdentical: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertNotExists(t, filepath.Join(src, "same.txt"))
+	assertFileContent(t, filepath.Join(dst, "same.txt"), "same content")
+	assertFileContent(t, filepath.Join(src, "dir", "differs.txt"), "source version")
+	assertFileContent(t, filepath.Join(src, "dir", "size.txt"), "short")
+	if result.FilesDeduplicated != 1 || result.FilesSkipped != 2 {
+		t.Errorf("FilesDeduplicated = %d, FilesSkipped = %d; want 1, 2", result.FilesDeduplicated, result.FilesSkipped)
+	}
+}
+
+func TestConflictRename(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "report.txt"), "new report")
+	createFile(t, filepath.Join(dst, "report.txt"), "old report")
+	createFile(t, filepath.Join(dst, "report (1).txt"), "older report")
+	createFile(t, filepath.Join(src, "dir", ".bashrc"), "new rc")
+	createFile(t, filepath.Join(dst, "dir", ".bashrc"), "old rc")
+	createFile(t, filepath.Join(src, "dir", "fresh.txt"), "fresh")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, ConflictRename: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "report.txt"), "old report")
+	assertFileContent(t, filepath.Join(dst, "report (1).txt"), "older report")
+	assertFileContent(t, filepath.Join(dst, "report (2).txt"), "new report")
+	assertFileContent(t, filepath.Join(dst, "dir", ".bashrc"), "old rc")
+	assertFileContent(t, filepath.Join(dst, "dir", ".bashrc (1)"), "new rc")
+	assertFileContent(t, filepath.Join(dst, "dir", "fresh.txt"), "fresh")
+	if result.FilesRenamed != 2 || result.FilesMoved != 3 {
+		t.Errorf("FilesRenamed = %d, FilesMoved = %d; want 2, 3", result.FilesRenamed, result.FilesMoved)
+	}
+
+	// Names claimed earlier in the run are not handed out twice
+	m := &mover{}
+	first := m.conflictName(filepath.Join(dst, "a.tar.gz"))
+	second := m.conflictName(filepath.Join(dst, "a.tar.gz"))
+	if first != filepath.Join(dst, "a.tar (1).gz") || second != filepath.Join(dst, "a.tar (2).gz") {
+		t.Errorf("conflictName = %q, %q", first, second)
+	}
+
+	_, err = Move(context.Background(), []string{src}, dst, Options{ConflictRename: true, Overwrite: true})
+	if err == nil {
+		t.Error("Expected error combining rename and overwrite")
+	}
+}
+
+func TestOverwriteNewer(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	files := []struct {
+		name      string
+		srcTime   time.Time
+		dstTime   time.Time
+		wantFinal string
+	}{
+		{"newer.txt", base.Add(500 * time.Millisecond), base, "source"},
+		{"older.txt", base, base.Add(time.Second), "target"},
+		{"same.txt", base, base, "target"},
+	}
+	for _, f := range files {
+		createFile(t, filepath.Join(src, f.name), "source")
+		createFile(t, filepath.Join(dst, f.name), "target")
+		if err := os.Chtimes(filepath.Join(src, f.name), f.srcTime, f.srcTime); err != nil {
+			t.Fatalf("Failed to set times: %v", err)
+		}
+		if err := os.Chtimes(filepath.Join(dst, f.name), f.dstTime, f.dstTime); err != nil {
+			t.Fatalf("Failed to set times: %v", err)
+		}
+	}
+
+	if _, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, OverwriteNewer: true}); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	for _, f := range files {
+		assertFileContent(t, filepath.Join(dst, f.name), f.wantFinal)
+	}
+}
+
+func TestSkipIfInTarget(t *testing.T) {
+	t.Run("by_name", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		createFile(t, filepath.Join(src, "photo.jpg"), "photo")
+		createFile(t, filepath.Join(src, "new.jpg"), "new")
+		createFile(t, filepath.Join(dst, "library", "photo.jpg"), "other")
+
+		opts := Options{Workers: 2, Buffer: 10000, SkipIfInTarget: true, IndexBy: IndexByName}
+		if _, err := Move(context.Background(), []string{src}, dst, opts); err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(src, "photo.jpg"), "photo")
+		assertNotExists(t, filepath.Join(dst, "photo.jpg"))
+		assertFileContent(t, filepath.Join(dst, "new.jpg"), "new")
+	})
+
+	t.Run("by_hash", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		createFile(t, filepath.Join(src, "copy.jpg"), "same bytes")
+		createFile(t, filepath.Join(src, "photo.jpg"), "different")
+		createFile(t, filepath.Join(dst, "library", "original.jpg"), "same bytes")
+		createFile(t, filepath.Join(dst, "library", "photo.jpg"), "other")
+
+		opts := Options{Workers: 2, Buffer: 10000, SkipIfInTarget: true, IndexBy: IndexByHash}
+		if _, err := Move(context.Background(), []string{src}, dst, opts); err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(src, "copy.jpg"), "same bytes")
+		assertNotExists(t, filepath.Join(dst, "copy.jpg"))
+		assertFileContent(t, filepath.Join(dst, "photo.jpg"), "different")
+	})
+}
+
+func TestHashDenylist(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "bad.txt"), "corrupted template")
+	createFile(t, filepath.Join(src, "bad_copy.txt"), "corrupted template")
+	createFile(t, filepath.Join(src, "good.txt"), "fine")
+
+	sum := sha256.Sum256([]byte("corrupted template"))
+	denylist := filepath.Join(t.TempDir(), "denylist.txt")
+	createFile(t, denylist, fmt.Sprintf("# known bad\n%x %d\n", sum, len("corrupted template")))
+
+	stats := &Statistics{}
+	d, err := loadDenylist(denylist)
+	if err != nil {
+		t.Fatalf("loadDenylist failed: %v", err)
+	}
+	m := &mover{opts: &Options{DeleteDenied: true}, stats: stats, denylist: d}
+	m.processFile(filepath.Join(src, "bad_copy.txt"), filepath.Join(dst, "bad_copy.txt"), statFile(t, filepath.Join(src, "bad_copy.txt")), nil)
+	if stats.FilesDenied != 1 {
+		t.Errorf("FilesDenied = %d, want 1", stats.FilesDenied)
+	}
+	assertNotExists(t, filepath.Join(src, "bad_copy.txt"))
+
+	_, err = Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, HashDenylist: denylist})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(src, "bad.txt"), "corrupted template")
+	assertNotExists(t, filepath.Join(dst, "bad.txt"))
+	assertFileContent(t, filepath.Join(dst, "good.txt"), "fine")
+}
+
+func TestInclude(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "a.jpg"), "a")
+	createFile(t, filepath.Join(src, "notes.txt"), "notes")
+	createFile(t, filepath.Join(src, "deep", "nested", "b.jpg"), "b")
+	createFile(t, filepath.Join(src, "deep", "nested", "c.png"), "c")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, Include: []string{"*.jpg"}})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "a.jpg"), "a")
+	assertFileContent(t, filepath.Join(dst, "deep", "nested", "b.jpg"), "b")
+	assertFileContent(t, filepath.Join(src, "notes.txt"), "notes")
+	assertFileContent(t, filepath.Join(src, "deep", "nested", "c.png"), "c")
+	assertNotExists(t, filepath.Join(dst, "deep", "nested", "c.png"))
+	if result.FilesFiltered != 2 {
+		t.Errorf("FilesFiltered = %d, want 2", result.FilesFiltered)
+	}
+
+	_, err = Move(context.Background(), []string{src}, dst, Options{Include: []string{"[a-"}})
+	if err == nil {
+		t.Error("Expected error for malformed pattern")
+	}
+}
+
+func TestSizeFilter(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "small.bin"), "tiny")
+	createFile(t, filepath.Join(src, "dir", "medium.bin"), strings.Repeat("m", 100))
+	createFile(t, filepath.Join(src, "dir", "large.bin"), strings.Repeat("l", 1000))
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, MinSize: 10, MaxSize: 500})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "dir", "medium.bin"), strings.Repeat("m", 100))
+	assertFileContent(t, filepath.Join(src, "small.bin"), "tiny")
+	assertFileContent(t, filepath.Join(src, "dir", "large.bin"), strings.Repeat("l", 1000))
+	if result.FilesFiltered != 2 {
+		t.Errorf("FilesFiltered = %d, want 2", result.FilesFiltered)
+	}
+
+	_, err = Move(context.Background(), []string{src}, dst, Options{MinSize: 10, MaxSize: 5})
+	if err == nil {
+		t.Error("Expected error for inverted size range")
+	}
+}
+
+func TestTimeFilter(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	now := time.Now()
+
+	files := map[string]time.Time{
+		"recent.txt":         now.Add(-time.Hour),
+		"dir/lastweek.txt":   now.Add(-5 * 24 * time.Hour),
+		"dir/lastmonth.txt":  now.Add(-30 * 24 * time.Hour),
+		"dir/lastdecade.txt": now.Add(-3650 * 24 * time.Hour),
+	}
+	for name, mtime := range files {
+		path := filepath.Join(src, name)
+		createFile(t, path, name)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set times: %v", err)
+		}
+	}
+
+	// Modified between a year and a day ago
+	result, err := Move(context.Background(), []string{src}, dst, Options{
+		Workers:   2,
+		Buffer:    10000,
+		NewerThan: now.Add(-365 * 24 * time.Hour),
+		OlderThan: now.Add(-24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "dir", "lastweek.txt"), "dir/lastweek.txt")
+	assertFileContent(t, filepath.Join(dst, "dir", "lastmonth.txt"), "dir/lastmonth.txt")
+	assertFileContent(t, filepath.Join(src, "recent.txt"), "recent.txt")
+	assertFileContent(t, filepath.Join(src, "dir", "lastdecade.txt"), "dir/lastdecade.txt")
+	if result.FilesFiltered != 2 {
+		t.Errorf("FilesFiltered = %d, want 2", result.FilesFiltered)
+	}
+
+	_, err = Move(context.Background(), []string{src}, dst, Options{NewerThan: now, OlderThan: now.Add(-time.Hour)})
+	if err == nil {
+		t.Error("Expected error for empty time range")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"7d", now.Add(-7 * 24 * time.Hour)},
+		{"2w", now.Add(-14 * 24 * time.Hour)},
+		{"36h", now.Add(-36 * time.Hour)},
+		{"1.5d", now.Add(-36 * time.Hour)},
+		{"2024-01-31T08:30:00Z", time.Date(2024, 1, 31, 8, 30, 0, 0, time.UTC)},
+		{"2024-01-31", time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "yesterday", "-3d", "d", "2024-13-01"} {
+		if _, err := ParseTime(in, now); err == nil {
+			t.Errorf("ParseTime(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"10K", 10 << 10},
+		{"10m", 10 << 20},
+		{"10MB", 10 << 20},
+		{"10MiB", 10 << 20},
+		{"1.5G", 3 << 29},
+		{"2T", 2 << 40},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "M", "10X", "-1", "ten"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestExclude(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "keep.jpg"), "keep")
+	createFile(t, filepath.Join(src, "scratch.tmp"), "tmp")
+	createFile(t, filepath.Join(src, "excluded.jpg"), "excluded")
+	createFile(t, filepath.Join(src, "app", "main.go"), "main")
+	createFile(t, filepath.Join(src, "app", "node_modules", "dep", "index.js"), "dep")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{
+		Workers: 2,
+		Buffer:  10000,
+		Include: []string{"*.jpg", "*.go", "*.js", "*.tmp"},
+		Exclude: []string{"*.tmp", "node_modules", "excluded.*"},
+	})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "keep.jpg"), "keep")
+	assertFileContent(t, filepath.Join(dst, "app", "main.go"), "main")
+	assertFileContent(t, filepath.Join(src, "scratch.tmp"), "tmp")
+	assertFileContent(t, filepath.Join(src, "excluded.jpg"), "excluded")
+	assertFileContent(t, filepath.Join(src, "app", "node_modules", "dep", "index.js"), "dep")
+	assertNotExists(t, filepath.Join(dst, "app", "node_modules"))
+
+	if result.FilesFiltered != 2 || result.DirsFiltered != 1 {
+		t.Errorf("Filtered = %d files, %d dirs; want 2 files, 1 dir", result.FilesFiltered, result.DirsFiltered)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "whole", "a.log"), "whole")
+	createFile(t, filepath.Join(src, "walk", "keep.txt"), "keep")
+	createFile(t, filepath.Join(src, "walk", "debug.log"), "log")
+	createFile(t, filepath.Join(src, "cache", "blob"), "blob")
+	createFile(t, filepath.Join(src, "top.log"), "top")
+
+	var mu sync.Mutex
+	var asked []string
+	filter := func(path string, info os.FileInfo) Decision {
+		rel, _ := filepath.Rel(src, path)
+		mu.Lock()
+		asked = append(asked, rel)
+		mu.Unlock()
+		switch {
+		case rel == "walk":
+			return FilterRecurse
+		case rel == "cache":
+			return FilterPrune
+		case filepath.Ext(rel) == ".log":
+			return FilterSkip
+		}
+		return FilterMove
+	}
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Filter: filter})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	// A directory moved as a whole takes everything along unasked
+	assertFileContent(t, filepath.Join(dst, "whole", "a.log"), "whole")
+	assertFileContent(t, filepath.Join(dst, "walk", "keep.txt"), "keep")
+	assertFileContent(t, filepath.Join(src, "walk", "debug.log"), "log")
+	assertFileContent(t, filepath.Join(src, "cache", "blob"), "blob")
+	assertFileContent(t, filepath.Join(src, "top.log"), "top")
+	assertNotExists(t, filepath.Join(dst, "cache"))
+
+	slices.Sort(asked)
+	want := []string{"cache", "top.log", "walk", filepath.Join("walk", "debug.log"), filepath.Join("walk", "keep.txt"), "whole"}
+	if !slices.Equal(asked, want) {
+		t.Errorf("Filter asked about %v, want %v", asked, want)
+	}
+	if result.FilesFiltered != 2 || result.DirsFiltered != 1 || result.DirsCreated != 1 {
+		t.Errorf("Filtered = %d files, %d dirs, created %d dirs; want 2, 1 and 1", result.FilesFiltered, result.DirsFiltered, result.DirsCreated)
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	root := filepath.FromSlash("/src")
+	var rules ignoreRules
+	for _, line := range []string{"# comment", "*.o", "build/", "!build/keep.o", "/scratch", "logs/**/*.log", `\!bang`} {
+		if rule, ok := parseIgnoreRule(root, line); ok {
+			rules.rules = append(rules.rules, rule)
+		}
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"main.o", false, true},
+		{"deep/nested/main.o", false, true},
+		{"main.c", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"sub/build", true, true},
+		{"build/keep.o", false, false},
+		{"scratch", true, true},
+		{"sub/scratch", true, false},
+		{"logs/a.log", false, true},
+		{"logs/2024/01/a.log", false, true},
+		{"other/logs/a.log", false, false},
+		{"!bang", false, true},
+		{"comment", false, false},
+	}
+	for _, tt := range tests {
+		got := rules.ignored(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir)
+		if got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreFile(t *testing.T) {
+	setup := func(t *testing.T) (string, string) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, ignoreFileName), "*.tmp\ncache/\n")
+		createFile(t, filepath.Join(src, "keep.txt"), "keep")
+		createFile(t, filepath.Join(src, "scratch.tmp"), "tmp")
+		createFile(t, filepath.Join(src, "cache", "blob"), "blob")
+		createFile(t, filepath.Join(src, "sub", ignoreFileName), "!important.tmp\nlocal.txt\n")
+		createFile(t, filepath.Join(src, "sub", "important.tmp"), "important")
+		createFile(t, filepath.Join(src, "sub", "other.tmp"), "other")
+		createFile(t, filepath.Join(src, "sub", "local.txt"), "local")
+		return src, dst
+	}
+
+	t.Run("rules_applied", func(t *testing.T) {
+		src, dst := setup(t)
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(dst, "keep.txt"), "keep")
+		assertFileContent(t, filepath.Join(dst, "sub", "important.tmp"), "important")
+		assertFileContent(t, filepath.Join(src, "scratch.tmp"), "tmp")
+		assertFileContent(t, filepath.Join(src, "cache", "blob"), "blob")
+		assertFileContent(t, filepath.Join(src, "sub", "other.tmp"), "other")
+		assertFileContent(t, filepath.Join(src, "sub", "local.txt"), "local")
+		assertFileContent(t, filepath.Join(src, ignoreFileName), "*.tmp\ncache/\n")
+		assertNotExists(t, filepath.Join(dst, ignoreFileName))
+		assertNotExists(t, filepath.Join(dst, "cache"))
+	})
+
+	t.Run("no_ignore", func(t *testing.T) {
+		src, dst := setup(t)
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, NoIgnore: true})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(dst, "scratch.tmp"), "tmp")
+		assertFileContent(t, filepath.Join(dst, "cache", "blob"), "blob")
+		assertFileContent(t, filepath.Join(dst, ignoreFileName), "*.tmp\ncache/\n")
+	})
+}
+
+func TestWatch(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "early.txt"), "early")
+	createFile(t, filepath.Join(src, ignoreFileName), "*.tmp\nskipped/\n")
+
+	done := make(chan error, 1)
+	go func() {
+		opts := Options{Workers: 2, Buffer: 10000, Watch: 2 * time.Second, WatchSettle: 200 * time.Millisecond, Exclude: []string{"*.bak"}}
+		_, err := Move(context.Background(), []string{src}, dst, opts)
+		done <- err
+	}()
+
+	// Give the main pass time to finish and the watcher time to start
+	time.Sleep(500 * time.Millisecond)
+	createFile(t, filepath.Join(src, "late.txt"), "late")
+	createFile(t, filepath.Join(src, "newdir", "inner.txt"), "inner")
+	createFile(t, filepath.Join(src, "late.tmp"), "tmp")
+	createFile(t, filepath.Join(src, "skipped", "inner.txt"), "skipped")
+	createFile(t, filepath.Join(src, "backups", "old.bak"), "bak")
+
+	if err := <-done; err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	// The ignore rules and filters apply to files arriving during the watch,
+	// and nothing is created at the target for them
+	assertFileContent(t, filepath.Join(src, "late.tmp"), "tmp")
+	assertFileContent(t, filepath.Join(src, "skipped", "inner.txt"), "skipped")
+	assertFileContent(t, filepath.Join(src, "backups", "old.bak"), "bak")
+	assertFileContent(t, filepath.Join(src, ignoreFileName), "*.tmp\nskipped/\n")
+	assertNotExists(t, filepath.Join(dst, "late.tmp"))
+	assertNotExists(t, filepath.Join(dst, "skipped"))
+	assertNotExists(t, filepath.Join(dst, "backups"))
+	assertNotExists(t, filepath.Join(dst, ignoreFileName))
+
+	assertFileContent(t, filepath.Join(dst, "early.txt"), "early")
+	assertFileContent(t, filepath.Join(dst, "late.txt"), "late")
+	assertFileContent(t, filepath.Join(dst, "newdir", "inner.txt"), "inner")
+	assertNotExists(t, filepath.Join(src, "late.txt"))
+}
+
+func TestWatchAncestors(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "kept", "a.txt"), "a")
+	createFile(t, filepath.Join(dst, "kept", "b.txt"), "b")
+
+	done := make(chan error, 1)
+	var res Result
+	go func() {
+		opts := Options{
+			Workers:     2,
+			Buffer:      10000,
+			Watch:       2 * time.Second,
+			WatchSettle: 200 * time.Millisecond,
+			Exclude:     []string{"node_modules"},
+			MaxDepth:    1,
+			Filter: func(path string, info os.FileInfo) Decision {
+				if info.IsDir() && filepath.Base(path) == "vendor" {
+					return FilterPrune
+				}
+				return FilterMove
+			},
+		}
+		var err error
+		res, err = Move(context.Background(), []string{src}, dst, opts)
+		done <- err
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	createFile(t, filepath.Join(src, "app", "node_modules", "late.js"), "js")
+	createFile(t, filepath.Join(src, "vendor", "lib.go"), "lib")
+	createFile(t, filepath.Join(src, "kept", "late.txt"), "late")
+	createFile(t, filepath.Join(src, "fresh", "new.txt"), "new")
+
+	if err := <-done; err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	// Files below an excluded, pruned or max-depth directory stay in the
+	// source, and none of those directories is created at the target
+	assertFileContent(t, filepath.Join(src, "app", "node_modules", "late.js"), "js")
+	assertFileContent(t, filepath.Join(src, "vendor", "lib.go"), "lib")
+	assertFileContent(t, filepath.Join(src, "kept", "late.txt"), "late")
+	assertNotExists(t, filepath.Join(dst, "app", "node_modules"))
+	assertNotExists(t, filepath.Join(dst, "vendor"))
+	assertNotExists(t, filepath.Join(dst, "kept", "late.txt"))
+	assertNotExists(t, filepath.Join(dst, "kept", "a.txt"))
+
+	assertFileContent(t, filepath.Join(dst, "fresh", "new.txt"), "new")
+	assertNotExists(t, filepath.Join(src, "fresh", "new.txt"))
+
+	if res.FilesFiltered != 2 {
+		t.Errorf("FilesFiltered = %d, want 2", res.FilesFiltered)
+	}
+	if res.Skipped[SkipMaxDepth] != 2 {
+		t.Errorf("Skipped[SkipMaxDepth] = %d, want 2", res.Skipped[SkipMaxDepth])
+	}
+}
+
+func TestNoReplace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("renameat2 is Linux only")
+	}
+
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "file.txt"), "new")
+	createFile(t, filepath.Join(dst, "file.txt"), "raced")
+	createFile(t, filepath.Join(src, "dir", "a.txt"), "a")
+	createFile(t, filepath.Join(dst, "dir", "b.txt"), "b")
+
+	stats := &Statistics{}
+	m := &mover{opts: &Options{NoReplace: true}, stats: stats}
+
+	// Pretend the targets appeared after the existence check
+	moved, err := m.processFile(filepath.Join(src, "file.txt"), filepath.Join(dst, "file.txt"), statFile(t, filepath.Join(src, "file.txt")), nil)
+	if moved != "" || err != nil {
+		t.Errorf("processFile = %v, %v; want skip", moved, err)
+	}
+	assertFileContent(t, filepath.Join(dst, "file.txt"), "raced")
+	if stats.FilesSkipped != 1 {
+		t.Errorf("FilesSkipped = %d, want 1", stats.FilesSkipped)
+	}
+
+	job := Job{SourcePath: filepath.Join(src, "dir"), TargetPath: filepath.Join(dst, "dir")}
+	children := m.processDir(job, statFile(t, job.SourcePath), nil, false)
+	if len(children) != 1 || children[0].SourcePath != filepath.Join(src, "dir", "a.txt") {
+		t.Errorf("Expected directory to be merged, got children %v", children)
+	}
+	assertFileContent(t, filepath.Join(dst, "dir", "b.txt"), "b")
+}
+
+func TestNoReplaceDevices(t *testing.T) {
+	dir := t.TempDir()
+	if _, ok := dirDevice(dir); !ok {
+		t.Skip("Device numbers are not available on this platform")
+	}
+
+	m := &mover{}
+	if m.noReplace.unsupported(dir) {
+		t.Fatal("Fresh run starts with an unsupported device")
+	}
+	m.noReplace.markUnsupported(dir)
+	if !m.noReplace.unsupported(dir) || !m.noReplace.unsupported(t.TempDir()) {
+		t.Error("Device not recorded as unsupported")
+	}
+	if err := m.renameNoReplace(filepath.Join(dir, "a"), filepath.Join(dir, "b")); !errors.Is(err, errNoReplaceUnsupported) {
+		t.Errorf("renameNoReplace on an unsupported device = %v, want errNoReplaceUnsupported", err)
+	}
+
+	// Other devices, and other runs, still try the kernel
+	if other, err := os.MkdirTemp("/dev/shm", "mvmv-test-"); err == nil {
+		defer os.RemoveAll(other)
+		dev, _ := dirDevice(dir)
+		if otherDev, _ := dirDevice(other); otherDev != dev && m.noReplace.unsupported(other) {
+			t.Error("Unsupported device applied to another filesystem")
+		}
+	}
+	if (&mover{}).noReplace.unsupported(dir) {
+		t.Error("Unsupported device leaked into another run")
+	}
+}
+
+func TestAtomicDirs(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "a.txt"), "a")
+	createFile(t, filepath.Join(src, "b.txt"), "b")
+	createFile(t, filepath.Join(src, "c.txt"), "c")
+	createFile(t, filepath.Join(src, "sub", "d.txt"), "d")
+
+	children := []Job{
+		{SourcePath: filepath.Join(src, "a.txt"), TargetPath: filepath.Join(dst, "a.txt")},
+		// The target's parent doesn't exist, so this move fails
+		{SourcePath: filepath.Join(src, "b.txt"), TargetPath: filepath.Join(dst, "missing", "b.txt")},
+		{SourcePath: filepath.Join(src, "c.txt"), TargetPath: filepath.Join(dst, "c.txt")},
+		{SourcePath: filepath.Join(src, "sub"), TargetPath: filepath.Join(dst, "sub")},
+	}
+
+	stats := &Statistics{}
+	m := &mover{opts: &Options{AtomicDirs: true}, stats: stats}
+	rest := m.processFilesAtomically(src, children)
+
+	if len(rest) != 1 || rest[0].SourcePath != filepath.Join(src, "sub") {
+		t.Errorf("Expected only the subdirectory to be left for workers, got %v", rest)
+	}
+
+	// Every file is back in the source
+	assertFileContent(t, filepath.Join(src, "a.txt"), "a")
+	assertFileContent(t, filepath.Join(src, "b.txt"), "b")
+	assertFileContent(t, filepath.Join(src, "c.txt"), "c")
+	assertNotExists(t, filepath.Join(dst, "a.txt"))
+	assertNotExists(t, filepath.Join(dst, "c.txt"))
+
+	if stats.FilesMoved != 0 || stats.FilesRolledBack != 1 || stats.DirsRolledBack != 1 || stats.Errors != 1 {
+		t.Errorf("Unexpected stats: moved=%d rolledBack=%d dirsRolledBack=%d errors=%d",
+			stats.FilesMoved, stats.FilesRolledBack, stats.DirsRolledBack, stats.Errors)
+	}
+
+	// A replaced target couldn't be restored by a rollback
+	for _, opts := range []Options{{Overwrite: true}, {OverwriteNewer: true}, {ReplaceMismatched: true}} {
+		opts.AtomicDirs = true
+		if _, err := Move(context.Background(), []string{src}, dst, opts); !errors.As(err, new(*OptionsError)) {
+			t.Errorf("Move with %+v = %v, want an OptionsError", opts, err)
+		}
+	}
+
+	t.Run("conflict_rename", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "a.txt"), "new")
+		createFile(t, filepath.Join(dst, "a.txt"), "old")
+		createFile(t, filepath.Join(src, "b.txt"), "b")
+
+		stats := &Statistics{}
+		m := &mover{opts: &Options{AtomicDirs: true, ConflictRename: true}, stats: stats}
+		m.processFilesAtomically(src, []Job{
+			{SourcePath: filepath.Join(src, "a.txt"), TargetPath: filepath.Join(dst, "a.txt")},
+			{SourcePath: filepath.Join(src, "b.txt"), TargetPath: filepath.Join(dst, "missing", "b.txt")},
+		})
+		assertFileContent(t, filepath.Join(src, "a.txt"), "new")
+		assertFileContent(t, filepath.Join(dst, "a.txt"), "old")
+		assertNotExists(t, filepath.Join(dst, "a (1).txt"))
+		if stats.FilesMoved != 0 || stats.FilesRenamed != 0 || stats.BytesMoved != 0 {
+			t.Errorf("Unexpected stats after rollback: moved=%d renamed=%d bytes=%d", stats.FilesMoved, stats.FilesRenamed, stats.BytesMoved)
+		}
+	})
+
+	t.Run("manifest", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "d", "a.txt"), "a")
+		createFile(t, filepath.Join(src, "d", "b.txt"), "b")
+		createFile(t, filepath.Join(src, "e", "c.txt"), "c")
+		createFile(t, filepath.Join(dst, "d", "other.txt"), "other")
+		createFile(t, filepath.Join(dst, "e", "other.txt"), "other")
+		manifestPath := filepath.Join(t.TempDir(), "manifest.jsonl")
+
+		faults := func(path string) error {
+			if filepath.Base(path) == "b.txt" {
+				return errors.New("injected")
+			}
+			return nil
+		}
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, AtomicDirs: true, ManifestPath: manifestPath, SummaryDepth: 1, faultInjector: faults, Quiet: true})
+		if err == nil {
+			t.Fatal("Move succeeded despite the injected failure")
+		}
+		entries, err := readManifest(manifestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Target != filepath.Join(dst, "e", "c.txt") {
+			t.Errorf("Manifest = %+v, want only the committed e/c.txt", entries)
+		}
+		var summarized int64
+		for _, node := range result.Summary {
+			summarized += node.Entries
+		}
+		if summarized != 1 {
+			t.Errorf("Summary holds %d entries, want only the committed one", summarized)
+		}
+	})
+
+	t.Run("cross_device", func(t *testing.T) {
+		src := t.TempDir()
+		other, err := os.MkdirTemp("/dev/shm", "mvmv-test-")
+		if err != nil {
+			t.Skipf("No second filesystem: %v", err)
+		}
+		defer os.RemoveAll(other)
+		srcDev, _ := deviceID(statFile(t, src))
+		otherDev, _ := deviceID(statFile(t, other))
+		if srcDev == otherDev {
+			t.Skip("No second filesystem")
+		}
+		createFile(t, filepath.Join(src, "a.txt"), "a")
+		createFile(t, filepath.Join(src, "b.txt"), "b")
+
+		stats := &Statistics{}
+		m := &mover{opts: &Options{AtomicDirs: true, AllowCrossDevice: true}, stats: stats}
+		m.processFilesAtomically(src, []Job{
+			{SourcePath: filepath.Join(src, "a.txt"), TargetPath: filepath.Join(other, "a.txt")},
+			{SourcePath: filepath.Join(src, "b.txt"), TargetPath: filepath.Join(other, "missing", "b.txt")},
+		})
+		assertFileContent(t, filepath.Join(src, "a.txt"), "a")
+		assertNotExists(t, filepath.Join(other, "a.txt"))
+		if stats.FilesMoved != 0 || stats.FilesCopied != 0 || stats.FilesRolledBack != 1 || stats.Errors != 1 {
+			t.Errorf("Unexpected stats: moved=%d copied=%d rolledBack=%d errors=%d",
+				stats.FilesMoved, stats.FilesCopied, stats.FilesRolledBack, stats.Errors)
+		}
+	})
+}
+
+func TestCopyFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file.txt")
+	dst := filepath.Join(t.TempDir(), "file.txt")
+
+	createFile(t, src, "content")
+	if err := os.Chmod(src, 0750); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	atime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	if err := os.Chtimes(src, atime, mtime); err != nil {
+		t.Fatalf("Failed to set times: %v", err)
+	}
+
+	if err := (&mover{opts: &Options{Verify: true, PreserveOwnership: true}}).copyFile(src, dst, statFile(t, src)); err != nil {
+		t.Fatalf("copyFile failed: %v", err)
+	}
+
+	// Check the times before reading the file updates its atime
+	info := statFile(t, dst)
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("Mode not preserved: got %v", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Mtime not preserved: got %v, want %v", info.ModTime(), mtime)
+	}
+	if got := accessTime(info); runtime.GOOS != "windows" && !got.Equal(atime) {
+		t.Errorf("Atime not preserved: got %v, want %v", got, atime)
+	}
+	assertNotExists(t, src)
+	assertFileContent(t, dst, "content")
+
+	// An existing target is never overwritten
+	createFile(t, src, "again")
+	if err := (&mover{opts: &Options{}}).copyFile(src, dst, statFile(t, src)); err == nil {
+		t.Error("Expected copyFile to refuse an existing target")
+	}
+	assertFileContent(t, src, "again")
+	assertFileContent(t, dst, "content")
+	if temps, _ := filepath.Glob(filepath.Join(filepath.Dir(dst), tempPrefix+"*")); len(temps) > 0 {
+		t.Errorf("Temporary files left behind: %v", temps)
+	}
+}
+
+func TestCopyTempFile(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, tempPrefix+"123456")
+	createFile(t, stale, "partial")
+	other := filepath.Join(dir, "keep"+tempPrefix)
+	createFile(t, other, "not ours")
+
+	// The target name only appears once the copy is complete
+	src := filepath.Join(t.TempDir(), "file.txt")
+	createFile(t, src, "content")
+	dst := filepath.Join(dir, "file.txt")
+	var seen []string
+	hashFile := verifyHash
+	verifyHash = func() hash.Hash {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			seen = append(seen, e.Name())
+		}
+		return hashFile()
+	}
+	t.Cleanup(func() { verifyHash = hashFile })
+
+	if err := (&mover{opts: &Options{Verify: true}}).copyFile(src, dst, statFile(t, src)); err != nil {
+		t.Fatalf("copyFile failed: %v", err)
+	}
+	assertFileContent(t, dst, "content")
+	assertNotExists(t, stale)
+	assertFileContent(t, other, "not ours")
+	if slices.Contains(seen, "file.txt") || !slices.ContainsFunc(seen, func(name string) bool { return strings.HasPrefix(name, tempPrefix) }) {
+		t.Errorf("Directory during the copy held %v, want a temporary file and no target", seen)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("Directory holds %d entries after the copy, want 2", len(entries))
+	}
+
+	// Without temporary files the copy is written in place and stale ones
+	// are left alone
+	createFile(t, stale, "partial")
+	createFile(t, src, "direct")
+	seen = nil
+	if err := (&mover{opts: &Options{Verify: true, NoTempFile: true}}).copyFile(src, filepath.Join(dir, "direct.txt"), statFile(t, src)); err != nil {
+		t.Fatalf("copyFile failed: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dir, "direct.txt"), "direct")
+	assertFileContent(t, stale, "partial")
+	if !slices.Contains(seen, "direct.txt") {
+		t.Errorf("Directory during the copy held %v, want the target", seen)
+	}
+}
+
+// saltedHash is a SHA-256 whose digest differs per instance, simulating
+// data that changed between copy and read-back
+type saltedHash struct {
+	hash.Hash
+	salt byte
+}
+
+func (h saltedHash) Sum(b []byte) []byte {
+	return append(h.Hash.Sum(b), h.salt)
+}
+
+func TestCopyHardLink(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a"), "shared")
+	for _, name := range []string{"b", "c"} {
+		if err := os.Link(filepath.Join(src, "a"), filepath.Join(src, name)); err != nil {
+			t.Fatalf("Failed to link: %v", err)
+		}
+	}
+	createFile(t, filepath.Join(src, "single"), "single")
+
+	m := &mover{opts: &Options{}, stats: &Statistics{}, links: newLinkTable()}
+	names := []string{"a", "b", "c", "single"}
+	infos := make([]os.FileInfo, len(names))
+	for i, name := range names {
+		infos[i] = statFile(t, filepath.Join(src, name))
+	}
+
+	var wg sync.WaitGroup
+	handled := make([]bool, len(names))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			source, target := filepath.Join(src, name), filepath.Join(dst, name)
+			handled[i], errs[i] = m.copyHardLink(source, target, infos[i], func() error {
+				return m.copyAcross(source, target, infos[i])
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		if errs[i] != nil {
+			t.Errorf("copyHardLink(%s) failed: %v", name, errs[i])
+		}
+		if want := name != "single"; handled[i] != want {
+			t.Errorf("copyHardLink(%s) handled = %v, want %v", name, handled[i], want)
+		}
+	}
+	for _, name := range []string{"b", "c"} {
+		assertFileContent(t, filepath.Join(dst, name), "shared")
+		assertNotExists(t, filepath.Join(src, name))
+		if !sameFile(statFile(t, filepath.Join(dst, "a")), statFile(t, filepath.Join(dst, name))) {
+			t.Errorf("%s is not a hard link to a at the target", name)
+		}
+	}
+	if m.stats.FilesCopied != 1 || m.stats.FilesLinked != 2 {
+		t.Errorf("FilesCopied = %d, FilesLinked = %d; want 1 and 2", m.stats.FilesCopied, m.stats.FilesLinked)
+	}
+	if len(m.links.copies) != 0 {
+		t.Errorf("Link table keeps %d entries after every link was seen", len(m.links.copies))
+	}
+}
+
+func TestCopyFileVerify(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file.txt")
+	dst := filepath.Join(t.TempDir(), "file.txt")
+	createFile(t, src, "content")
+
+	var instances byte
+	verifyHash = func() hash.Hash {
+		instances++
+		return saltedHash{Hash: sha256.New(), salt: instances}
+	}
+	t.Cleanup(func() { verifyHash = sha256.New })
+
+	err := (&mover{opts: &Options{Verify: true}}).copyFile(src, dst, statFile(t, src))
+	if !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("Expected checksum mismatch, got %v", err)
+	}
+	assertFileContent(t, src, "content")
+	assertNotExists(t, dst)
+}
+
+func TestCopyBufferSize(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	for _, verify := range []bool{false, true} {
+		src := filepath.Join(t.TempDir(), "file.txt")
+		dst := filepath.Join(t.TempDir(), "file.txt")
+		createFile(t, src, content)
+
+		// A buffer much smaller than the file takes many rounds to fill
+		m := &mover{opts: &Options{CopyBufferSize: 7, Verify: verify}}
+		if err := m.copyFile(src, dst, statFile(t, src)); err != nil {
+			t.Fatalf("copyFile failed with verify=%v: %v", verify, err)
+		}
+		assertFileContent(t, dst, content)
+		if buf := m.copyBuffer(); len(*buf) != 7 {
+			t.Errorf("Pooled buffer is %d bytes, want 7", len(*buf))
+		}
+	}
+
+	_, err := Move(context.Background(), []string{t.TempDir()}, t.TempDir(), Options{CopyBufferSize: -1})
+	var optsErr *OptionsError
+	if !errors.As(err, &optsErr) {
+		t.Errorf("Expected an OptionsError for a negative buffer size, got %v", err)
+	}
+}
+
+func TestFsync(t *testing.T) {
+	targets := []string{t.TempDir()}
+	if other, err := os.MkdirTemp("/dev/shm", "mvmv-test-"); err == nil {
+		defer os.RemoveAll(other)
+		targets = append(targets, other)
+	}
+	for _, dst := range targets {
+		src := t.TempDir()
+		createFile(t, filepath.Join(src, "a", "one.txt"), "1")
+		createFile(t, filepath.Join(src, "b", "two.txt"), "2")
+		createFile(t, filepath.Join(dst, "b", "old.txt"), "old")
+		if err := os.Symlink("one.txt", filepath.Join(src, "a", "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Move(context.Background(), []string{src}, dst, Options{Fsync: true, AllowCrossDevice: true, MoveSymlinks: true, Quiet: true})
+		if err != nil {
+			t.Fatalf("Move to %s: %v", dst, err)
+		}
+		assertFileContent(t, filepath.Join(dst, "a", "one.txt"), "1")
+		assertFileContent(t, filepath.Join(dst, "a", "link"), "1")
+		assertFileContent(t, filepath.Join(dst, "b", "two.txt"), "2")
+		assertNotExists(t, filepath.Join(src, "b", "two.txt"))
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	// Two concurrent copies share one limit: 300KB at 1MB/s, less the 100KB
+	// burst, takes at least 200ms
+	limiter := newRateLimiter(1 << 20)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &limitedReader{r: bytes.NewReader(make([]byte, 150<<10)), limiter: limiter}
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				t.Errorf("Copy failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Copies finished in %v, faster than the limit allows", elapsed)
+	}
+}
+
+func TestCopySlots(t *testing.T) {
+	if got := copySlotCount(10); got != 5 {
+		t.Errorf("copySlotCount(10) = %d, want 5", got)
+	}
+	if got := copySlotCount(1); got != 1 {
+		t.Errorf("copySlotCount(1) = %d, want 1", got)
+	}
+	if got := copySlotCount(-1); got != 0 {
+		t.Errorf("copySlotCount(-1) = %d, want 0", got)
+	}
+	if limit := openFileLimit(); limit >= 4 {
+		if got := copySlotCount(0); got != limit/4 {
+			t.Errorf("copySlotCount(0) = %d, want %d for ulimit %d", got, limit/4, limit)
+		}
+	}
+
+	// Copies queue for the single slot rather than failing
+	dir := t.TempDir()
+	m := &mover{opts: &Options{}, copySlots: make(chan struct{}, 1)}
+	var wg sync.WaitGroup
+	for i := range 4 {
+		src := filepath.Join(dir, fmt.Sprintf("src%d", i))
+		createFile(t, src, "content")
+		info := statFile(t, src)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.copyFile(src, src+".copy", info); err != nil {
+				t.Errorf("copyFile failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(m.copySlots) != 0 {
+		t.Errorf("%d copy slots still held", len(m.copySlots))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	stats := &Statistics{}
+	m := &mover{opts: &Options{Retries: 3, RetryDelay: time.Millisecond}, stats: stats}
+
+	t.Run("transient_errors_are_retried", func(t *testing.T) {
+		calls := 0
+		err := m.retry("src", "dst", func() error {
+			calls++
+			if calls < 3 {
+				return &os.LinkError{Op: "rename", Old: "src", New: "dst", Err: syscall.EIO}
+			}
+			return nil
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("retry = %v after %d calls, want success after 3", err, calls)
+		}
+	})
+
+	t.Run("retries_are_bounded", func(t *testing.T) {
+		calls := 0
+		err := m.retry("src", "dst", func() error {
+			calls++
+			return syscall.EINTR
+		})
+		if !errors.Is(err, syscall.EINTR) || calls != 4 {
+			t.Errorf("retry = %v after %d calls, want EINTR after 4", err, calls)
+		}
+	})
+
+	t.Run("permanent_errors_fail_at_once", func(t *testing.T) {
+		calls := 0
+		err := m.retry("src", "dst", func() error {
+			calls++
+			return os.ErrPermission
+		})
+		if !errors.Is(err, os.ErrPermission) || calls != 1 {
+			t.Errorf("retry = %v after %d calls, want permission error after 1", err, calls)
+		}
+	})
+
+	if stats.Retries != 5 {
+		t.Errorf("Retries = %d, want 5", stats.Retries)
+	}
+}
+
+func TestDirTimes(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, root := range []string{src, dst} {
+		if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	for _, dir := range []string{"a", filepath.Join("a", "b")} {
+		if err := os.Chtimes(filepath.Join(src, dir), mtime, mtime); err != nil {
+			t.Fatalf("Failed to set times: %v", err)
+		}
+	}
+
+	job := func(rel string) Job {
+		return Job{SourcePath: filepath.Join(src, rel), TargetPath: filepath.Join(dst, rel)}
+	}
+	dirs := newDirTracker()
+	dirs.track(job("a").SourcePath, job("a").TargetPath, statFile(t, filepath.Join(src, "a")), dirRestoreTimes)
+	dirs.finish(job("a"), 2)
+	dirs.track(job("a/b").SourcePath, job("a/b").TargetPath, statFile(t, filepath.Join(src, "a", "b")), dirRestoreTimes)
+	dirs.finish(job("a/b"), 1)
+	dirs.finish(job("a/file1"), 0)
+
+	// a still waits for b, which waits for its file
+	createFile(t, filepath.Join(dst, "a", "b", "file2"), "moved")
+	if statFile(t, filepath.Join(dst, "a")).ModTime().Equal(mtime) {
+		t.Fatal("Times of a restored before its subtree was done")
+	}
+
+	done := dirs.finish(job("a/b/file2"), 0)
+	if len(done.errs) != 0 {
+		t.Fatalf("finish failed: %v", done.errs)
+	}
+	want := []string{job("a/b/file2").SourcePath, job("a/b").SourcePath, job("a").SourcePath}
+	if !slices.Equal(done.completed, want) {
+		t.Errorf("completed = %v, want %v", done.completed, want)
+	}
+	for _, dir := range []string{"a", filepath.Join("a", "b")} {
+		if got := statFile(t, filepath.Join(dst, dir)).ModTime(); !got.Equal(mtime) {
+			t.Errorf("Mtime of %s = %v, want %v", dir, got, mtime)
+		}
+	}
+}
+
+func TestSyncDirPerms(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry_run=%v", dryRun), func(t *testing.T) {
+			src := t.TempDir()
+			dst := t.TempDir()
+			createFile(t, filepath.Join(src, "d", "file.txt"), "source")
+			createFile(t, filepath.Join(dst, "d", "existing.txt"), "target")
+			if err := os.Chmod(filepath.Join(src, "d"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(filepath.Join(dst, "d"), 0700); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := Options{Workers: 2, SyncDirPerms: true, DryRun: dryRun, Output: OutputJSON}
+			result, err := Move(context.Background(), []string{src}, dst, opts)
+			if err != nil {
+				t.Fatalf("Move failed: %v", err)
+			}
+			if result.DirModesSynced != 1 {
+				t.Errorf("DirModesSynced = %d, want 1", result.DirModesSynced)
+			}
+
+			want := os.FileMode(0755)
+			if dryRun {
+				want = 0700
+			}
+			if got := statFile(t, filepath.Join(dst, "d")).Mode().Perm(); got != want {
+				t.Errorf("Mode of merged directory = %#o, want %#o", got, want)
+			}
+		})
+	}
+}
+
+func TestSkipReasons(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a.txt"), "source")
+	createFile(t, filepath.Join(src, "b.txt"), "source")
+	createFile(t, filepath.Join(src, "c.tmp"), "source")
+	createFile(t, filepath.Join(src, "sub", "d.tmp"), "source")
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, filepath.Join(dst, "a.txt"), "target")
+	createFile(t, filepath.Join(dst, "b.txt"), "target")
+	createFile(t, filepath.Join(dst, "sub", "keep.txt"), "target")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Exclude: []string{"*.tmp"}})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	want := SkipCounts{SkipExists: 2, SkipFiltered: 2, SkipSymlink: 1}
+	if result.Skipped != want {
+		t.Errorf("Skipped = %v, want %v", result.Skipped.String(), want.String())
+	}
+	if got := result.Skipped.String(); got != "2 exists, 2 filtered, 1 symlink" {
+		t.Errorf("Skipped.String() = %q", got)
+	}
+
+	data, err := json.Marshal(result.Skipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"exists":2,"filtered":2,"symlink":1}` {
+		t.Errorf("JSON = %s", data)
+	}
+	var decoded SkipCounts
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != want {
+		t.Errorf("Unmarshal = %v, %v; want %v", decoded.String(), err, want.String())
+	}
+}
+
+func TestCaseCollisions(t *testing.T) {
+	if insensitive, err := caseInsensitive(t.TempDir()); err != nil || insensitive {
+		t.Skipf("Temporary directory is not case-sensitive (%v)", err)
+	}
+
+	for _, policy := range []string{CaseCollisionError, CaseCollisionKeep} {
+		t.Run(policy, func(t *testing.T) {
+			src := t.TempDir()
+			dst := t.TempDir()
+			createFile(t, filepath.Join(src, "File.txt"), "upper")
+			createFile(t, filepath.Join(src, "file.txt"), "lower")
+			createFile(t, filepath.Join(src, "other.txt"), "other")
+
+			// Pretend the target ignores case; only the probe looks at the filesystem
+			stats := &Statistics{}
+			m := &mover{opts: &Options{CaseCollisions: policy}, stats: stats, foldCase: map[string]bool{dst: true}}
+			pending := []Job{{SourcePath: src, TargetPath: dst, SourceRoot: src, TargetRoot: dst}}
+			for len(pending) > 0 {
+				job := pending[0]
+				pending = append(pending[1:], m.processPath(job)...)
+			}
+
+			assertFileContent(t, filepath.Join(dst, "other.txt"), "other")
+			assertNotExists(t, filepath.Join(dst, "file.txt"))
+			if policy == CaseCollisionKeep {
+				assertFileContent(t, filepath.Join(dst, "File.txt"), "upper")
+				if stats.Skipped[SkipCaseCollision] != 1 || stats.Errors != 0 {
+					t.Errorf("Skipped = %s, Errors = %d; want 1 case collision, 0", stats.Skipped.String(), stats.Errors)
+				}
+				return
+			}
+			assertNotExists(t, filepath.Join(dst, "File.txt"))
+			if stats.Errors != 2 {
+				t.Errorf("Errors = %d, want 2", stats.Errors)
+			}
+			for _, f := range m.failures.list() {
+				if !errors.Is(f.Err, errCaseCollision) {
+					t.Errorf("Failure %v is not a case collision", f)
+				}
+			}
+		})
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a", "b", "photo.jpg"), "deep")
+	createFile(t, filepath.Join(src, "c", "photo.jpg"), "shallow")
+	createFile(t, filepath.Join(src, "c", "notes.txt"), "notes")
+	createFile(t, filepath.Join(src, "top.txt"), "top")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 4, Flatten: true, ConflictRename: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if result.FilesMoved != 4 || result.FilesRenamed != 1 || result.DirsCreated != 0 {
+		t.Errorf("FilesMoved = %d, FilesRenamed = %d, DirsCreated = %d; want 4, 1, 0", result.FilesMoved, result.FilesRenamed, result.DirsCreated)
+	}
+
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			t.Errorf("Directory %s created in flattened target", e.Name())
+		}
+		names = append(names, e.Name())
+	}
+	if want := []string{"notes.txt", "photo (1).jpg", "photo.jpg", "top.txt"}; !slices.Equal(names, want) {
+		t.Errorf("Target holds %v, want %v", names, want)
+	}
+	assertFileContent(t, filepath.Join(dst, "top.txt"), "top")
+
+	// Without a conflict option the second file of a name stays behind
+	src = t.TempDir()
+	createFile(t, filepath.Join(src, "x", "top.txt"), "again")
+	result, err = Move(context.Background(), []string{src}, dst, Options{Flatten: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if result.Skipped[SkipExists] != 1 {
+		t.Errorf("Skipped = %s, want 1 exists", result.Skipped.String())
+	}
+	assertFileContent(t, filepath.Join(src, "x", "top.txt"), "again")
+}
+
+func TestTargetNameTransform(t *testing.T) {
+	affix := AffixName("2024-01-01_", "_old")
+	for rel, want := range map[string]string{
+		"report.txt":     "2024-01-01_report_old.txt",
+		"dir/a.tar.gz":   "2024-01-01_a.tar_old.gz",
+		".bashrc":        "2024-01-01_.bashrc_old",
+		"dir/sub/README": "2024-01-01_README_old",
+	} {
+		if got := affix(rel); got != want {
+			t.Errorf("AffixName(%q) = %q, want %q", rel, got, want)
+		}
+	}
+
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "docs", "report.txt"), "report")
+	createFile(t, filepath.Join(src, "top.txt"), "top")
+	createFile(t, filepath.Join(dst, "snap_top.txt"), "existing")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, TargetNameTransform: AffixName("snap_", "")})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dst, "docs", "snap_report.txt"), "report")
+	assertNotExists(t, filepath.Join(dst, "docs", "report.txt"))
+	// A transformed name already at the target is a conflict
+	assertFileContent(t, filepath.Join(dst, "snap_top.txt"), "existing")
+	assertFileContent(t, filepath.Join(src, "top.txt"), "top")
+	if result.Skipped[SkipExists] != 1 {
+		t.Errorf("Skipped = %s, want 1 exists", result.Skipped.String())
+	}
+
+	// Names that collide after the transform are resolved in turn
+	src = t.TempDir()
+	dst = t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		createFile(t, filepath.Join(src, name), name)
+	}
+	same := func(string) string { return "same.txt" }
+	result, err = Move(context.Background(), []string{src}, dst, Options{Workers: 4, TargetNameTransform: same, ConflictRename: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if result.FilesMoved != 3 || result.FilesRenamed != 2 {
+		t.Errorf("FilesMoved = %d, FilesRenamed = %d; want 3 and 2", result.FilesMoved, result.FilesRenamed)
+	}
+	for _, name := range []string{"same.txt", "same (1).txt", "same (2).txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("Missing %s: %v", name, err)
+		}
+	}
+
+	// A name that would leave the directory is refused
+	src = t.TempDir()
+	createFile(t, filepath.Join(src, "f.txt"), "f")
+	escape := func(string) string { return "../f.txt" }
+	_, err = Move(context.Background(), []string{src}, t.TempDir(), Options{Workers: 1, TargetNameTransform: escape})
+	if !errors.Is(err, errBadTargetName) {
+		t.Errorf("Move = %v, want errBadTargetName", err)
+	}
+	assertFileContent(t, filepath.Join(src, "f.txt"), "f")
+}
+
+func TestSummary(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "photos", "2023", "jan", "a.jpg"), "aaaa")
+	createFile(t, filepath.Join(src, "photos", "2023", "feb.jpg"), "bb")
+	createFile(t, filepath.Join(src, "photos", "2024", "c.jpg"), "c")
+	createFile(t, filepath.Join(src, "docs", "new"), "d")
+	createFile(t, filepath.Join(src, "top.txt"), "top")
+	for _, dir := range []string{"photos/2023", "photos/2024", "docs"} {
+		if err := os.MkdirAll(filepath.Join(dst, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, SummaryDepth: 2, CountDirBytes: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	result.PrintSummary(&buf)
+	// jan was renamed as a whole and sits below the summary's depth
+	want := dst + "  5 moved, 11 bytes\n" +
+		"├── photos  3 moved, 7 bytes\n" +
+		"│   ├── 2023  2 moved, 6 bytes\n" +
+		"│   └── 2024  1 moved, 1 bytes\n" +
+		"└── docs  1 moved, 1 bytes\n"
+	if buf.String() != want {
+		t.Errorf("Summary:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	result, err = Move(context.Background(), []string{t.TempDir()}, dst, Options{})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if result.Summary != nil {
+		t.Errorf("Summary kept without SummaryDepth: %v", result.Summary)
+	}
+}
+
+func TestMissingTargets(t *testing.T) {
+	t.Run("merge_lists_target", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("renameat2 is Linux only")
+		}
+		src := t.TempDir()
+		dst := t.TempDir()
+		for i := 0; i < 20; i++ {
+			createFile(t, filepath.Join(src, "dir", fmt.Sprintf("file%02d.txt", i)), "new")
+		}
+		createFile(t, filepath.Join(dst, "dir", "file00.txt"), "old")
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{NoReplace: true, Quiet: true})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+		// The root, dir and the one file already there
+		if n := result.targetStats; n != 3 {
+			t.Errorf("Stated %d targets, want 3", n)
+		}
+		assertFileContent(t, filepath.Join(dst, "dir", "file00.txt"), "old")
+		assertFileContent(t, filepath.Join(dst, "dir", "file19.txt"), "new")
+	})
+
+	t.Run("merge_without_no_replace", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		for i := 0; i < 20; i++ {
+			createFile(t, filepath.Join(src, "dir", fmt.Sprintf("file%02d.txt", i)), "new")
+		}
+		createFile(t, filepath.Join(dst, "dir", "file00.txt"), "old")
+
+		// A plain rename would replace a file created in the merged
+		// directory after a listing, so every target is stated
+		result, err := Move(context.Background(), []string{src}, dst, Options{Quiet: true})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+		if n := result.targetStats; n != 22 {
+			t.Errorf("Stated %d targets, want 22", n)
+		}
+		assertFileContent(t, filepath.Join(dst, "dir", "file00.txt"), "old")
+	})
+
+	t.Run("created_dir", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "dir", "a.txt"), "a")
+		createFile(t, filepath.Join(src, "dir", "sub", "b.txt"), "b")
+		createFile(t, filepath.Join(src, "dir", "c.tmp"), "c")
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Exclude: []string{"*.tmp"}, Quiet: true})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+		if n := result.targetStats; n != 2 {
+			t.Errorf("Stated %d targets, want 2", n)
+		}
+		assertFileContent(t, filepath.Join(dst, "dir", "sub", "b.txt"), "b")
+		assertFileContent(t, filepath.Join(src, "dir", "c.tmp"), "c")
+	})
+
+	t.Run("sync_dir_perms", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "dir", "a.txt"), "a")
+		createFile(t, filepath.Join(dst, "dir", "b.txt"), "b")
+		if err := os.Chmod(filepath.Join(dst, "dir"), 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		// The merged directories reuse the stat that found them
+		result, err := Move(context.Background(), []string{src}, dst, Options{SyncDirPerms: true, Quiet: true})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+		if n := result.targetStats; n != 3 {
+			t.Errorf("Stated %d targets, want 3", n)
+		}
+		if mode := statFile(t, filepath.Join(dst, "dir")).Mode().Perm(); mode != 0755 {
+			t.Errorf("Target directory mode = %#o, want 0755", mode)
+		}
+	})
+
+	t.Run("shared_target", func(t *testing.T) {
+		src1 := t.TempDir()
+		src2 := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src1, "dir", "a.txt"), "1")
+		createFile(t, filepath.Join(src1, "dir", "b.tmp"), "1")
+		createFile(t, filepath.Join(src2, "dir", "a.txt"), "2")
+
+		// Either source may create dir, so the other's files must be stated
+		if _, err := Move(context.Background(), []string{src1, src2}, dst, Options{Exclude: []string{"*.tmp"}, Workers: 1, Quiet: true}); err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+		assertFileContent(t, filepath.Join(dst, "dir", "a.txt"), "1")
+		assertFileContent(t, filepath.Join(src2, "dir", "a.txt"), "2")
+	})
+}
+
+func TestAutoWorkers(t *testing.T) {
+	if _, ok := rotational(filepath.Join(t.TempDir(), "missing")); ok {
+		t.Error("rotational reported a storage type for a missing path")
+	}
+
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "file.txt"), "content")
+
+	seeds := []Job{{SourcePath: src, TargetPath: dst, SourceRoot: src, TargetRoot: dst}}
+	workers, rot := autoWorkers(seeds)
+	want := runtime.NumCPU()
+	if rot {
+		want = rotationalWorkers
+	}
+	if workers != want {
+		t.Errorf("autoWorkers = %d (rotational %v), want %d", workers, rot, want)
+	}
+
+	if _, err := Move(context.Background(), []string{src}, dst, Options{Workers: AutoWorkers}); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dst, "file.txt"), "content")
+}
+
+func TestCountDirBytes(t *testing.T) {
+	for _, count := range []bool{false, true} {
+		t.Run(fmt.Sprintf("count=%v", count), func(t *testing.T) {
+			src := t.TempDir()
+			dst := t.TempDir()
+			createFile(t, filepath.Join(src, "dir", "a.txt"), "12345")
+			createFile(t, filepath.Join(src, "dir", "sub", "b.txt"), "123")
+			createFile(t, filepath.Join(src, "c.txt"), "12")
+
+			result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, CountDirBytes: count})
+			if err != nil {
+				t.Fatalf("Move failed: %v", err)
+			}
+			want := int64(2)
+			if count {
+				want = 10
+			}
+			if result.DirsRenamed != 1 || result.BytesMoved != want {
+				t.Errorf("DirsRenamed = %d, BytesMoved = %d; want 1, %d", result.DirsRenamed, result.BytesMoved, want)
+			}
+		})
+	}
+}
+
+func TestCheckSpace(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a", "new.txt"), "12345")
+	createFile(t, filepath.Join(src, "a", "old.txt"), "123")
+	createFile(t, filepath.Join(src, "skip.tmp"), "12")
+	createFile(t, filepath.Join(dst, "a", "old.txt"), "target")
+
+	seed := Job{SourcePath: src, TargetPath: dst, SourceRoot: src, TargetRoot: dst}
+	m := &mover{opts: &Options{AllowCrossDevice: true, Exclude: []string{"*.tmp"}}, stats: &Statistics{}}
+	if got := m.copySize(seed); got != 5 {
+		t.Errorf("copySize = %d, want 5", got)
+	}
+	m.opts.Overwrite = true
+	if got := m.copySize(seed); got != 8 {
+		t.Errorf("copySize with Overwrite = %d, want 8", got)
+	}
+
+	// Renames within a filesystem need no room
+	if err := m.checkSpace([]Job{seed}); err != nil {
+		t.Errorf("checkSpace on one filesystem: %v", err)
+	}
+
+	other, err := os.MkdirTemp("/dev/shm", "mvmv-test-")
+	if err != nil {
+		t.Skipf("No second filesystem: %v", err)
+	}
+	defer os.RemoveAll(other)
+	srcDev, _ := deviceID(statFile(t, src))
+	otherDev, _ := deviceID(statFile(t, other))
+	avail, ok := availableSpace(other)
+	if !ok || srcDev == otherDev {
+		t.Skip("No second filesystem with known free space")
+	}
+	f, err := os.Create(filepath.Join(src, "big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(int64(avail) + 1); err != nil {
+		t.Skipf("Cannot create a sparse file: %v", err)
+	}
+
+	_, err = Move(context.Background(), []string{src}, other, Options{AllowCrossDevice: true, CheckSpace: true})
+	if err == nil || !strings.Contains(err.Error(), "not enough space") {
+		t.Errorf("Move = %v, want a lack of space", err)
+	}
+	assertFileContent(t, filepath.Join(src, "a", "new.txt"), "12345")
+}
+
+func TestValidationErrors(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	_, err := Move(context.Background(), []string{filepath.Join(src, "missing")}, dst, Options{})
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Move with a missing source = %v, want a PathError", err)
+	}
+
+	_, err = Move(context.Background(), []string{src}, dst, Options{Quiet: true, Verbose: true})
+	var optsErr *OptionsError
+	if !errors.As(err, &optsErr) {
+		t.Errorf("Move with conflicting options = %v, want an OptionsError", err)
+	}
+
+	_, err = Shard(context.Background(), src, []string{filepath.Join(src, "inside")}, Options{})
+	if !errors.As(err, &pathErr) {
+		t.Errorf("Shard into its source = %v, want a PathError", err)
+	}
+}
+
+func TestShowConflicts(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "new.txt"), "new")
+	createFile(t, filepath.Join(src, "sub", "same.txt"), "same")
+	createFile(t, filepath.Join(dst, "sub", "same.txt"), "same")
+	createFile(t, filepath.Join(src, "sub", "changed.txt"), "longer source")
+	createFile(t, filepath.Join(dst, "sub", "changed.txt"), "target")
+	createFile(t, filepath.Join(src, "dir"), "file")
+	if err := os.Mkdir(filepath.Join(dst, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, path := range []string{filepath.Join(src, "sub", "same.txt"), filepath.Join(dst, "sub", "same.txt"), filepath.Join(dst, "sub", "changed.txt")} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	stats := &Statistics{}
+	m := &mover{opts: &Options{DryRun: true, ShowConflicts: true, Output: OutputJSON}, stats: stats, out: newJSONOutput(&buf)}
+	pending := []Job{{SourcePath: src, TargetPath: dst, SourceRoot: src, TargetRoot: dst}}
+	for len(pending) > 0 {
+		job := pending[0]
+		pending = append(pending[1:], m.processPath(job)...)
+	}
+
+	got := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var ev opEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("Invalid event %q: %v", line, err)
+		}
+		if ev.Op != "conflict" {
+			t.Errorf("Unexpected %s event for %s", ev.Op, ev.Source)
+		}
+		got[ev.Source] = ev.Reason
+	}
+	want := map[string]string{
+		filepath.Join(src, "sub", "same.txt"):    "same size, same time",
+		filepath.Join(src, "sub", "changed.txt"): "size 13 vs 6 bytes, source newer",
+		filepath.Join(src, "dir"):                "target is a directory",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("Conflicts = %v, want %v", got, want)
+	}
+	if stats.FileConflicts != 3 {
+		t.Errorf("FileConflicts = %d, want 3", stats.FileConflicts)
+	}
+
+	if _, err := Move(context.Background(), []string{src}, dst, Options{ShowConflicts: true}); err == nil {
+		t.Error("ShowConflicts without DryRun was accepted")
+	}
+}
+
+func TestShowSkipped(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "new.txt"), "new")
+	createFile(t, filepath.Join(src, "excluded.tmp"), "excluded")
+	createFile(t, filepath.Join(src, "sub", "same.txt"), "same")
+	createFile(t, filepath.Join(dst, "sub", "same.txt"), "same")
+	createFile(t, filepath.Join(src, "sub", "newer.txt"), "longer source")
+	createFile(t, filepath.Join(dst, "sub", "newer.txt"), "target")
+	createFile(t, filepath.Join(src, "dir"), "file")
+	if err := os.Mkdir(filepath.Join(dst, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, path := range []string{filepath.Join(src, "sub", "same.txt"), filepath.Join(dst, "sub", "same.txt"), filepath.Join(dst, "sub", "newer.txt")} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The newer file would be overwritten, so only the others are listed
+	var buf bytes.Buffer
+	opts := &Options{DryRun: true, ShowSkipped: true, OverwriteNewer: true, Exclude: []string{"*.tmp"}, Output: OutputJSON}
+	m := &mover{opts: opts, stats: &Statistics{}, out: newJSONOutput(&buf)}
+	pending := []Job{{SourcePath: src, TargetPath: dst, SourceRoot: src, TargetRoot: dst}}
+	for len(pending) > 0 {
+		job := pending[0]
+		pending = append(pending[1:], m.processPath(job)...)
+	}
+
+	got := make(map[string]opEvent)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var ev opEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("Invalid event %q: %v", line, err)
+		}
+		got[ev.Source] = ev
+	}
+	want := map[string]opEvent{
+		filepath.Join(src, "dir"):             {Op: "skipped", Target: filepath.Join(dst, "dir"), Reason: "target is a directory"},
+		filepath.Join(src, "sub", "same.txt"): {Op: "skipped", Target: filepath.Join(dst, "sub", "same.txt"), Reason: "target not older", Diff: "same size, same time"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("Got %d events, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for source, w := range want {
+		w.Source = source
+		if got[source] != w {
+			t.Errorf("Event for %s = %+v, want %+v", source, got[source], w)
+		}
+	}
+	if line := planLine(got[filepath.Join(src, "sub", "same.txt")]); !strings.HasSuffix(line, "(target not older: same size, same time)") {
+		t.Errorf("Plan line %q lacks the difference", line)
+	}
+
+	for _, bad := range []Options{{ShowSkipped: true}, {DryRun: true, ShowSkipped: true, ShowConflicts: true}} {
+		if _, err := Move(context.Background(), []string{src}, dst, bad); err == nil {
+			t.Errorf("Options %+v were accepted", bad)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a", "b", "file1.txt"), "source")
+	createFile(t, filepath.Join(src, "c", "file2.txt"), "source")
+	createFile(t, filepath.Join(src, "file3.txt"), "source")
+	createFile(t, filepath.Join(dst, "a", "existing.txt"), "target")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, MaxDepth: 1, DeleteSourceOnSuccess: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if result.DirConflicts != 1 || result.DirsRenamed != 1 || result.FilesMoved != 1 {
+		t.Errorf("DirConflicts = %d, DirsRenamed = %d, FilesMoved = %d; want 1, 1, 1", result.DirConflicts, result.DirsRenamed, result.FilesMoved)
+	}
+
+	// The conflicting directory stays in the source, which isn't deleted
+	assertFileContent(t, filepath.Join(src, "a", "b", "file1.txt"), "source")
+	assertNotExists(t, filepath.Join(dst, "a", "b"))
+	assertFileContent(t, filepath.Join(dst, "c", "file2.txt"), "source")
+	assertFileContent(t, filepath.Join(dst, "file3.txt"), "source")
+
+	// One level deeper the same directory is merged
+	result, err = Move(context.Background(), []string{src}, dst, Options{Workers: 2, MaxDepth: 2})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if result.DirConflicts != 0 || result.DirsMerged != 2 {
+		t.Errorf("DirConflicts = %d, DirsMerged = %d; want 0, 2", result.DirConflicts, result.DirsMerged)
+	}
+	assertFileContent(t, filepath.Join(dst, "a", "b", "file1.txt"), "source")
+}
+
+func TestPruneEmpty(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "a", "b", "c", "file1.txt"), "source")
+	createFile(t, filepath.Join(src, "a", "d", "file2.txt"), "source")
+	createFile(t, filepath.Join(src, "keep", "file3.txt"), "source")
+	createFile(t, filepath.Join(src, "file4.txt"), "source")
+	createFile(t, filepath.Join(dst, "a", "d", "placeholder"), "target")
+	createFile(t, filepath.Join(dst, "keep", "file3.txt"), "target")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 4, Buffer: 10000, PruneEmpty: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	// a and a/d were merged and emptied; keep still holds the skipped file
+	assertNotExists(t, filepath.Join(src, "a"))
+	assertFileContent(t, filepath.Join(src, "keep", "file3.txt"), "source")
+	assertFileContent(t, filepath.Join(dst, "a", "b", "c", "file1.txt"), "source")
+	assertFileContent(t, filepath.Join(dst, "a", "d", "file2.txt"), "source")
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("Source root was removed: %v", err)
+	}
+	if result.DirsPruned != 2 {
+		t.Errorf("DirsPruned = %d, want 2", result.DirsPruned)
+	}
+}
+
+func TestDirMode(t *testing.T) {
+	src := t.TempDir()
+	createFile(t, filepath.Join(src, "a", "file.txt"), "data")
+	if err := os.Chmod(filepath.Join(src, "a"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// The umask would take group write away from directories created as
+	// well as the target's
+	parent := t.TempDir()
+	target := filepath.Join(parent, "new", "deeper")
+	opts := Options{CreateTarget: true, KeepTree: true, DirMode: 0770, Quiet: true}
+	if _, err := Move(context.Background(), []string{src}, target, opts); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	for _, dir := range []string{"new", filepath.Join("new", "deeper"), filepath.Join("new", "deeper", "a")} {
+		if mode := statFile(t, filepath.Join(parent, dir)).Mode().Perm(); mode != 0770 {
+			t.Errorf("Mode of %s = %#o, want 0770", dir, mode)
+		}
+	}
+	assertFileContent(t, filepath.Join(target, "a", "file.txt"), "data")
+
+	sub, err := TargetSubdir(target, filepath.Join("in", "box"), Options{DirMode: 0711})
+	if err != nil {
+		t.Fatalf("TargetSubdir failed: %v", err)
+	}
+	for _, dir := range []string{filepath.Dir(sub), sub} {
+		if mode := statFile(t, dir).Mode().Perm(); mode != 0711 {
+			t.Errorf("Mode of %s = %#o, want 0711", dir, mode)
+		}
+	}
+}
+
+func TestKeepTree(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	createFile(t, filepath.Join(src, "a", "b", "file1.txt"), "source")
+	createFile(t, filepath.Join(src, "a", "file2.txt"), "source")
+	createFile(t, filepath.Join(src, "c", "file3.txt"), "source")
+	createFile(t, filepath.Join(dst, "c", "other.txt"), "target")
+	if err := os.Mkdir(filepath.Join(src, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, KeepTree: true, Quiet: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	// Only a keeps an entry, its subdirectory b
+	for dir, want := range map[string]int{"a": 1, filepath.Join("a", "b"): 0, "c": 0, "empty": 0} {
+		entries, err := os.ReadDir(filepath.Join(src, dir))
+		if err != nil || len(entries) != want {
+			t.Errorf("Source directory %s has %d entries (%v), want %d", dir, len(entries), err, want)
+		}
+		assertDirExists(t, filepath.Join(dst, dir))
+	}
+	assertFileContent(t, filepath.Join(dst, "a", "b", "file1.txt"), "source")
+	assertFileContent(t, filepath.Join(dst, "a", "file2.txt"), "source")
+	assertFileContent(t, filepath.Join(dst, "c", "file3.txt"), "source")
+	if result.DirsRenamed != 0 || result.DirsCreated != 3 || result.FilesMoved != 3 {
+		t.Errorf("DirsRenamed = %d, DirsCreated = %d, FilesMoved = %d; want 0, 3, 3", result.DirsRenamed, result.DirsCreated, result.FilesMoved)
+	}
+
+	_, err = Move(context.Background(), []string{src}, dst, Options{KeepTree: true, PruneEmpty: true})
+	var optsErr *OptionsError
+	if !errors.As(err, &optsErr) {
+		t.Errorf("Expected an OptionsError with PruneEmpty, got %v", err)
+	}
+}
+
+func TestLargeDirectory(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	// Enough entries to be queued in several chunks while being read
+	n := 2*dirChunk + 100
+	for i := range n {
+		createFile(t, filepath.Join(src, "big", fmt.Sprintf("file%05d.txt", i)), "source")
+	}
+	createFile(t, filepath.Join(src, "big", "sub", "nested.txt"), "source")
+	createFile(t, filepath.Join(dst, "big", "other.txt"), "target")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 8, PruneEmpty: true, Quiet: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if result.FilesMoved != int64(n) || result.DirsRenamed != 1 {
+		t.Errorf("FilesMoved = %d, DirsRenamed = %d; want %d, 1", result.FilesMoved, result.DirsRenamed, n)
+	}
+	entries, err := os.ReadDir(filepath.Join(dst, "big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != n+2 {
+		t.Errorf("Target has %d entries, want %d", len(entries), n+2)
+	}
+	assertFileContent(t, filepath.Join(dst, "big", "sub", "nested.txt"), "source")
+
+	// Pruning waits for the children of every chunk, not just the last
+	assertNotExists(t, filepath.Join(src, "big"))
+	if result.DirsPruned != 1 {
+		t.Errorf("DirsPruned = %d, want 1", result.DirsPruned)
+	}
+}
+
+func TestDeleteSourceOnSuccess(t *testing.T) {
+	t.Run("removes_source", func(t *testing.T) {
+		parent := t.TempDir()
+		src := filepath.Join(parent, "src")
+		dst := t.TempDir()
+
+		createFile(t, filepath.Join(src, "dir", "new.txt"), "new")
+		createFile(t, filepath.Join(src, "top.txt"), "top")
+		createFile(t, filepath.Join(dst, "dir", "other.txt"), "other")
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, DeleteSourceOnSuccess: true})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		assertNotExists(t, src)
+		assertFileContent(t, filepath.Join(dst, "dir", "new.txt"), "new")
+		if result.SourcesDeleted != 1 {
+			t.Errorf("SourcesDeleted = %d, want 1", result.SourcesDeleted)
+		}
+	})
+
+	t.Run("keeps_skipped_files", func(t *testing.T) {
+		parent := t.TempDir()
+		src := filepath.Join(parent, "src")
+		dst := t.TempDir()
+
+		createFile(t, filepath.Join(src, "dir", "new.txt"), "new")
+		createFile(t, filepath.Join(src, "existing.txt"), "source")
+		createFile(t, filepath.Join(dst, "existing.txt"), "target")
+		createFile(t, filepath.Join(dst, "dir", "other.txt"), "other")
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, DeleteSourceOnSuccess: true})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		// The skipped file stays, the directory emptied by the move doesn't
+		assertFileContent(t, filepath.Join(src, "existing.txt"), "source")
+		assertNotExists(t, filepath.Join(src, "dir"))
+		assertFileContent(t, filepath.Join(dst, "dir", "new.txt"), "new")
+		assertFileContent(t, filepath.Join(dst, "existing.txt"), "target")
+		if result.SourcesDeleted != 0 {
+			t.Errorf("SourcesDeleted = %d, want 0", result.SourcesDeleted)
+		}
+	})
+
+	t.Run("keeps_unsettled_watch_files", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "early.txt"), "early")
+
+		done := make(chan error, 1)
+		go func() {
+			opts := Options{Workers: 2, Watch: time.Second, WatchSettle: 10 * time.Second, DeleteSourceOnSuccess: true, Quiet: true}
+			_, err := Move(context.Background(), []string{src}, dst, opts)
+			done <- err
+		}()
+		time.Sleep(300 * time.Millisecond)
+		// Still being written, as far as the watch can tell, when it ends
+		createFile(t, filepath.Join(src, "writing.txt"), "partial")
+
+		if err := <-done; err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+		assertFileContent(t, filepath.Join(dst, "early.txt"), "early")
+		assertFileContent(t, filepath.Join(src, "writing.txt"), "partial")
+	})
+
+	t.Run("keeps_source_after_errors", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		createFile(t, filepath.Join(src, "a", "file.txt"), "content")
+		createFile(t, filepath.Join(dst, "a"), "not a directory")
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, DeleteSourceOnSuccess: true})
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+
+		assertFileContent(t, filepath.Join(src, "a", "file.txt"), "content")
+		if result.SourcesDeleted != 0 {
+			t.Errorf("SourcesDeleted = %d, want 0", result.SourcesDeleted)
+		}
+	})
+
+	t.Run("dry_run_keeps_source", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		createFile(t, filepath.Join(src, "file.txt"), "content")
+
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, DryRun: true, DeleteSourceOnSuccess: true})
+		if err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(src, "file.txt"), "content")
+		if result.SourcesDeleted != 1 {
+			t.Errorf("SourcesDeleted = %d, want 1", result.SourcesDeleted)
+		}
+	})
+}
+
+func TestCheckpoint(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	createFile(t, filepath.Join(src, "file.txt"), "file")
+	createFile(t, filepath.Join(src, "tree", "nested.txt"), "nested")
+	createFile(t, filepath.Join(src, "merged", "ok.txt"), "ok")
+	createFile(t, filepath.Join(dst, "merged", "existing.txt"), "existing")
+	// A file where a directory is expected makes everything below bad fail
+	createFile(t, filepath.Join(src, "bad", "sub", "x.txt"), "x")
+	createFile(t, filepath.Join(dst, "bad", "sub"), "in the way")
+
+	opts := Options{Workers: 4, Buffer: 10000, CheckpointPath: checkpointPath}
+	if _, err := Move(context.Background(), []string{src}, dst, opts); err == nil {
+		t.Fatal("Expected an error for bad")
+	}
+
+	completed, err := loadCheckpoint(checkpointPath)
+	if err != nil {
+		t.Fatalf("loadCheckpoint failed: %v", err)
+	}
+	slices.Sort(completed)
+	want := []string{filepath.Join(src, "file.txt"), filepath.Join(src, "merged"), filepath.Join(src, "tree")}
+	if !slices.Equal(completed, want) {
+		t.Errorf("Checkpoint = %v, want %v", completed, want)
+	}
+
+	// Resuming skips the completed paths, even ones with entries left in them
+	createFile(t, filepath.Join(src, "merged", "late.txt"), "late")
+	os.Remove(filepath.Join(dst, "bad", "sub"))
+	opts.Resume = true
+	result, err := Move(context.Background(), []string{src}, dst, opts)
+	if err != nil {
+		t.Fatalf("Resumed move failed: %v", err)
+	}
+	if result.Resumed != 1 {
+		t.Errorf("Resumed = %d, want 1", result.Resumed)
+	}
+	assertFileContent(t, filepath.Join(src, "merged", "late.txt"), "late")
+	assertFileContent(t, filepath.Join(dst, "bad", "sub", "x.txt"), "x")
+
+	completed, err = loadCheckpoint(checkpointPath)
+	if err != nil {
+		t.Fatalf("loadCheckpoint failed: %v", err)
+	}
+	if !slices.Equal(completed, []string{src}) {
+		t.Errorf("Checkpoint after resuming = %v, want only %s", completed, src)
+	}
+
+	if _, err := Move(context.Background(), []string{src}, dst, Options{Resume: true}); err == nil {
+		t.Error("Expected an error resuming without a checkpoint file")
+	}
+}
+
+func TestShard(t *testing.T) {
+	t.Run("round_robin_distributes_top_level_entries", func(t *testing.T) {
+		src := t.TempDir()
+		dst1 := t.TempDir()
+		dst2 := t.TempDir()
+
+		createFile(t, filepath.Join(src, "a", "file.txt"), "a")
+		createFile(t, filepath.Join(src, "b", "file.txt"), "b")
+		createFile(t, filepath.Join(src, "c.txt"), "c")
+
+		_, err := Shard(context.Background(), src, []string{dst1, dst2}, Options{Workers: 2, Buffer: 10000})
+		if err != nil {
+			t.Fatalf("Shard failed: %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(dst1, "a", "file.txt"), "a")
+		assertFileContent(t, filepath.Join(dst2, "b", "file.txt"), "b")
+		assertFileContent(t, filepath.Join(dst1, "c.txt"), "c")
+		assertNotExists(t, filepath.Join(dst2, "a"))
+		assertNotExists(t, filepath.Join(dst1, "b"))
+	})
+
+	t.Run("left_entries_take_no_target", func(t *testing.T) {
+		src := t.TempDir()
+		dst1 := t.TempDir()
+		dst2 := t.TempDir()
+
+		createFile(t, filepath.Join(src, ignoreFileName), "b.log\n")
+		createFile(t, filepath.Join(src, "a.txt"), "a")
+		createFile(t, filepath.Join(src, "b.log"), "b")
+		createFile(t, filepath.Join(src, "c.bak"), "c")
+		createFile(t, filepath.Join(src, "d.txt"), "d")
+
+		result, err := Shard(context.Background(), src, []string{dst1, dst2}, Options{Exclude: []string{"*.bak"}, Quiet: true})
+		if err != nil {
+			t.Fatalf("Shard failed: %v", err)
+		}
+
+		want := []ShardAssignment{{Entry: "a.txt", Target: dst1}, {Entry: "d.txt", Target: dst2}}
+		if !reflect.DeepEqual(result.Shards, want) {
+			t.Errorf("Shards = %v, want %v", result.Shards, want)
+		}
+		assertFileContent(t, filepath.Join(dst1, "a.txt"), "a")
+		assertFileContent(t, filepath.Join(dst2, "d.txt"), "d")
+		assertFileContent(t, filepath.Join(src, "b.log"), "b")
+		assertFileContent(t, filepath.Join(src, "c.bak"), "c")
+		if result.FilesFiltered != 2 {
+			t.Errorf("FilesFiltered = %d, want 2", result.FilesFiltered)
+		}
+	})
+
+	t.Run("options_checked_first", func(t *testing.T) {
+		src := t.TempDir()
+		dst := filepath.Join(t.TempDir(), "new")
+		createFile(t, filepath.Join(src, "a.txt"), "a")
+
+		for _, opts := range []Options{
+			{Quiet: true, Verbose: true, CreateTarget: true},
+			{ShardBy: "random", CreateTarget: true},
+		} {
+			var optsErr *OptionsError
+			if _, err := Shard(context.Background(), src, []string{dst}, opts); !errors.As(err, &optsErr) {
+				t.Errorf("Shard with %+v = %v, want an OptionsError", opts, err)
+			}
+		}
+		assertNotExists(t, dst)
+		assertFileContent(t, filepath.Join(src, "a.txt"), "a")
+	})
+
+	t.Run("size_balances_targets", func(t *testing.T) {
+		src := t.TempDir()
+		targets := []string{"t1", "t2"}
+
+		createFile(t, filepath.Join(src, "big", "file.txt"), "0123456789")
+		createFile(t, filepath.Join(src, "mid.txt"), "012345")
+		createFile(t, filepath.Join(src, "small.txt"), "0123")
+
+		assignments := assignShards(src, []string{"big", "mid.txt", "small.txt"}, targets, ShardBySize)
+		got := make(map[string]string)
+		for _, a := range assignments {
+			got[a.Entry] = a.Target
+		}
+		if got["big"] != "t1" || got["mid.txt"] != "t2" || got["small.txt"] != "t2" {
+			t.Errorf("Unexpected assignments: %v", got)
+		}
+	})
+}
+
+func TestProgress(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	createFile(t, filepath.Join(src, "dir", "b.txt"), "bb")
+	createFile(t, filepath.Join(src, "dir", "sub", "c.txt"), "cc")
+
+	stats := &Statistics{}
+	p := scanSources([]Job{{SourcePath: src, TargetPath: dst}}, stats)
+	if stats.TotalFiles != 3 || stats.TotalBytes != 8 {
+		t.Fatalf("Totals = %d files, %d bytes; want 3 files, 8 bytes", stats.TotalFiles, stats.TotalBytes)
+	}
+
+	p.treeDone(filepath.Join(src, "dir"))
+	if got := p.files.Load(); got != 2 {
+		t.Errorf("Files done after moving dir = %d, want 2", got)
+	}
+	if line := renderProgress(p, stats, time.Second); !strings.Contains(line, " 50.0%") || !strings.Contains(line, "ETA 1s") {
+		t.Errorf("Unexpected progress line: %q", line)
+	}
+
+	p.fileDone(4)
+	if line := renderProgress(p, stats, time.Second); !strings.Contains(line, "100.0%") || !strings.Contains(line, "3/3 files") {
+		t.Errorf("Unexpected progress line: %q", line)
+	}
+
+	_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Buffer: 10000, Progress: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dst, "dir", "sub", "c.txt"), "cc")
+}
+
+func TestResourceUsage(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("resource usage is only collected on Unix")
+	}
+
+	user, system, maxRSS, ok := resourceUsage()
+	if !ok {
+		t.Fatal("Expected resource usage to be available")
+	}
+	if user+system <= 0 {
+		t.Errorf("Expected positive CPU time, got %v", user+system)
+	}
+	if maxRSS < 1024*1024 {
+		t.Errorf("Peak memory looks wrong: %d bytes", maxRSS)
+	}
+}
+
+func TestJobTracker(t *testing.T) {
+	tracker := newJobTracker(2)
+	a := Job{SourcePath: "/src/a", TargetPath: "/dst/a"}
+	b := Job{SourcePath: "/src/b", TargetPath: "/dst/b"}
+
+	tracker.queue(a)
+	tracker.queue(b)
+	tracker.start(1, a)
+
+	var buf bytes.Buffer
+	tracker.dump(&buf)
+	out := buf.String()
+
+	for _, want := range []string{"worker 0: (idle)", "worker 1: /src/a", "queued: /src/b -> /dst/b", "1 queued jobs"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Dump missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "queued: /src/a") {
+		t.Errorf("Started job still listed as queued:\n%s", out)
+	}
+
+	tracker.finish(1)
+	buf.Reset()
+	tracker.dump(&buf)
+	if !strings.Contains(buf.String(), "worker 1: (idle)") {
+		t.Errorf("Finished worker not idle:\n%s", buf.String())
+	}
+}
+
+func TestErrorLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := newErrorLog(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	denied := &os.PathError{Op: "rename", Path: "x", Err: os.ErrPermission}
+	for i := range errorBurst + 3 {
+		log.log("Failed to move file %s: %v", fmt.Sprintf("/src/file%d", i), denied)
+	}
+	log.log("Cannot stat %s: %v", "/src/other", os.ErrNotExist)
+
+	if got := strings.Count(buf.String(), "Failed to move file /src/"); got != errorBurst {
+		t.Errorf("Printed %d move errors, want %d", got, errorBurst)
+	}
+	if !strings.Contains(buf.String(), "Cannot stat /src/other") {
+		t.Errorf("Different error kind was suppressed:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	log.flush()
+	want := `level=WARN msg="Failed to move file ...: permission denied (x3 more suppressed)" suppressed=3`
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 1 || !strings.HasSuffix(lines[0], want) {
+		t.Errorf("flush() wrote %q, want one line ending in %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	log.flush()
+	if buf.Len() != 0 {
+		t.Errorf("Second flush should be empty, got %q", buf.String())
+	}
+}
+
+func TestDirStats(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "renamed", "1.txt"), "1")
+	createFile(t, filepath.Join(src, "merged", "2.txt"), "2")
+	createFile(t, filepath.Join(dst, "merged", "existing.txt"), "existing")
+	// Ignore rules force the directory to be recreated and filled file by file
+	createFile(t, filepath.Join(src, "created", ignoreFileName), "*.log\n")
+	createFile(t, filepath.Join(src, "created", "3.txt"), "3")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	// The root and merged are merged; renamed/1.txt is never looked at
+	if result.DirsChecked != 4 || result.DirsRenamed != 1 || result.DirsMerged != 2 || result.DirsCreated != 1 {
+		t.Errorf("Dirs: %d checked, %d renamed, %d merged, %d created; want 4, 1, 2, 1",
+			result.DirsChecked, result.DirsRenamed, result.DirsMerged, result.DirsCreated)
+	}
+	if result.EntriesScanned != 6 {
+		t.Errorf("EntriesScanned = %d, want 6", result.EntriesScanned)
+	}
+}
+
+func TestTimings(t *testing.T) {
+	var slowest slowestList
+	for _, ms := range []int{5, 1, 30, 12, 7, 3, 25, 9, 2, 40, 4, 8} {
+		slowest.add(OpTiming{Op: "copy", SourcePath: strconv.Itoa(ms), Duration: time.Duration(ms) * time.Millisecond})
+	}
+	var got []string
+	for _, op := range slowest.list() {
+		got = append(got, op.SourcePath)
+	}
+	if want := []string{"40", "30", "25", "12", "9", "8", "7", "5", "4", "3"}; !slices.Equal(got, want) {
+		t.Errorf("Slowest = %v, want %v", got, want)
+	}
+
+	src := t.TempDir()
+	dst := t.TempDir()
+	for i := range 12 {
+		createFile(t, filepath.Join(src, "dir", fmt.Sprintf("file%d.txt", i)), "data")
+	}
+	createFile(t, filepath.Join(dst, "dir", "other.txt"), "target")
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, Timings: true, Quiet: true})
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if len(result.Slowest) != slowestOps {
+		t.Fatalf("Slowest has %d operations, want %d", len(result.Slowest), slowestOps)
+	}
+	for i, op := range result.Slowest {
+		if op.Op != "rename" || i > 0 && op.Duration > result.Slowest[i-1].Duration {
+			t.Errorf("Slowest[%d] = %+v, want renames slowest first", i, op)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	stats := &Statistics{FilesMoved: 12, BytesMoved: 4096, Errors: 1, StartTime: time.Now().Add(-2 * time.Second)}
+	stats.Skipped[SkipExists] = 3
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := serveMetrics(l, stats)
+	defer srv.Close()
+	resp, err := http.Get("http://" + l.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("Scraping metrics failed: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(body)
+	for _, want := range []string{
+		"# TYPE mvmv_files_moved_total counter\nmvmv_files_moved_total 12\n",
+		"mvmv_errors_total 1\n",
+		`mvmv_skipped_total{reason="exists"} 3` + "\n",
+		"# TYPE mvmv_bytes_per_second gauge\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Metrics lack %q:\n%s", want, out)
+		}
+	}
+
+	// An address in use fails the run before anything is moved
+	src := t.TempDir()
+	createFile(t, filepath.Join(src, "file.txt"), "data")
+	if _, err := Move(context.Background(), []string{src}, t.TempDir(), Options{MetricsAddr: l.Addr().String(), Quiet: true}); err == nil {
+		t.Error("Expected an error for an address in use")
+	}
+	assertFileContent(t, filepath.Join(src, "file.txt"), "data")
+}
+
+func TestResult(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "a.txt"), "a")
+	createFile(t, filepath.Join(src, "b.txt"), "b")
+	createFile(t, filepath.Join(src, "blocked", "c.txt"), "c")
+	createFile(t, filepath.Join(dst, "b.txt"), "existing")
+	createFile(t, filepath.Join(dst, "blocked"), "not a directory")
+
+	result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2})
+	if err == nil {
+		t.Fatal("Expected an error for blocked")
+	}
+	if result.FilesMoved != 1 || result.FilesSkipped != 1 || len(result.Failures) != 1 {
+		t.Errorf("Result = %+v, want 1 moved, 1 skipped, 1 failure", result)
+	}
+	if result.Elapsed <= 0 || result.Interrupted {
+		t.Errorf("Elapsed = %v, Interrupted = %v", result.Elapsed, result.Interrupted)
+	}
+
+	var buf bytes.Buffer
+	result.PrintStats(&buf, &Options{})
+	for _, want := range []string{"Operation completed in", "Files: 1 moved, 1 skipped", "files/s", "Errors: 1", filepath.Join(src, "blocked")} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Statistics lack %q:\n%s", want, buf.String())
+		}
+	}
+
+	result.Interrupted = true
+	buf.Reset()
+	result.PrintStats(&buf, &Options{})
+	if !strings.Contains(buf.String(), "Operation interrupted after") {
+		t.Errorf("Statistics of an interrupted run:\n%s", buf.String())
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{30 * time.Second, "30s"},
+		{90 * time.Second, "1m30s"},
+		{61 * time.Minute, "1h01m00s"},
+		{125 * time.Minute, "2h05m00s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			result := formatDuration(tt.duration)
+			if result != tt.expected {
+				t.Errorf("formatDuration(%v) = %q, want %q", tt.duration, result, tt.expected)
+			}
+		})
+	}
+}
+
+// Helper functions
+func createFile(t testing.TB, path, content string) {
+	t.Helper()
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory %s: %v", dir, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create file %s: %v", path, err)
+	}
+}
+
+// treeShape describes a synthetic tree: every directory holds files
+// regular files and, above depth, width subdirectories
+type treeShape struct {
+	width, depth, files int
+}
+
+// createTree builds a tree of the given shape under root and returns the
+// number of files created. Directories are named dir000, dir001... and
+// files file000.txt..., each holding its own relative path.
+func createTree(t testing.TB, root string, shape treeShape) int {
+	t.Helper()
+	return createTreeAt(t, root, "", shape, shape.depth)
+}
+
+func createTreeAt(t testing.TB, root, rel string, shape treeShape, depth int) int {
+	if err := os.MkdirAll(filepath.Join(root, rel), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	n := 0
+	for i := 0; i < shape.files; i++ {
+		path := filepath.Join(rel, fmt.Sprintf("file%03d.txt", i))
+		if err := os.WriteFile(filepath.Join(root, path), []byte(path), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", path, err)
+		}
+		n++
+	}
+	if depth > 0 {
+		for i := 0; i < shape.width; i++ {
+			n += createTreeAt(t, root, filepath.Join(rel, fmt.Sprintf("dir%03d", i)), shape, depth-1)
+		}
+	}
+	return n
+}
+
+func assertFileContent(t *testing.T, path, expected string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file %s: %v", path, err)
+	}
+	if string(content) != expected {
+		t.Errorf("File content mismatch at %s: got %q, want %q", path, string(content), expected)
+	}
+}
+
+func assertNotExists(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Path should not exist: %s", path)
+	}
+}
+
+func assertDirExists(t *testing.T, path string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Directory should exist: %s", path)
+	}
+	if !info.IsDir() {
+		t.Errorf("Path is not a directory: %s", path)
+	}
+}
+
+func assertSymlinkExists(t *testing.T, path string) {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatalf("Symlink should exist: %s", path)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Path is not a symlink: %s", path)
+	}
+}
+
+func assertLink(t *testing.T, path, expected string) {
+	t.Helper()
+	link, err := os.Readlink(path)
+	if err != nil {
+		t.Fatalf("Failed to read symlink %s: %v", path, err)
+	}
+	if link != expected {
+		t.Errorf("Symlink target mismatch at %s: got %q, want %q", path, link, expected)
+	}
+}
+
+func statFile(t testing.TB, path string) os.FileInfo {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	return info
+}
+
+func TestChecksumManifest(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	createFile(t, filepath.Join(src, "new", "b.txt"), "bravo")
+	createFile(t, filepath.Join(src, "new", "sub", "a.txt"), "alpha")
+	createFile(t, filepath.Join(src, "dir", "c.txt"), "charlie")
+	createFile(t, filepath.Join(dst, "dir", "other.txt"), "target")
+	if err := os.Symlink("c.txt", filepath.Join(src, "dir", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Move(context.Background(), []string{src}, dst, Options{ChecksumManifest: true, DryRun: true, Quiet: true}); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, checksumFile)); !os.IsNotExist(err) {
+		t.Fatalf("Dry run wrote %s: %v", checksumFile, err)
+	}
+
+	if _, err := Move(context.Background(), []string{src}, dst, Options{Workers: 2, ChecksumManifest: true, Quiet: true}); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	want := sum("charlie") + "  dir/c.txt\n" +
+		sum("bravo") + "  new/b.txt\n" +
+		sum("alpha") + "  new/sub/a.txt\n"
+	data, err := os.ReadFile(filepath.Join(dst, checksumFile))
+	if err != nil {
+		t.Fatalf("Reading %s failed: %v", checksumFile, err)
+	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", checksumFile, data, want)
+	}
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), tempPrefix) {
+			t.Errorf("Temporary file %s left in the target root", e.Name())
+		}
+	}
+
+	// Files an atomic directory rolled back were never moved
+	src = t.TempDir()
+	dst = t.TempDir()
+	createFile(t, filepath.Join(src, "d", "a.txt"), "alpha")
+	createFile(t, filepath.Join(src, "d", "b.txt"), "bravo")
+	createFile(t, filepath.Join(src, "e", "c.txt"), "charlie")
+	createFile(t, filepath.Join(dst, "d", "other.txt"), "target")
+	createFile(t, filepath.Join(dst, "e", "other.txt"), "target")
+	faults := func(path string) error {
+		if filepath.Base(path) == "b.txt" {
+			return errors.New("injected")
+		}
+		return nil
+	}
+	if _, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, AtomicDirs: true, ChecksumManifest: true, faultInjector: faults, Quiet: true}); err == nil {
+		t.Fatal("Move succeeded despite the injected failure")
+	}
+	data, err = os.ReadFile(filepath.Join(dst, checksumFile))
+	if err != nil {
+		t.Fatalf("Reading %s failed: %v", checksumFile, err)
+	}
+	if want := sum("charlie") + "  e/c.txt\n"; string(data) != want {
+		t.Errorf("%s after a rollback = %q, want %q", checksumFile, data, want)
+	}
+}
+
+func TestExpandSource(t *testing.T) {
+	braces := map[string][]string{
+		"a{b,c}d":        {"abd", "acd"},
+		"{x,y}/{1,2}":    {"x/1", "x/2", "y/1", "y/2"},
+		"a{b,{c,d}}":     {"ab", "ac", "ad"},
+		"{single}-{a,b}": {"{single}-a", "{single}-b"},
+		"open{a,b":       {"open{a,b"},
+		"plain":          {"plain"},
+	}
+	for pattern, want := range braces {
+		if got := expandBraces(pattern); !slices.Equal(got, want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+
+	root := t.TempDir()
+	for _, dir := range []string{"2023-01", "2024-01", "2024-02", "lit[1]"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createFile(t, filepath.Join(root, "2024-notes.txt"), "notes")
+	at := func(names ...string) []string {
+		for i, name := range names {
+			names[i] = filepath.Join(root, name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		arg     string
+		want    []string
+		wantErr bool
+	}{
+		{arg: filepath.Join(root, "2024-0*"), want: at("2024-01", "2024-02")},
+		{arg: filepath.Join(root, "{2023,2024}-01") + "/", want: []string{filepath.Join(root, "2023-01") + "/", filepath.Join(root, "2024-01") + "/"}},
+		{arg: filepath.Join(root, "lit[1]"), want: at("lit[1]")},
+		{arg: filepath.Join(root, "2023-01"), want: at("2023-01")},
+		{arg: filepath.Join(root, "2024-*"), wantErr: true},
+		{arg: filepath.Join(root, "2025-*"), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ExpandSource(tt.arg)
+		if tt.wantErr {
+			var pathErr *PathError
+			if !errors.As(err, &pathErr) {
+				t.Errorf("ExpandSource(%q) = %q, %v, want a PathError", tt.arg, got, err)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("ExpandSource(%q) = %q, %v, want %q", tt.arg, got, err, tt.want)
+		}
+	}
+}
+
+func TestStallWatchdog(t *testing.T) {
+	var logs bytes.Buffer
+	stopped := false
+	m := &mover{
+		opts:       &Options{StallTimeout: time.Minute, StallAbort: true},
+		stats:      &Statistics{},
+		tracker:    newJobTracker(2),
+		log:        slog.New(slog.NewTextHandler(&logs, nil)),
+		cancel:     func() { stopped = true },
+		stallAbort: make(chan struct{}),
+	}
+	start := time.Now()
+	w := &stallWatch{progress: m.progressCount(), since: start}
+
+	// Idle workers are never stalled
+	if m.checkStall(w, start.Add(2*time.Minute)) {
+		t.Fatal("Stall reported with no busy worker")
+	}
+	m.tracker.start(1, Job{SourcePath: "/mnt/nfs/stuck"})
+	if m.checkStall(w, start.Add(2*time.Minute+30*time.Second)) {
+		t.Fatal("Stall reported before the timeout")
+	}
+
+	// A copy in progress counts as progress
+	m.copied.Add(4096)
+	if m.checkStall(w, start.Add(4*time.Minute+30*time.Second)) {
+		t.Fatal("Stall reported while a copy advanced")
+	}
+	if m.checkStall(w, start.Add(5*time.Minute)) {
+		t.Fatal("Stall reported before the timeout since the last progress")
+	}
+	if !m.checkStall(w, start.Add(6*time.Minute)) {
+		t.Fatal("Stall not reported")
+	}
+	if !strings.Contains(logs.String(), "/mnt/nfs/stuck") {
+		t.Errorf("Stall warning doesn't name the stuck path:\n%s", logs.String())
+	}
+	if m.checkStall(w, start.Add(8*time.Minute)) {
+		t.Error("Stall reported twice")
+	}
+
+	if !stopped || !m.stalled.Load() {
+		t.Error("Stalled run not stopped")
+	}
+	if failures := m.failures.list(); len(failures) != 1 || !errors.Is(&failures[0], ErrStalled) {
+		t.Errorf("Failures = %v, want the stall", failures)
+	}
+	var jobsWg sync.WaitGroup
+	jobsWg.Add(1)
+	if m.waitJobs(&jobsWg) {
+		t.Error("waitJobs waited for a stuck job")
+	}
+	if err := (&RunError{Errors: 1, Stalled: true}); !errors.Is(err, ErrStalled) {
+		t.Errorf("RunError %v doesn't match ErrStalled", err)
+	}
+}
+
+func TestInjectFault(t *testing.T) {
+	injected := errors.New("injected")
+	faults := func(path string) error {
+		if strings.Contains(filepath.Base(path), "bad") {
+			return injected
+		}
+		return nil
+	}
+	setup := func(t *testing.T) (string, string) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		createFile(t, filepath.Join(src, "dir", "good.txt"), "good")
+		for i := range 5 {
+			createFile(t, filepath.Join(src, "dir", fmt.Sprintf("bad%d.txt", i)), "bad")
+		}
+		createFile(t, filepath.Join(src, "baddir", "file.txt"), "data")
+		createFile(t, filepath.Join(dst, "dir", "other.txt"), "target")
+		return src, dst
+	}
+
+	t.Run("recorded", func(t *testing.T) {
+		src, dst := setup(t)
+		result, err := Move(context.Background(), []string{src}, dst, Options{faultInjector: faults, Quiet: true})
+		var runErr *RunError
+		if !errors.As(err, &runErr) || !errors.Is(err, injected) {
+			t.Fatalf("Move error = %v, want a RunError with the injected failures", err)
+		}
+		if result.Errors != 6 || result.FilesMoved != 1 {
+			t.Errorf("Errors = %d, FilesMoved = %d, want 6 and 1", result.Errors, result.FilesMoved)
+		}
+		assertFileContent(t, filepath.Join(dst, "dir", "good.txt"), "good")
+		assertFileContent(t, filepath.Join(src, "dir", "bad0.txt"), "bad")
+		assertFileContent(t, filepath.Join(src, "baddir", "file.txt"), "data")
+	})
+
+	t.Run("max_errors", func(t *testing.T) {
+		src, dst := setup(t)
+		_, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, faultInjector: faults, MaxErrors: 2, Quiet: true})
+		if !errors.Is(err, ErrTooManyErrors) {
+			t.Errorf("Move error = %v, want ErrTooManyErrors", err)
+		}
+	})
+
+	t.Run("fail_fast", func(t *testing.T) {
+		src, dst := setup(t)
+		_, err := Move(context.Background(), []string{src}, dst, Options{faultInjector: faults, FailFast: true, Quiet: true})
+		var moveErr *MoveError
+		if !errors.As(err, &moveErr) || !errors.Is(err, injected) {
+			t.Errorf("Move error = %v, want the first injected failure", err)
+		}
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		src, dst := setup(t)
+		var calls atomic.Int64
+		flaky := func(path string) error {
+			if calls.Add(1) == 1 {
+				return syscall.EIO
+			}
+			return nil
+		}
+		result, err := Move(context.Background(), []string{src}, dst, Options{Workers: 1, faultInjector: flaky, Retries: 1, RetryDelay: time.Millisecond, Quiet: true})
+		if err != nil || result.Retries != 1 {
+			t.Errorf("Move = %d retries, %v, want 1 retry and no error", result.Retries, err)
+		}
+	})
+}
@@ -0,0 +1,340 @@
+package mvmv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output formats
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// opEvent is one line of verbose JSON output, describing a single operation
+type opEvent struct {
+	Op     string `json:"op"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	Link   string `json:"link,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Diff   string `json:"diff,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Seconds is how long the operation took, with Timings
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+// attrs returns the event's fields as slog attributes, leaving out empty ones
+func (ev opEvent) attrs() []any {
+	attrs := []any{slog.String("op", ev.Op), slog.String("source", ev.Source)}
+	for _, a := range []slog.Attr{
+		slog.String("target", ev.Target),
+		slog.String("link", ev.Link),
+		slog.String("reason", ev.Reason),
+		slog.String("diff", ev.Diff),
+		slog.Int64("size", ev.Size),
+		slog.String("error", ev.Error),
+		slog.Float64("seconds", ev.Seconds),
+	} {
+		if !a.Value.Equal(slog.StringValue("")) && !a.Value.Equal(slog.Int64Value(0)) && !a.Value.Equal(slog.Float64Value(0)) {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// errorRecord is a failed operation as listed in the JSON report
+type errorRecord struct {
+	Op      string `json:"op"`
+	Path    string `json:"path"`
+	Target  string `json:"target,omitempty"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+// resourceReport is the JSON form of the --resource-stats figures
+type resourceReport struct {
+	UserSeconds   float64 `json:"user_seconds"`
+	SystemSeconds float64 `json:"system_seconds"`
+	MaxRSSBytes   int64   `json:"max_rss_bytes"`
+}
+
+// jsonReport is the final JSON object written at the end of a run
+type jsonReport struct {
+	Statistics       Statistics        `json:"statistics"`
+	DurationSeconds  float64           `json:"duration_seconds"`
+	Interrupted      bool              `json:"interrupted,omitempty"`
+	EstimatedSeconds float64           `json:"estimated_seconds,omitempty"`
+	Resources        *resourceReport   `json:"resources,omitempty"`
+	Errors           []errorRecord     `json:"errors"`
+	Inaccessible     []errorRecord     `json:"inaccessible,omitempty"`
+	Summary          []*SummaryNode    `json:"summary,omitempty"`
+	Slowest          []timingRecord    `json:"slowest,omitempty"`
+	Shards           []ShardAssignment `json:"shards,omitempty"`
+}
+
+// jsonOutput serializes JSON lines from concurrent workers and collects the
+// errors for the final report
+type jsonOutput struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	errors []errorRecord
+}
+
+func newJSONOutput(w io.Writer) *jsonOutput {
+	return &jsonOutput{enc: json.NewEncoder(w), errors: []errorRecord{}}
+}
+
+func (o *jsonOutput) emit(v any) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.enc.Encode(v)
+}
+
+// recordError remembers a failure for the final report
+func (o *jsonOutput) recordError(e MoveError, format, path string) errorRecord {
+	rec := errorRecord{
+		Op:      e.Op,
+		Path:    e.SourcePath,
+		Target:  e.TargetPath,
+		Message: fmt.Sprintf(format, path, e.Err),
+		Error:   e.Err.Error(),
+	}
+	o.mu.Lock()
+	o.errors = append(o.errors, rec)
+	o.mu.Unlock()
+	return rec
+}
+
+// report writes the final JSON object
+func (o *jsonOutput) report(result *Result, opts *Options, estimate time.Duration) {
+	r := jsonReport{
+		Statistics:       result.Statistics,
+		DurationSeconds:  time.Since(result.StartTime).Seconds(),
+		Interrupted:      result.Interrupted,
+		EstimatedSeconds: estimate.Seconds(),
+		Summary:          result.Summary,
+		Shards:           result.Shards,
+	}
+	if opts.ResourceStats {
+		if user, system, maxRSS, ok := resourceUsage(); ok {
+			r.Resources = &resourceReport{
+				UserSeconds:   user.Seconds(),
+				SystemSeconds: system.Seconds(),
+				MaxRSSBytes:   maxRSS,
+			}
+		}
+	}
+
+	o.mu.Lock()
+	r.Errors = o.errors
+	o.mu.Unlock()
+	if opts.Ordered {
+		slices.SortStableFunc(r.Errors, func(a, b errorRecord) int { return comparePaths(a.Path, b.Path) })
+	}
+	for _, e := range result.Inaccessible {
+		r.Inaccessible = append(r.Inaccessible, errorRecord{
+			Op:      e.Op,
+			Path:    e.SourcePath,
+			Message: fmt.Sprintf("Cannot read directory %s: %v", e.SourcePath, e.Err),
+			Error:   e.Err.Error(),
+		})
+	}
+	for _, t := range result.Slowest {
+		r.Slowest = append(r.Slowest, timingRecord{Op: t.Op, Path: t.SourcePath, Target: t.TargetPath, Seconds: t.Duration.Seconds()})
+	}
+	o.emit(r)
+}
+
+// validateOutput checks the Output option
+func validateOutput(format string) error {
+	switch format {
+	case "", OutputText, OutputJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q (want %s or %s)", format, OutputText, OutputJSON)
+	}
+}
+
+// printOp reports an operation as a JSON line on stdout, or through the
+// logger with the formatted message
+func (m *mover) printOp(ev opEvent, format string, args ...any) {
+	if m.out != nil {
+		m.out.emit(ev)
+		return
+	}
+	m.logger().Info(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"), ev.attrs()...)
+}
+
+// logger returns the run's logger, the slog default if none was set up
+func (m *mover) logger() *slog.Logger {
+	if m.log != nil {
+		return m.log
+	}
+	return slog.Default()
+}
+
+// newLogger returns opts.Logger, or a text logger on stderr
+func newLogger(opts *Options) *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+// ProgressEvent describes an operation as passed to Options.OnProgress
+type ProgressEvent struct {
+	// Action names the operation as in verbose JSON output, e.g. "moved",
+	// "skipped", "overwritten", "copied", "merged", "deleted" or "error"
+	Action string
+	Source string
+	// Target is empty for operations that only touch the source
+	Target string
+	// Bytes is the size of a moved file, or 0
+	Bytes int64
+	// Reason explains a skip or merge, e.g. "exists" or "excluded"
+	Reason string
+	// Err is the cause of an "error" event
+	Err error
+}
+
+// notify passes an operation to the OnProgress callback, if any
+func (m *mover) notify(ev opEvent, err error) {
+	if m.opts.OnProgress == nil {
+		return
+	}
+	m.opts.OnProgress(ProgressEvent{
+		Action: ev.Op,
+		Source: ev.Source,
+		Target: ev.Target,
+		Bytes:  ev.Size,
+		Reason: ev.Reason,
+		Err:    err,
+	})
+}
+
+// logOp reports an operation to OnProgress and, in verbose mode, the log.
+// A dry run always reports every operation, as one plan line each in text
+// output.
+func (m *mover) logOp(ev opEvent, format string, args ...any) {
+	m.notify(ev, nil)
+	if m.opts.ShowConflicts && ev.Op != "conflict" || m.opts.ShowSkipped && ev.Op != "skipped" {
+		return
+	}
+	switch {
+	case m.opts.DryRun && m.out == nil:
+		m.report(ev.Source, func() { fmt.Println(planLine(ev)) })
+	case m.opts.DryRun || m.opts.Verbose:
+		m.report(ev.Source, func() { m.printOp(ev, format, args...) })
+	}
+}
+
+// pendingReport is an operation or error held back for ordered output
+type pendingReport struct {
+	path  string
+	print func()
+}
+
+// reportBuffer collects the reports of concurrent workers for Ordered
+type reportBuffer struct {
+	mu      sync.Mutex
+	reports []pendingReport
+}
+
+// report prints what happened to path right away, or with Ordered holds it
+// until flushReports
+func (m *mover) report(path string, print func()) {
+	if m.reports == nil {
+		print()
+		return
+	}
+	m.reports.mu.Lock()
+	m.reports.reports = append(m.reports.reports, pendingReport{path: path, print: print})
+	m.reports.mu.Unlock()
+}
+
+// flushReports prints the reports held so far sorted by path. Reports for
+// the same path keep the order they happened in.
+func (m *mover) flushReports() {
+	if m.reports == nil {
+		return
+	}
+	m.reports.mu.Lock()
+	reports := m.reports.reports
+	m.reports.reports = nil
+	m.reports.mu.Unlock()
+
+	slices.SortStableFunc(reports, func(a, b pendingReport) int { return comparePaths(a.path, b.path) })
+	for _, r := range reports {
+		r.print()
+	}
+}
+
+// comparePaths orders paths the way a depth-first walk visits them, so a
+// directory's entries come before a sibling such as "dir.txt" next to "dir"
+func comparePaths(a, b string) int {
+	sep := string(filepath.Separator)
+	return strings.Compare(strings.ReplaceAll(a, sep, "\x00"), strings.ReplaceAll(b, sep, "\x00"))
+}
+
+// planActions names the operations in dry-run plan lines
+var planActions = map[string]string{
+	"moved":        "move",
+	"skipped":      "skip",
+	"overwritten":  "overwrite",
+	"copied":       "copy",
+	"linked":       "link",
+	"deleted":      "delete",
+	"merged":       "merge",
+	"conflict":     "conflict",
+	"followed":     "follow",
+	"pruned":       "prune",
+	"chmod":        "chmod",
+	"renamed":      "rename",
+	"removed":      "remove",
+	"retried":      "retry",
+	"rolled-back":  "rollback",
+	"inaccessible": "inaccessible",
+	"error":        "error",
+}
+
+// planLine formats an operation as a line of the dry-run plan:
+// the action, the source, the target if any, then the reason or error
+func planLine(ev opEvent) string {
+	action, ok := planActions[ev.Op]
+	if !ok {
+		action = ev.Op
+	}
+
+	line := fmt.Sprintf("%-9s %s", action, ev.Source)
+	if ev.Target != "" {
+		line += " -> " + ev.Target
+	}
+	switch {
+	case ev.Error != "":
+		line += ": " + ev.Error
+	case ev.Reason != "" && ev.Diff != "":
+		line += " (" + ev.Reason + ": " + ev.Diff + ")"
+	case ev.Reason != "":
+		line += " (" + ev.Reason + ")"
+	}
+	return line
+}
+
+// printInfo logs a message that is not tied to an operation
+func (m *mover) printInfo(format string, args ...any) {
+	if m.opts.Quiet {
+		return
+	}
+	m.logger().Info(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+}
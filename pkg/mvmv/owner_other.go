@@ -0,0 +1,13 @@
+//go:build !unix
+
+package mvmv
+
+import "os"
+
+// ownershipSupported reports whether copyOwner can preserve ownership here
+const ownershipSupported = false
+
+// copyOwner does nothing, since files have no uid/gid on this platform
+func copyOwner(path string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package mvmv
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownershipSupported reports whether copyOwner can preserve ownership here
+const ownershipSupported = true
+
+// copyOwner gives path the uid and gid of the file described by info
+func copyOwner(path string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Lchown(path, int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package mvmv
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPreserveOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership requires root")
+	}
+
+	src := filepath.Join(t.TempDir(), "file.txt")
+	dst := filepath.Join(t.TempDir(), "file.txt")
+	createFile(t, src, "content")
+	if err := os.Lchown(src, 1234, 5678); err != nil {
+		t.Fatalf("Failed to chown: %v", err)
+	}
+
+	if err := (&mover{opts: &Options{PreserveOwnership: true}}).copyFile(src, dst, statFile(t, src)); err != nil {
+		t.Fatalf("copyFile failed: %v", err)
+	}
+
+	st := statFile(t, dst).Sys().(*syscall.Stat_t)
+	if st.Uid != 1234 || st.Gid != 5678 {
+		t.Errorf("Owner = %d:%d, want 1234:5678", st.Uid, st.Gid)
+	}
+
+	dir := filepath.Join(t.TempDir(), "dir")
+	m := &mover{opts: &Options{PreserveOwnership: true}, stats: &Statistics{}}
+	if err := m.createDir(dst, dir, statFile(t, dst)); err != nil {
+		t.Fatalf("createDir failed: %v", err)
+	}
+	if st := statFile(t, dir).Sys().(*syscall.Stat_t); st.Uid != 1234 || st.Gid != 5678 {
+		t.Errorf("Directory owner = %d:%d, want 1234:5678", st.Uid, st.Gid)
+	}
+}
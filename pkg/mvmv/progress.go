@@ -0,0 +1,140 @@
+package mvmv
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// progressWidth is the number of cells in the progress bar
+const progressWidth = 30
+
+// treeCount is the number of regular files and their bytes below a directory
+type treeCount struct {
+	files int64
+	bytes int64
+}
+
+// progress tracks how much of the pre-scanned source has been handled. The
+// trees map is read-only once the scan is done.
+type progress struct {
+	trees map[string]treeCount
+
+	files atomic.Int64
+	bytes atomic.Int64
+}
+
+// scanSources counts the regular files and bytes below every seed, storing
+// the totals in stats and the per-directory counts in the returned progress
+// so that a directory moved in one rename can be accounted for at once
+func scanSources(seeds []Job, stats *Statistics) *progress {
+	p := &progress{trees: make(map[string]treeCount)}
+
+	for _, seed := range seeds {
+		root := seed.SourcePath
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			stats.TotalFiles++
+			stats.TotalBytes += info.Size()
+			if path == root {
+				return nil
+			}
+			for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+				c := p.trees[dir]
+				c.files++
+				c.bytes += info.Size()
+				p.trees[dir] = c
+				if dir == root || dir == filepath.Dir(dir) {
+					break
+				}
+			}
+			return nil
+		})
+	}
+
+	return p
+}
+
+// fileDone accounts for a single handled file
+func (p *progress) fileDone(size int64) {
+	if p == nil {
+		return
+	}
+	p.files.Add(1)
+	p.bytes.Add(size)
+}
+
+// treeDone accounts for every file below a directory handled as a whole
+func (p *progress) treeDone(dir string) {
+	if p == nil {
+		return
+	}
+	c := p.trees[dir]
+	p.files.Add(c.files)
+	p.bytes.Add(c.bytes)
+}
+
+// progressReporter redraws the progress bar until done is closed
+func progressReporter(p *progress, stats *Statistics, done <-chan struct{}) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			fmt.Print(renderProgress(p, stats, time.Since(stats.StartTime)))
+			return
+		case <-ticker.C:
+			fmt.Print(renderProgress(p, stats, time.Since(stats.StartTime)))
+		}
+	}
+}
+
+// renderProgress formats the progress bar line, prefixed with a carriage
+// return so it overwrites the previous one
+func renderProgress(p *progress, stats *Statistics, elapsed time.Duration) string {
+	files, bytes := p.files.Load(), p.bytes.Load()
+
+	// Measure by bytes where there is data, since files vary in size
+	fraction := 1.0
+	if stats.TotalBytes > 0 {
+		fraction = float64(bytes) / float64(stats.TotalBytes)
+	} else if stats.TotalFiles > 0 {
+		fraction = float64(files) / float64(stats.TotalFiles)
+	}
+	fraction = min(fraction, 1)
+
+	filled := int(fraction * progressWidth)
+	bar := strings.Repeat("=", filled)
+	if filled < progressWidth {
+		bar += ">" + strings.Repeat(" ", progressWidth-filled-1)
+	}
+
+	eta := "--"
+	if fraction > 0 && fraction < 1 {
+		remaining := time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+		eta = formatDuration(remaining)
+	} else if fraction >= 1 {
+		eta = formatDuration(0)
+	}
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(bytes) / elapsed.Seconds() / 1024 / 1024
+	}
+
+	return fmt.Sprintf("\r[%s] %5.1f%% %d/%d files, %.2f/%.2f GB, %.2f MB/s, ETA %s, Errors: %d ",
+		bar, fraction*100, files, stats.TotalFiles,
+		float64(bytes)/1024/1024/1024, float64(stats.TotalBytes)/1024/1024/1024,
+		rate, eta, atomic.LoadInt64(&stats.Errors))
+}
@@ -0,0 +1,80 @@
+package mvmv
+
+import "sync"
+
+// dirChunk is the number of entries read from a source directory at a time.
+// The children of a directory with more are queued a chunk at a time.
+const dirChunk = 1024
+
+// jobQueue is the FIFO queue of jobs shared by the workers. Pushing never
+// blocks, so the queue grows with the number of entries waiting, about the
+// size of a Job each.
+//
+// It replaces a buffered channel, which could deadlock on bushy trees:
+// a worker sends the children of the directory it just read before taking
+// another job, so once the buffer was full and every worker was blocked on
+// a send, no one was left to receive.
+type jobQueue struct {
+	mu     sync.Mutex
+	ready  sync.Cond
+	jobs   []Job
+	head   int
+	closed bool
+}
+
+// newJobQueue returns an empty queue with room for capacity jobs before it
+// has to grow
+func newJobQueue(capacity int) *jobQueue {
+	q := &jobQueue{jobs: make([]Job, 0, capacity)}
+	q.ready.L = &q.mu
+	return q
+}
+
+// push appends jobs to the queue and wakes workers waiting for them
+func (q *jobQueue) push(jobs ...Job) {
+	if len(jobs) == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.jobs = append(q.jobs, jobs...)
+	q.mu.Unlock()
+	if len(jobs) == 1 {
+		q.ready.Signal()
+	} else {
+		q.ready.Broadcast()
+	}
+}
+
+// pop takes the oldest job, waiting until there is one. ok is false once
+// the queue is closed and empty.
+func (q *jobQueue) pop() (job Job, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.head == len(q.jobs) && !q.closed {
+		q.ready.Wait()
+	}
+	if q.head == len(q.jobs) {
+		return Job{}, false
+	}
+
+	job = q.jobs[q.head]
+	q.jobs[q.head] = Job{}
+	q.head++
+	// Reuse the space of taken jobs once they make up most of the slice
+	if q.head == len(q.jobs) {
+		q.jobs, q.head = q.jobs[:0], 0
+	} else if q.head >= 1024 && q.head*2 >= len(q.jobs) {
+		n := copy(q.jobs, q.jobs[q.head:])
+		clear(q.jobs[n:])
+		q.jobs, q.head = q.jobs[:n], 0
+	}
+	return job, true
+}
+
+// close wakes the waiting workers, which stop once the queue is empty
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.ready.Broadcast()
+}
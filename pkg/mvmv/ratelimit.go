@@ -0,0 +1,62 @@
+package mvmv
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateChunk caps how much a single read takes from the limiter, so that
+// workers copying concurrently share the bandwidth evenly
+const rateChunk = 64 * 1024
+
+// rateLimiter is a token bucket shared by all workers. Callers take tokens
+// up front and sleep off any debt, so the total rate stays under the limit
+// however many copies run at once.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter allows bytesPerSec on average, with bursts of a tenth of
+// a second's worth
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	burst := float64(bytesPerSec) / 10
+	return &rateLimiter{rate: float64(bytesPerSec), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait blocks until n bytes may pass
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// limitedReader throttles reads through a shared rateLimiter
+type limitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateChunk {
+		p = p[:rateChunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,129 @@
+package mvmv
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/eicca/mvmv/internal/testhooks"
+)
+
+// errNoReplaceUnsupported is returned by renameNoReplace when the platform,
+// kernel or filesystem can't refuse to replace an existing target
+var errNoReplaceUnsupported = errors.New("rename without replace is not supported")
+
+// noReplaceDevices records the devices whose filesystems refused
+// renameNoReplace during a run, so later renames there skip the failing
+// syscall. Directories are only stated once some device has refused it.
+type noReplaceDevices struct {
+	any     atomic.Bool
+	devices sync.Map
+}
+
+// unsupported reports whether renames into dir are known to need the
+// fallback
+func (d *noReplaceDevices) unsupported(dir string) bool {
+	if !d.any.Load() {
+		return false
+	}
+	dev, ok := dirDevice(dir)
+	if !ok {
+		return false
+	}
+	_, found := d.devices.Load(dev)
+	return found
+}
+
+// markUnsupported records that renames into dir need the fallback
+func (d *noReplaceDevices) markUnsupported(dir string) {
+	if dev, ok := dirDevice(dir); ok {
+		d.devices.Store(dev, true)
+		d.any.Store(true)
+	}
+}
+
+// dirDevice returns the device holding dir
+func dirDevice(dir string) (uint64, bool) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0, false
+	}
+	return deviceID(info)
+}
+
+// renameNoReplace is the package's renameNoReplace, skipped on the devices
+// where it already failed as unsupported
+func (m *mover) renameNoReplace(oldpath, newpath string) error {
+	dir := filepath.Dir(newpath)
+	if m.noReplace.unsupported(dir) {
+		return errNoReplaceUnsupported
+	}
+	err := renameNoReplace(oldpath, newpath)
+	if errors.Is(err, errNoReplaceUnsupported) {
+		m.noReplace.markUnsupported(dir)
+	}
+	return err
+}
+
+// rename moves oldpath to newpath. With NoReplace set it asks the kernel to
+// refuse replacing an existing newpath, closing the window between our
+// existence check and the rename; the error then satisfies
+// errors.Is(err, os.ErrExist). Where that isn't supported it falls back to
+// os.Rename, relying on the earlier existence check. With Fsync set, both
+// parent directories are synced after the rename.
+func (m *mover) rename(oldpath, newpath string) error {
+	err := m.renameEntry(oldpath, newpath)
+	if err == nil {
+		m.syncParents(oldpath, newpath)
+	}
+	return err
+}
+
+// renameEntry is rename without the syncing
+func (m *mover) renameEntry(oldpath, newpath string) error {
+	if m.opts.NoReplace {
+		err := m.renameNoReplace(oldpath, newpath)
+		if !errors.Is(err, errNoReplaceUnsupported) {
+			return err
+		}
+	}
+	return os.Rename(oldpath, newpath)
+}
+
+// injectFault returns the failure faultInjector makes up for a rename of
+// path, if any
+func (m *mover) injectFault(path string) error {
+	if m.opts.faultInjector == nil {
+		return nil
+	}
+	return m.opts.faultInjector(path)
+}
+
+func init() {
+	testhooks.SetFaultInjector = func(opts any, inject func(path string) error) {
+		opts.(*Options).faultInjector = inject
+	}
+}
+
+// syncParents syncs the directories holding paths when Fsync is set, each
+// once. The entries are in place by then, so a failure is recorded as an
+// error of its own.
+func (m *mover) syncParents(paths ...string) {
+	if !m.opts.Fsync {
+		return
+	}
+	synced := make([]string, 0, len(paths))
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if slices.Contains(synced, dir) {
+			continue
+		}
+		synced = append(synced, dir)
+		if err := syncDir(dir); err != nil {
+			m.recordError(MoveError{Op: "fsync", SourcePath: dir, Err: err}, "Cannot sync directory %s: %v", dir)
+		}
+	}
+}
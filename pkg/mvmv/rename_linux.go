@@ -0,0 +1,23 @@
+//go:build linux
+
+package mvmv
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameNoReplace renames oldpath to newpath, letting the kernel fail the
+// rename with EEXIST if newpath exists
+func renameNoReplace(oldpath, newpath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldpath, unix.AT_FDCWD, newpath, unix.RENAME_NOREPLACE)
+	switch err {
+	case nil:
+		return nil
+	case unix.ENOSYS, unix.EINVAL:
+		// Older kernels lack renameat2, some filesystems reject the flag
+		return errNoReplaceUnsupported
+	}
+	return &os.LinkError{Op: "renameat2", Old: oldpath, New: newpath, Err: err}
+}
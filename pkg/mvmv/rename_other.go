@@ -0,0 +1,8 @@
+//go:build !linux
+
+package mvmv
+
+// renameNoReplace is not available on this platform
+func renameNoReplace(oldpath, newpath string) error {
+	return errNoReplaceUnsupported
+}
@@ -0,0 +1,48 @@
+package mvmv
+
+import (
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryDelay is the wait before the first retry of a transient failure
+const DefaultRetryDelay = 100 * time.Millisecond
+
+// transientErrors are failures worth retrying, as seen on network
+// filesystems under load
+var transientErrors = []error{syscall.EINTR, syscall.EIO, syscall.EAGAIN, syscall.EBUSY, syscall.ETIMEDOUT}
+
+// isTransient reports whether an operation that failed with err may succeed
+// when repeated
+func isTransient(err error) bool {
+	for _, target := range transientErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry runs op, repeating it up to Retries more times while it fails with
+// a transient error. The delay starts at RetryDelay and doubles after every
+// attempt. Other errors are returned at once.
+func (m *mover) retry(sourcePath, targetPath string, op func() error) error {
+	delay := m.opts.RetryDelay
+	if delay == 0 {
+		delay = DefaultRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= m.opts.Retries || !isTransient(err) {
+			return err
+		}
+
+		atomic.AddInt64(&m.stats.Retries, 1)
+		m.logOp(opEvent{Op: "retried", Source: sourcePath, Target: targetPath, Error: err.Error()}, "Retrying in %s after %v: %s\n", delay, err, sourcePath)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
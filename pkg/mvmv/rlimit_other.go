@@ -0,0 +1,8 @@
+//go:build !unix
+
+package mvmv
+
+// openFileLimit returns 0, since there is no descriptor limit to query here
+func openFileLimit() int {
+	return 0
+}
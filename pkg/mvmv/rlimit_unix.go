@@ -0,0 +1,19 @@
+//go:build unix
+
+package mvmv
+
+import "syscall"
+
+// openFileLimit returns the process's soft limit on open file descriptors,
+// or 0 if it can't be determined or is unlimited
+func openFileLimit() int {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0
+	}
+	cur := uint64(rl.Cur)
+	if cur == 0 || cur > 1<<30 {
+		return 0
+	}
+	return int(cur)
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package mvmv
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// rotational reports whether path is on a spinning disk, going by the
+// queue/rotational flag of its block device in sysfs. ok is false when
+// there is no such flag, as for network or virtual filesystems
+func rotational(path string) (rot, ok bool) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return false, false
+	}
+	dev := fmt.Sprintf("/sys/dev/block/%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev))
+	// A partition has no queue of its own but shares its disk's, one level
+	// up; the path is left uncleaned so the kernel resolves the link first
+	for _, flag := range []string{dev + "/queue/rotational", dev + "/../queue/rotational"} {
+		data, err := os.ReadFile(flag)
+		if err == nil {
+			return strings.TrimSpace(string(data)) == "1", true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package mvmv
+
+// rotational can't tell the storage type outside Linux, so ok is false
+func rotational(path string) (rot, ok bool) {
+	return false, false
+}
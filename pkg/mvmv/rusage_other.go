@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package mvmv
+
+import "time"
+
+// resourceUsage is not available on this platform
+func resourceUsage() (user, system time.Duration, maxRSS int64, ok bool) {
+	return 0, 0, 0, false
+}
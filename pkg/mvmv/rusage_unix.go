@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package mvmv
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// resourceUsage returns the user and system CPU time consumed by the process
+// and its peak resident set size in bytes
+func resourceUsage() (user, system time.Duration, maxRSS int64, ok bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, 0, 0, false
+	}
+
+	// macOS reports bytes, the other platforms report kilobytes
+	maxRSS = int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		maxRSS *= 1024
+	}
+
+	return time.Duration(ru.Utime.Nano()), time.Duration(ru.Stime.Nano()), maxRSS, true
+}
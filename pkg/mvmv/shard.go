@@ -0,0 +1,177 @@
+package mvmv
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Shard strategies for distributing top-level entries across targets
+const (
+	ShardRoundRobin = "round-robin"
+	ShardBySize     = "size"
+)
+
+// ShardAssignment records which target a top-level source entry was sent to
+type ShardAssignment struct {
+	Entry  string `json:"entry"`
+	Target string `json:"target"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// Shard distributes the top-level entries of source across targets and
+// merges each entry into its assigned target. Entries left in the source by
+// the ignore file, Exclude or Filter take no target, and the assignments of
+// the others are returned in the result's Shards.
+func Shard(ctx context.Context, source string, targets []string, opts Options) (Result, error) {
+	if err := validateOptions(&opts); err != nil {
+		return Result{}, &OptionsError{Err: err}
+	}
+	switch opts.ShardBy {
+	case "", ShardRoundRobin, ShardBySize:
+	default:
+		return Result{}, &OptionsError{Err: fmt.Errorf("unknown shard strategy %q (want %q or %q)", opts.ShardBy, ShardRoundRobin, ShardBySize)}
+	}
+	if err := validateSource(source); err != nil {
+		return Result{}, &PathError{Err: err}
+	}
+	if len(targets) == 0 {
+		return Result{}, &PathError{Err: fmt.Errorf("at least one target is required")}
+	}
+	for _, target := range targets {
+		if err := checkNesting(source, target); err != nil {
+			return Result{}, &PathError{Err: err}
+		}
+		if err := checkOverlap(source, target); err != nil {
+			return Result{}, &PathError{Err: err}
+		}
+		if err := ensureTarget(target, source, &opts); err != nil {
+			return Result{}, &PathError{Err: err}
+		}
+	}
+
+	// The entries are seeded directly, so apply the source's ignore file here
+	var rules *ignoreRules
+	if !opts.NoIgnore {
+		var err error
+		if rules, err = rules.load(source); err != nil {
+			return Result{}, fmt.Errorf("cannot read %s: %w", ignoreFileName, err)
+		}
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return Result{}, fmt.Errorf("cannot read source directory: %w", err)
+	}
+	var names, left []string
+	for _, entry := range entries {
+		if !opts.NoIgnore && entry.Name() == ignoreFileName {
+			continue
+		}
+		if shardSkipped(filepath.Join(source, entry.Name()), entry, rules, &opts) {
+			left = append(left, entry.Name())
+		} else {
+			names = append(names, entry.Name())
+		}
+	}
+
+	assignments := assignShards(source, names, targets, opts.ShardBy)
+	seeds := make([]Job, 0, len(entries))
+	for _, a := range assignments {
+		seeds = append(seeds, Job{
+			SourcePath: filepath.Join(source, a.Entry),
+			TargetPath: filepath.Join(a.Target, a.Entry),
+			SourceRoot: source,
+			TargetRoot: a.Target,
+			ignore:     rules,
+		})
+	}
+	// The entries left behind are still seeded, so they are skipped and
+	// counted like in any other run, but nothing is created for them
+	for _, name := range left {
+		seeds = append(seeds, Job{
+			SourcePath: filepath.Join(source, name),
+			TargetPath: filepath.Join(targets[0], name),
+			SourceRoot: source,
+			TargetRoot: targets[0],
+			ignore:     rules,
+		})
+	}
+
+	return runJobs(ctx, seeds, &opts, assignments)
+}
+
+// shardSkipped reports whether processPath will leave a top-level entry in
+// the source for the ignore file, Exclude or Filter
+func shardSkipped(path string, entry fs.DirEntry, rules *ignoreRules, opts *Options) bool {
+	if opts.Filter != nil {
+		if info, err := entry.Info(); err == nil {
+			if d := opts.Filter(path, info); d == FilterSkip || d == FilterPrune {
+				return true
+			}
+		}
+	}
+	return matchAny(opts.Exclude, path) || rules.ignored(path, entry.IsDir())
+}
+
+// assignShards maps each of the named top-level entries of source to one
+// of the targets
+func assignShards(source string, names []string, targets []string, strategy string) []ShardAssignment {
+	assignments := make([]ShardAssignment, len(names))
+	for i, name := range names {
+		assignments[i].Entry = name
+	}
+
+	if strategy != ShardBySize {
+		for i := range assignments {
+			assignments[i].Target = targets[i%len(targets)]
+		}
+		return assignments
+	}
+
+	for i := range assignments {
+		assignments[i].Size = treeSize(filepath.Join(source, assignments[i].Entry))
+	}
+
+	// Largest entries first, each to the currently least loaded target
+	order := make([]int, len(assignments))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return assignments[order[a]].Size > assignments[order[b]].Size
+	})
+
+	loads := make([]int64, len(targets))
+	for _, i := range order {
+		least := 0
+		for t := range loads {
+			if loads[t] < loads[least] {
+				least = t
+			}
+		}
+		assignments[i].Target = targets[least]
+		loads[least] += assignments[i].Size
+	}
+	return assignments
+}
+
+// treeSize sums the sizes of regular files under path without following symlinks
+func treeSize(path string) int64 {
+	var total int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
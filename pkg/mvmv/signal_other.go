@@ -0,0 +1,8 @@
+//go:build !unix
+
+package mvmv
+
+import "os"
+
+// notifyDumpSignal is a no-op on platforms without SIGUSR1
+func notifyDumpSignal(c chan<- os.Signal) {}
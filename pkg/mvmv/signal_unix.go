@@ -0,0 +1,14 @@
+//go:build unix
+
+package mvmv
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyDumpSignal relays SIGUSR1 to c
+func notifyDumpSignal(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,42 @@
+package mvmv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps size suffixes to their multipliers, in powers of 1024
+var sizeUnits = map[string]float64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+	"P": 1 << 50,
+}
+
+// ParseSize parses a human-readable byte count such as "512", "10M" or
+// "1.5G". Suffixes are case-insensitive powers of 1024 and may be followed
+// by "B" or "iB" ("10MB" and "10MiB" both mean 10M).
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+	str = strings.TrimSuffix(str, "I")
+
+	unit := ""
+	if n := len(str); n > 0 && (str[n-1] < '0' || str[n-1] > '9') && str[n-1] != '.' {
+		unit = str[n-1:]
+		str = str[:n-1]
+	}
+	mult, ok := sizeUnits[unit]
+	if !ok || str == "" {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * mult), nil
+}
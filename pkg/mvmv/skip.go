@@ -0,0 +1,122 @@
+package mvmv
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// SkipReason says why an entry was left in the source
+type SkipReason int
+
+const (
+	// SkipExists is an existing target no conflict option applied to
+	SkipExists SkipReason = iota
+	// SkipNotOlder is an existing target kept by OverwriteNewer
+	SkipNotOlder
+	// SkipFiltered covers Include, Exclude, the size and age filters and
+	// .mvmvignore files
+	SkipFiltered
+	SkipSymlink
+	// SkipInTarget is a file found in the target index of SkipIfInTarget
+	SkipInTarget
+	SkipDenied
+	// SkipCheckpoint is a path an earlier run completed
+	SkipCheckpoint
+	// SkipMaxDepth is a directory that exists at the target at MaxDepth
+	SkipMaxDepth
+	// SkipCaseCollision is an entry whose name differs only in case from a
+	// sibling kept instead on a case-insensitive target
+	SkipCaseCollision
+	// SkipSpecial is a named pipe, socket or device node left by SkipSpecial
+	SkipSpecial
+
+	numSkipReasons
+)
+
+var skipReasonNames = [numSkipReasons]string{
+	SkipExists:        "exists",
+	SkipNotOlder:      "target not older",
+	SkipFiltered:      "filtered",
+	SkipSymlink:       "symlink",
+	SkipInTarget:      "in target index",
+	SkipDenied:        "denied",
+	SkipCheckpoint:    "checkpoint",
+	SkipMaxDepth:      "max depth",
+	SkipCaseCollision: "case collision",
+	SkipSpecial:       "special file",
+}
+
+func (r SkipReason) String() string {
+	if r < 0 || r >= numSkipReasons {
+		return fmt.Sprintf("SkipReason(%d)", int(r))
+	}
+	return skipReasonNames[r]
+}
+
+// SkipCounts counts the skipped entries by reason. In JSON it is an object
+// keyed by reason name, without the reasons that never occurred.
+type SkipCounts [numSkipReasons]int64
+
+// Total is the number of skipped entries
+func (c *SkipCounts) Total() int64 {
+	var n int64
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+// String lists the non-zero counts, e.g. "3 exists, 1 symlink"
+func (c *SkipCounts) String() string {
+	var parts []string
+	for r, n := range c {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, SkipReason(r)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (c SkipCounts) MarshalJSON() ([]byte, error) {
+	m := make(map[string]int64)
+	for r, n := range c {
+		if n > 0 {
+			m[SkipReason(r).String()] = n
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (c *SkipCounts) UnmarshalJSON(data []byte) error {
+	var m map[string]int64
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*c = SkipCounts{}
+	for name, n := range m {
+		for r, known := range skipReasonNames {
+			if known == name {
+				c[r] = n
+			}
+		}
+	}
+	return nil
+}
+
+// skip counts an entry left in the source and reports it. The event's
+// reason defaults to the name of the category, but may be more specific.
+// ShowSkipped only reports the entries skipped for their existing target.
+func (m *mover) skip(reason SkipReason, ev opEvent, format string, args ...any) {
+	atomic.AddInt64(&m.stats.Skipped[reason], 1)
+	ev.Op = "skipped"
+	if ev.Reason == "" {
+		ev.Reason = reason.String()
+	}
+	if m.opts.ShowSkipped && reason != SkipExists && reason != SkipNotOlder && reason != SkipInTarget {
+		m.notify(ev, nil)
+		return
+	}
+	m.logOp(ev, format, args...)
+}
@@ -0,0 +1,111 @@
+package mvmv
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// spaceNeed is the data headed for one target filesystem
+type spaceNeed struct {
+	target string
+	bytes  int64
+}
+
+// checkSpace estimates how much data will be copied onto each target
+// filesystem and fails if any of them has less space available. Sources on
+// the target's filesystem are renamed and need none. Files left behind by
+// the filters or skipped because their target exists are not counted;
+// everything else is counted in full, including files that will replace
+// a target.
+func (m *mover) checkSpace(seeds []Job) error {
+	if !m.opts.AllowCrossDevice {
+		// Nothing is copied, and renames take no space
+		return nil
+	}
+	needs := make(map[uint64]*spaceNeed)
+	for i, seed := range seeds {
+		target := existingTarget(seed.TargetRoot)
+		targetInfo, err := os.Stat(target)
+		if err != nil {
+			continue
+		}
+		targetDev, ok := deviceID(targetInfo)
+		if !ok {
+			// Without device IDs every target counts on its own
+			targetDev = uint64(i)
+		}
+		if sourceInfo, err := os.Lstat(seed.SourcePath); err == nil {
+			if dev, ok := deviceID(sourceInfo); ok && dev == targetDev {
+				continue
+			}
+		}
+
+		need := needs[targetDev]
+		if need == nil {
+			need = &spaceNeed{target: target}
+			needs[targetDev] = need
+		}
+		need.bytes += m.copySize(seed)
+	}
+
+	for _, need := range needs {
+		avail, ok := availableSpace(need.target)
+		if !ok {
+			m.logger().Warn("Cannot check free space on the target", "target", need.target)
+			continue
+		}
+		if uint64(need.bytes) > avail {
+			return fmt.Errorf("not enough space on %s: %.2f GB to copy, %.2f GB available",
+				need.target, float64(need.bytes)/1024/1024/1024, float64(avail)/1024/1024/1024)
+		}
+	}
+	return nil
+}
+
+// copySize sums the sizes of the files below the seed that a run would
+// copy to the target
+func (m *mover) copySize(seed Job) int64 {
+	keepsTarget := !m.opts.Overwrite && !m.opts.OverwriteNewer && !m.opts.ConflictRename
+	var total int64
+	_ = filepath.WalkDir(seed.SourcePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != seed.SourcePath && m.excluded(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || m.filterFile(path, info) != "" {
+			return nil
+		}
+		if keepsTarget {
+			rel, err := filepath.Rel(seed.SourcePath, path)
+			if err != nil {
+				return nil
+			}
+			target := filepath.Join(seed.TargetPath, rel)
+			if m.opts.Flatten {
+				target = filepath.Join(seed.TargetRoot, d.Name())
+			}
+			if m.opts.TargetNameTransform != nil {
+				if target, err = m.transformTarget(seed.SourceRoot, path, target); err != nil {
+					return nil
+				}
+			}
+			if _, err := os.Lstat(target); err == nil {
+				return nil
+			}
+		}
+		total += info.Size()
+		return nil
+	})
+	return total
+}
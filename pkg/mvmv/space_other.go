@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package mvmv
+
+// availableSpace can't query free space on this platform
+func availableSpace(path string) (uint64, bool) {
+	return 0, false
+}
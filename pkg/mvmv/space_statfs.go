@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package mvmv
+
+import "golang.org/x/sys/unix"
+
+// availableSpace returns the bytes available to unprivileged users on the
+// filesystem holding path
+func availableSpace(path string) (uint64, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true
+}
@@ -0,0 +1,44 @@
+package mvmv
+
+import (
+	"errors"
+	"os"
+)
+
+// errSpecialUnsupported is returned by makeNode where special files can't
+// be recreated
+var errSpecialUnsupported = errors.New("special files can't be recreated on this platform")
+
+// isSpecial reports whether mode is a named pipe, socket, device node or
+// other file without data of its own to copy or hash
+func isSpecial(mode os.FileMode) bool {
+	return mode&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeCharDevice|os.ModeIrregular) != 0
+}
+
+// copySpecial moves a special file to another filesystem by creating a node
+// of the same type, and device number for a device, at targetPath and then
+// removing sourcePath. Mode and times are preserved, as for copied files,
+// and the owner with PreserveOwnership. A socket is recreated as a node
+// nothing listens on.
+func (m *mover) copySpecial(sourcePath, targetPath string, info os.FileInfo) error {
+	if err := makeNode(targetPath, info); err != nil {
+		return err
+	}
+	// Neither call opens the file, which would block on a named pipe
+	err := os.Chmod(targetPath, info.Mode().Perm())
+	if err == nil {
+		err = os.Chtimes(targetPath, accessTime(info), info.ModTime())
+	}
+	if err == nil && m.opts.PreserveOwnership {
+		err = copyOwner(targetPath, info)
+	}
+	if err == nil {
+		err = os.Remove(sourcePath)
+	}
+	if err != nil {
+		os.Remove(targetPath)
+		return err
+	}
+	m.syncParents(targetPath, sourcePath)
+	return nil
+}
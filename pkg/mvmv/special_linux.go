@@ -0,0 +1,23 @@
+//go:build linux
+
+package mvmv
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// makeNode creates a node at path of the type and device number described
+// by info
+func makeNode(path string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errSpecialUnsupported
+	}
+	if err := unix.Mknod(path, st.Mode, int(st.Rdev)); err != nil {
+		return &os.PathError{Op: "mknod", Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package mvmv
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSpecialFiles(t *testing.T) {
+	setup := func(t *testing.T) string {
+		src := t.TempDir()
+		createFile(t, filepath.Join(src, "file.txt"), "data")
+		if err := unix.Mkfifo(filepath.Join(src, "pipe"), 0640); err != nil {
+			t.Fatalf("Failed to create FIFO: %v", err)
+		}
+		return src
+	}
+
+	targets := map[string]string{"same_filesystem": t.TempDir()}
+	if other, err := os.MkdirTemp("/dev/shm", "mvmv-test-"); err == nil {
+		defer os.RemoveAll(other)
+		targets["cross_device"] = other
+	}
+	for name, base := range targets {
+		t.Run(name, func(t *testing.T) {
+			src := setup(t)
+			dst, err := os.MkdirTemp(base, "dst-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The pipe would block a copy or hash of its contents forever
+			opts := Options{AllowCrossDevice: true, DeleteIdentical: true, Verify: true, Quiet: true}
+			result, err := Move(context.Background(), []string{src}, dst, opts)
+			if err != nil {
+				t.Fatalf("mvmv failed: %v", err)
+			}
+			if result.SpecialFilesMoved != 1 {
+				t.Errorf("SpecialFilesMoved = %d, want 1", result.SpecialFilesMoved)
+			}
+			info, err := os.Lstat(filepath.Join(dst, "pipe"))
+			if err != nil || info.Mode().Type() != os.ModeNamedPipe || info.Mode().Perm() != 0640 {
+				t.Errorf("Target pipe = %v, %v; want a named pipe with mode 0640", info, err)
+			}
+			assertNotExists(t, filepath.Join(src, "pipe"))
+			assertFileContent(t, filepath.Join(dst, "file.txt"), "data")
+		})
+	}
+
+	t.Run("skip_special", func(t *testing.T) {
+		src := setup(t)
+		dst := t.TempDir()
+		// Keeps the source from being renamed as a whole
+		createFile(t, filepath.Join(dst, "existing"), "")
+		result, err := Move(context.Background(), []string{src}, dst, Options{SkipSpecial: true, Quiet: true})
+		if err != nil {
+			t.Fatalf("mvmv failed: %v", err)
+		}
+		if result.Skipped[SkipSpecial] != 1 || result.SpecialFilesMoved != 0 {
+			t.Errorf("Skipped = %s, SpecialFilesMoved = %d; want 1 special file skipped", result.Skipped.String(), result.SpecialFilesMoved)
+		}
+		if _, err := os.Lstat(filepath.Join(src, "pipe")); err != nil {
+			t.Errorf("Skipped pipe was moved: %v", err)
+		}
+	})
+
+	t.Run("device_node", func(t *testing.T) {
+		src := t.TempDir()
+		other, err := os.MkdirTemp("/dev/shm", "mvmv-test-")
+		if err != nil {
+			t.Skipf("No second filesystem: %v", err)
+		}
+		defer os.RemoveAll(other)
+		// The same device as /dev/null
+		if err := unix.Mknod(filepath.Join(src, "null"), unix.S_IFCHR|0666, int(unix.Mkdev(1, 3))); err != nil {
+			if errors.Is(err, unix.EPERM) {
+				t.Skip("Creating device nodes needs privileges")
+			}
+			t.Fatal(err)
+		}
+
+		m := &mover{opts: &Options{}, stats: &Statistics{}}
+		target := filepath.Join(other, "null")
+		if err := m.copySpecial(filepath.Join(src, "null"), target, statFile(t, filepath.Join(src, "null"))); err != nil {
+			t.Fatalf("copySpecial failed: %v", err)
+		}
+		var st unix.Stat_t
+		if err := unix.Lstat(target, &st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Mode&unix.S_IFMT != unix.S_IFCHR || unix.Major(st.Rdev) != 1 || unix.Minor(st.Rdev) != 3 {
+			t.Errorf("Recreated node has mode %#o and device %d:%d, want a character device 1:3", st.Mode, unix.Major(st.Rdev), unix.Minor(st.Rdev))
+		}
+	})
+}
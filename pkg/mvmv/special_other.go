@@ -0,0 +1,10 @@
+//go:build !linux
+
+package mvmv
+
+import "os"
+
+// makeNode is not available on this platform
+func makeNode(path string, info os.FileInfo) error {
+	return errSpecialUnsupported
+}
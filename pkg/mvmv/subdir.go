@@ -0,0 +1,44 @@
+package mvmv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TargetSubdir returns the directory subdir below target, for moving into a
+// named subdirectory of a shared target, creating it and its missing
+// parents. target itself has to exist unless CreateTarget is set. A dry run
+// creates and reports nothing, leaving that to the run with CreateTarget
+// set. subdir must be a relative path that stays below target.
+// Invalid subdirs are reported as an *OptionsError and problems with the
+// paths as a *PathError.
+func TargetSubdir(target, subdir string, opts Options) (string, error) {
+	if !filepath.IsLocal(subdir) || filepath.Clean(subdir) == "." {
+		return "", &OptionsError{Err: fmt.Errorf("target subdirectory must be a relative path below the target: %q", subdir)}
+	}
+	if !opts.CreateTarget {
+		if err := validateTarget(target); err != nil {
+			return "", &PathError{Err: err}
+		}
+	}
+
+	path := filepath.Join(target, subdir)
+	if _, err := os.Lstat(path); !errors.Is(err, os.ErrNotExist) {
+		if err := validateTarget(path); err != nil {
+			return "", &PathError{Err: err}
+		}
+		return path, nil
+	}
+	if opts.DryRun {
+		return path, nil
+	}
+	if opts.Verbose && opts.Output != OutputJSON {
+		fmt.Printf("Creating target directory: %s\n", path)
+	}
+	if err := mkdirTarget(path, 0755, &opts); err != nil {
+		return "", &PathError{Err: fmt.Errorf("cannot create target: %w", err)}
+	}
+	return path, nil
+}
@@ -0,0 +1,186 @@
+package mvmv
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// summaryMaxChildren caps the branches printed below each directory of the
+// summary; the smallest of the rest are folded into one line
+const summaryMaxChildren = 20
+
+// SummaryNode is a directory of the target in the summary of a run, with
+// the number of entries moved into it or below it and their size. A
+// directory moved as a whole counts as one entry, sized only with
+// CountDirBytes.
+type SummaryNode struct {
+	Name     string         `json:"name"`
+	Entries  int64          `json:"entries"`
+	Bytes    int64          `json:"bytes"`
+	Children []*SummaryNode `json:"children,omitempty"`
+}
+
+// treeSummary aggregates completed moves by target directory, down to a
+// fixed depth below each target root, so its size depends on the shape of
+// the target rather than on the number of entries moved
+type treeSummary struct {
+	mu    sync.Mutex
+	depth int
+	roots map[string]*summaryDir
+}
+
+type summaryDir struct {
+	entries  int64
+	bytes    int64
+	children map[string]*summaryDir
+}
+
+func newTreeSummary(seeds []Job, depth int) *treeSummary {
+	s := &treeSummary{depth: depth, roots: make(map[string]*summaryDir)}
+	for _, seed := range seeds {
+		s.roots[seed.TargetRoot] = &summaryDir{}
+	}
+	return s
+}
+
+// add counts a moved entry in every directory on its way from the target
+// root down to the summary's depth. A moved directory counts as a directory
+// of its own.
+func (s *treeSummary) add(target string, size int64, isDir bool) {
+	if s == nil {
+		return
+	}
+	root, rel := s.root(target)
+	if root == "" {
+		return
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if !isDir {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) > s.depth {
+		parts = parts[:s.depth]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.roots[root]
+	dir.entries++
+	dir.bytes += size
+	for _, name := range parts {
+		child := dir.children[name]
+		if child == nil {
+			if dir.children == nil {
+				dir.children = make(map[string]*summaryDir)
+			}
+			child = &summaryDir{}
+			dir.children[name] = child
+		}
+		child.entries++
+		child.bytes += size
+		dir = child
+	}
+}
+
+// root returns the longest target root holding target, and target's path
+// relative to it
+func (s *treeSummary) root(target string) (string, string) {
+	var best, rel string
+	for root := range s.roots {
+		r, err := filepath.Rel(root, target)
+		if err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(root) > len(best) {
+			best, rel = root, r
+		}
+	}
+	return best, rel
+}
+
+// nodes returns the summary of every target root that received entries,
+// sorted by path
+func (s *treeSummary) nodes() []*SummaryNode {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var nodes []*SummaryNode
+	for root, dir := range s.roots {
+		if dir.entries > 0 {
+			nodes = append(nodes, dir.node(root))
+		}
+	}
+	slices.SortFunc(nodes, func(a, b *SummaryNode) int { return strings.Compare(a.Name, b.Name) })
+	return nodes
+}
+
+// node converts a directory and its subtree, the largest branches first
+func (d *summaryDir) node(name string) *SummaryNode {
+	n := &SummaryNode{Name: name, Entries: d.entries, Bytes: d.bytes}
+	for childName, child := range d.children {
+		n.Children = append(n.Children, child.node(childName))
+	}
+	slices.SortFunc(n.Children, func(a, b *SummaryNode) int {
+		if c := cmp.Compare(b.Bytes, a.Bytes); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Entries, a.Entries); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return n
+}
+
+// PrintSummary writes the Summary of the run as a tree of the target
+// directories that received entries
+func (r *Result) PrintSummary(w io.Writer) {
+	for _, root := range r.Summary {
+		fmt.Fprintf(w, "%s  %s\n", root.Name, summaryCounts(root.Entries, root.Bytes))
+		printSummaryChildren(w, root.Children, "")
+	}
+}
+
+func printSummaryChildren(w io.Writer, children []*SummaryNode, indent string) {
+	shown := children
+	if len(shown) > summaryMaxChildren {
+		shown = shown[:summaryMaxChildren-1]
+	}
+	for i, child := range shown {
+		branch, next := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s  %s\n", indent, branch, child.Name, summaryCounts(child.Entries, child.Bytes))
+		printSummaryChildren(w, child.Children, indent+next)
+	}
+	if rest := children[len(shown):]; len(rest) > 0 {
+		var entries, bytes int64
+		for _, child := range rest {
+			entries += child.Entries
+			bytes += child.Bytes
+		}
+		fmt.Fprintf(w, "%s└── ... %d more  %s\n", indent, len(rest), summaryCounts(entries, bytes))
+	}
+}
+
+// summaryCounts formats the figures of a summary line
+func summaryCounts(entries, bytes int64) string {
+	s := fmt.Sprintf("%d moved", entries)
+	switch {
+	case bytes >= 1024*1024*1024:
+		s += fmt.Sprintf(", %.2f GB", float64(bytes)/1024/1024/1024)
+	case bytes >= 1024*1024:
+		s += fmt.Sprintf(", %.2f MB", float64(bytes)/1024/1024)
+	case bytes > 0:
+		s += fmt.Sprintf(", %d bytes", bytes)
+	}
+	return s
+}
@@ -0,0 +1,187 @@
+package mvmv
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// followSymlink replaces a link to a regular file inside the source tree
+// with a copy of that file at the target and removes the link. The file
+// itself is moved on its own like any other entry. The file filters apply
+// to the file linked to. It reports false for links it doesn't follow,
+// which are then handled like other symlinks.
+func (m *mover) followSymlink(job Job, targetExists bool) bool {
+	sourcePath, targetPath := job.SourcePath, job.TargetPath
+
+	realPath, info, ok := resolveLink(job)
+	if !ok {
+		return false
+	}
+
+	if reason := m.filterFile(sourcePath, info); reason != "" {
+		atomic.AddInt64(&m.stats.FilesFiltered, 1)
+		m.skip(SkipFiltered, opEvent{Source: sourcePath, Reason: reason}, "Skipping symlinked file (%s): %s\n", reason, sourcePath)
+		return true
+	}
+
+	if targetExists {
+		atomic.AddInt64(&m.stats.SymlinksSkipped, 1)
+		m.skip(SkipExists, opEvent{Source: sourcePath, Target: targetPath}, "Skipping existing file: %s\n", targetPath)
+		return true
+	}
+
+	m.logOp(opEvent{Op: "followed", Source: sourcePath, Target: targetPath, Link: realPath}, "Following symlink: %s -> %s (%s)\n", sourcePath, targetPath, realPath)
+
+	if !m.opts.DryRun {
+		if err := m.copyData(realPath, targetPath, info); err != nil {
+			m.recordError(MoveError{Op: "copy", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Failed to copy symlinked file %s: %v", sourcePath)
+			return true
+		}
+		if err := os.Remove(sourcePath); err != nil {
+			m.recordError(MoveError{Op: "remove", SourcePath: sourcePath, Err: err}, "Failed to remove source symlink %s: %v", sourcePath)
+			return true
+		}
+		m.syncParents(targetPath, sourcePath)
+	}
+
+	atomic.AddInt64(&m.stats.SymlinksFollowed, 1)
+	atomic.AddInt64(&m.stats.BytesMoved, info.Size())
+	if !m.opts.DryRun {
+		// The copy takes the link's place, so undo restores a file there
+		m.recordMove(ManifestEntry{Source: sourcePath, Target: targetPath, Type: ManifestFile, Size: info.Size()})
+	}
+	return true
+}
+
+// resolveLink returns the regular file a symlink resolves to, provided it
+// lies inside the source tree. Loops and links escaping the source root are
+// rejected. The file may already have been moved by another worker, in which
+// case its new location under the target root is returned.
+func resolveLink(job Job) (string, os.FileInfo, bool) {
+	root, err := filepath.EvalSymlinks(job.SourceRoot)
+	if err != nil {
+		return "", nil, false
+	}
+
+	realPath, err := filepath.EvalSymlinks(job.SourcePath)
+	if err == nil {
+		if _, ok := relativeTo(root, realPath); !ok {
+			return "", nil, false
+		}
+		return regularFile(realPath)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		// ELOOP and other resolution failures
+		return "", nil, false
+	}
+
+	link, err := os.Readlink(job.SourcePath)
+	if err != nil {
+		return "", nil, false
+	}
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(job.SourcePath), link)
+	}
+	rel, ok := relativeTo(job.SourceRoot, link)
+	if !ok {
+		return "", nil, false
+	}
+	moved, err := filepath.EvalSymlinks(filepath.Join(job.TargetRoot, rel))
+	if err != nil {
+		return "", nil, false
+	}
+	if _, ok := relativeTo(job.TargetRoot, moved); !ok {
+		return "", nil, false
+	}
+	return regularFile(moved)
+}
+
+// regularFile stats path and reports whether it is a regular file
+func regularFile(path string) (string, os.FileInfo, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil, false
+	}
+	return path, info, true
+}
+
+// relativeTo returns path relative to root if path lies inside root
+func relativeTo(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// processSymlink recreates a symlink at the target and removes the source
+// link. The link is copied verbatim unless RewriteSymlinks is set.
+func (m *mover) processSymlink(job Job, targetExists bool) {
+	sourcePath, targetPath := job.SourcePath, job.TargetPath
+
+	if targetExists {
+		atomic.AddInt64(&m.stats.SymlinksSkipped, 1)
+		m.skip(SkipExists, opEvent{Source: sourcePath, Target: targetPath}, "Skipping existing symlink: %s\n", targetPath)
+		return
+	}
+
+	link, err := os.Readlink(sourcePath)
+	if err != nil {
+		m.recordError(MoveError{Op: "readlink", SourcePath: sourcePath, Err: err}, "Cannot read symlink %s: %v", sourcePath)
+		return
+	}
+
+	newLink := link
+	if m.opts.RewriteSymlinks {
+		newLink = rewriteLink(link, job)
+	}
+
+	m.logOp(opEvent{Op: "moved", Source: sourcePath, Target: targetPath, Link: newLink}, "Moving symlink: %s -> %s (%s)\n", sourcePath, targetPath, newLink)
+
+	if !m.opts.DryRun {
+		if err := os.Symlink(newLink, targetPath); err != nil {
+			m.recordError(MoveError{Op: "symlink", SourcePath: sourcePath, TargetPath: targetPath, Err: err}, "Failed to create symlink %s: %v", targetPath)
+			return
+		}
+		if err := os.Remove(sourcePath); err != nil {
+			m.recordError(MoveError{Op: "remove", SourcePath: sourcePath, Err: err}, "Failed to remove source symlink %s: %v", sourcePath)
+			return
+		}
+		m.syncParents(targetPath, sourcePath)
+		m.recordMove(ManifestEntry{Source: sourcePath, Target: targetPath, Type: ManifestSymlink})
+	}
+
+	atomic.AddInt64(&m.stats.SymlinksMoved, 1)
+}
+
+// rewriteLink maps a link whose target lies inside the source tree to the
+// corresponding location under the target tree. The link target is resolved
+// lexically, since the file it points at may already have been moved. Links
+// pointing outside the source tree are returned unchanged, and relative links
+// stay relative.
+func rewriteLink(link string, job Job) string {
+	resolved := link
+	if !filepath.IsAbs(link) {
+		resolved = filepath.Join(filepath.Dir(job.SourcePath), link)
+	}
+
+	rel, ok := relativeTo(job.SourceRoot, resolved)
+	if !ok {
+		return link
+	}
+
+	newTarget := filepath.Join(job.TargetRoot, rel)
+	if filepath.IsAbs(link) {
+		return newTarget
+	}
+
+	newLink, err := filepath.Rel(filepath.Dir(job.TargetPath), newTarget)
+	if err != nil {
+		return link
+	}
+	return newLink
+}
@@ -0,0 +1,101 @@
+package mvmv
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// targetListMin is the number of entries from which merging a directory
+// into an existing target lists the target once rather than stating every
+// child at the target
+const targetListMin = 16
+
+// lstatTarget stats the target of a job, counting the call in the run's
+// statistics
+func (m *mover) lstatTarget(path string) (os.FileInfo, error) {
+	atomic.AddInt64(&m.stats.targetStats, 1)
+	return os.Lstat(path)
+}
+
+// statTarget stats a target directory reached through a symlink, counting
+// the call like lstatTarget
+func (m *mover) statTarget(path string) (os.FileInfo, error) {
+	atomic.AddInt64(&m.stats.targetStats, 1)
+	return os.Stat(path)
+}
+
+// disjointTargets reports whether no seed's target root is or lies inside
+// another's, so that a target path is only ever written by one job
+func disjointTargets(seeds []Job) bool {
+	for i, a := range seeds {
+		for _, b := range seeds[i+1:] {
+			if within(a.TargetRoot, b.TargetRoot) || within(b.TargetRoot, a.TargetRoot) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// within reports whether path is dir or below it
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// missingTargets returns a function flagging the children of a directory
+// whose targets are known not to exist, so processPath doesn't stat them:
+// every child of a target directory created by this run, and in a large
+// merge the children missing from one listing of the target. count is the
+// number of children expected, which decides whether the listing pays off.
+// A target created in the meantime is only noticed by the rename itself.
+// Inside a directory this run created, that limits the shortcut to runs
+// where no other job can create it, or where the kernel refuses to replace
+// it; anyone may write into a merged directory, so the listing is only
+// used when the kernel refuses. It returns nil when no target can be known
+// to be missing.
+func (m *mover) missingTargets(job Job, created bool, count int) func(children []Job) {
+	if m.opts.Flatten || m.opts.TargetNameTransform != nil {
+		return nil
+	}
+	noReplace := m.opts.NoReplace && !m.noReplace.unsupported(job.TargetPath)
+	if created {
+		if !m.disjointTargets && !noReplace {
+			return nil
+		}
+		return func(children []Job) {
+			for i := range children {
+				children[i].targetMissing = true
+			}
+		}
+	}
+	if !noReplace {
+		return nil
+	}
+	// On a case-insensitive target a listing doesn't show which names are taken
+	if count < targetListMin || m.foldCase[job.TargetRoot] {
+		return nil
+	}
+	dir, err := os.Open(job.TargetPath)
+	if err != nil {
+		return nil
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return nil
+	}
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+	return func(children []Job) {
+		for i := range children {
+			if !existing[filepath.Base(children[i].TargetPath)] {
+				children[i].targetMissing = true
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package mvmv
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// errBadTargetName is recorded for a file whose TargetNameTransform result
+// isn't a plain file name
+var errBadTargetName = errors.New("transformed name is not a plain file name")
+
+// AffixName returns a TargetNameTransform that adds prefix and suffix to
+// every file name, the suffix before the extension: with prefix
+// "2024-01-01_" and suffix "_old", "dir/report.txt" becomes
+// "2024-01-01_report_old.txt". Extensions are split as for ConflictRename.
+func AffixName(prefix, suffix string) func(relPath string) string {
+	return func(relPath string) string {
+		name := filepath.Base(relPath)
+		ext := filepath.Ext(name)
+		if ext == name {
+			ext = ""
+		}
+		return prefix + strings.TrimSuffix(name, ext) + suffix + ext
+	}
+}
+
+// transformTarget returns where a file below root goes with
+// TargetNameTransform: next to targetPath, under the transformed name
+func (m *mover) transformTarget(root, sourcePath, targetPath string) (string, error) {
+	rel, err := filepath.Rel(root, sourcePath)
+	if err != nil {
+		return "", err
+	}
+	name := m.opts.TargetNameTransform(rel)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/`+string(filepath.Separator)) {
+		return "", errBadTargetName
+	}
+	return filepath.Join(filepath.Dir(targetPath), name), nil
+}
@@ -0,0 +1,77 @@
+package mvmv
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tempPrefix starts the names of the temporary files copies are written to
+// before they are renamed into place
+const tempPrefix = ".mvmv.tmp."
+
+// createTemp creates the file a copy to targetPath is written to, in the
+// same directory so that it can be renamed into place. Temporary files left
+// there by an interrupted run are removed first.
+func (m *mover) createTemp(targetPath string, perm os.FileMode) (*os.File, error) {
+	if m.opts.NoTempFile {
+		return os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	}
+	dir := filepath.Dir(targetPath)
+	once, _ := m.tempDirs.LoadOrStore(dir, &sync.Once{})
+	once.(*sync.Once).Do(func() { m.removeStaleTemps(dir) })
+	return os.CreateTemp(dir, tempPrefix+"*")
+}
+
+// removeStaleTemps removes the temporary files in dir, which can only be
+// left over from an earlier run: no copy of this run has written to dir yet.
+// A run copying into the same directory at the same time would see its copy
+// fail and keep its source.
+func (m *mover) removeStaleTemps(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	names, _ := f.Readdirnames(-1)
+	f.Close()
+	for _, name := range names {
+		if !strings.HasPrefix(name, tempPrefix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		m.logOp(opEvent{Op: "removed", Source: path, Reason: "stale temporary file"}, "Removing temporary file of an interrupted copy: %s\n", path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			m.recordError(MoveError{Op: "remove", SourcePath: path, Err: err}, "Cannot remove temporary file %s: %v", path)
+		}
+	}
+}
+
+// commitTemp renames the finished copy at tempPath to targetPath without
+// replacing anything that appeared there during the copy. The kernel
+// refuses to replace it where it can, or else a hard link does; on
+// filesystems with neither the target is checked just before the rename.
+func (m *mover) commitTemp(tempPath, targetPath string) error {
+	err := m.renameNoReplace(tempPath, targetPath)
+	if !errors.Is(err, errNoReplaceUnsupported) {
+		return err
+	}
+	err = os.Link(tempPath, targetPath)
+	if err == nil {
+		// The copy is in place; a temporary name left behind is removed
+		// by the next run
+		os.Remove(tempPath)
+		return nil
+	}
+	if errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if _, err := os.Lstat(targetPath); err == nil {
+		return &os.LinkError{Op: "rename", Old: tempPath, New: targetPath, Err: os.ErrExist}
+	}
+	return os.Rename(tempPath, targetPath)
+}
@@ -0,0 +1,89 @@
+package mvmv
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// slowestOps is the number of slowest operations kept with Options.Timings
+const slowestOps = 10
+
+// OpTiming is a rename or copy timed with Options.Timings
+type OpTiming struct {
+	// Op is "rename" or "copy"
+	Op         string
+	SourcePath string
+	TargetPath string
+	Duration   time.Duration
+}
+
+// timingRecord is an OpTiming as listed in the JSON report
+type timingRecord struct {
+	Op      string  `json:"op"`
+	Path    string  `json:"path"`
+	Target  string  `json:"target"`
+	Seconds float64 `json:"seconds"`
+}
+
+// slowestList keeps the slowest operations of a run, slowest first
+type slowestList struct {
+	mu  sync.Mutex
+	ops []OpTiming
+}
+
+// add keeps t if it is among the slowest so far
+func (s *slowestList) add(t OpTiming) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := len(s.ops)
+	for i > 0 && s.ops[i-1].Duration < t.Duration {
+		i--
+	}
+	if i == slowestOps {
+		return
+	}
+	s.ops = append(s.ops[:i], append([]OpTiming{t}, s.ops[i:]...)...)
+	if len(s.ops) > slowestOps {
+		s.ops = s.ops[:slowestOps]
+	}
+}
+
+func (s *slowestList) list() []OpTiming {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]OpTiming(nil), s.ops...)
+}
+
+// timed runs op, which renames or copies sourcePath to targetPath. With
+// Timings, a successful op is reported in verbose output with how long it
+// took, retries included, and kept if it is among the slowest.
+func (m *mover) timed(kind, sourcePath, targetPath string, op func() error) error {
+	if m.slowest == nil {
+		return op()
+	}
+	start := time.Now()
+	err := op()
+	if err != nil {
+		return err
+	}
+	t := OpTiming{Op: kind, SourcePath: sourcePath, TargetPath: targetPath, Duration: time.Since(start)}
+	m.slowest.add(t)
+	if m.opts.Verbose {
+		ev := opEvent{Op: "timed", Source: sourcePath, Target: targetPath, Reason: kind, Seconds: t.Duration.Seconds()}
+		m.report(sourcePath, func() { m.printOp(ev, "Took %s to %s: %s\n", t.Duration, kind, sourcePath) })
+	}
+	return nil
+}
+
+// printSlowest lists the slowest operations of a run
+func printSlowest(w io.Writer, ops []OpTiming) {
+	fmt.Fprintf(w, "Slowest operations:\n")
+	for _, t := range ops {
+		fmt.Fprintf(w, "  %s %s: %s -> %s\n", t.Duration.Round(time.Microsecond), t.Op, t.SourcePath, t.TargetPath)
+	}
+}
@@ -0,0 +1,107 @@
+package mvmv
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobTracker records queued jobs and the path each worker is processing so a
+// running move can be inspected. A nil tracker records nothing.
+type jobTracker struct {
+	mu      sync.Mutex
+	pending map[Job]int
+	current []string
+	started []time.Time
+}
+
+func newJobTracker(workers int) *jobTracker {
+	return &jobTracker{
+		pending: make(map[Job]int),
+		current: make([]string, workers),
+		started: make([]time.Time, workers),
+	}
+}
+
+// queue records a job sent to the job channel
+func (t *jobTracker) queue(job Job) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.pending[job]++
+	t.mu.Unlock()
+}
+
+// start records that a worker picked up a job
+func (t *jobTracker) start(worker int, job Job) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if t.pending[job] <= 1 {
+		delete(t.pending, job)
+	} else {
+		t.pending[job]--
+	}
+	t.current[worker] = job.SourcePath
+	t.started[worker] = time.Now()
+	t.mu.Unlock()
+}
+
+// finish records that a worker is idle again
+func (t *jobTracker) finish(worker int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.current[worker] = ""
+	t.mu.Unlock()
+}
+
+// busyWorker is a worker in the middle of a job
+type busyWorker struct {
+	id      int
+	path    string
+	started time.Time
+}
+
+// busy returns the workers processing a job, by worker number
+func (t *jobTracker) busy() []busyWorker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var workers []busyWorker
+	for i, path := range t.current {
+		if path != "" {
+			workers = append(workers, busyWorker{id: i, path: path, started: t.started[i]})
+		}
+	}
+	return workers
+}
+
+// dump writes a snapshot of worker activity and queued jobs
+func (t *jobTracker) dump(w io.Writer) {
+	t.mu.Lock()
+	current := append([]string(nil), t.current...)
+	pending := make([]string, 0, len(t.pending))
+	for job := range t.pending {
+		pending = append(pending, job.SourcePath+" -> "+job.TargetPath)
+	}
+	t.mu.Unlock()
+
+	sort.Strings(pending)
+
+	fmt.Fprintf(w, "\n=== mvmv state: %d workers, %d queued jobs ===\n", len(current), len(pending))
+	for i, path := range current {
+		if path == "" {
+			path = "(idle)"
+		}
+		fmt.Fprintf(w, "worker %d: %s\n", i, path)
+	}
+	for _, job := range pending {
+		fmt.Fprintf(w, "queued: %s\n", job)
+	}
+	fmt.Fprintln(w, "=== end mvmv state ===")
+}
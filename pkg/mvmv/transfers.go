@@ -0,0 +1,56 @@
+package mvmv
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadTransfers reads a file of transfers for MoveAll, one per line as a
+// source and its target separated by a tab. Unlike ParseTransfer, a source
+// is always merged into the target given for it, trailing slash or not.
+// Relative paths are taken from the working directory. Blank lines and
+// lines starting with # are skipped.
+func ReadTransfers(path string) ([]Transfer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open transfer list: %w", err)
+	}
+	defer f.Close()
+
+	var transfers []Transfer
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("%s line %d: want a source and a target separated by a tab", path, lineNo)
+		}
+		source, err := filepath.Abs(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, lineNo, err)
+		}
+		target, err := filepath.Abs(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, lineNo, err)
+		}
+		transfers = append(transfers, Transfer{Source: source, Target: target})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read transfer list: %w", err)
+	}
+
+	if len(transfers) == 0 {
+		return nil, fmt.Errorf("%s lists no transfers", path)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,180 @@
+package mvmv
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// errSourceOccupied is recorded when undo finds something at the path an
+// entry was originally moved from
+var errSourceOccupied = errors.New("original path is occupied")
+
+// UndoResult summarizes an Undo run
+type UndoResult struct {
+	// Restored counts entries moved back to their original path
+	Restored int `json:"restored"`
+	// Missing counts entries skipped because their target no longer exists
+	Missing int `json:"missing"`
+	// Conflicts counts entries left alone because their original path is
+	// occupied; they are also listed in Failures
+	Conflicts int `json:"conflicts"`
+	// Replaced counts the restored entries whose move had overwritten a
+	// file at the target; that file is gone and can't be brought back
+	Replaced int         `json:"replaced"`
+	Failures []MoveError `json:"-"`
+}
+
+// Undo reverses the moves recorded in a manifest written with ManifestPath,
+// moving each target back to its source in reverse order. Entries whose
+// target is gone are skipped, and entries whose source path has been taken
+// again are reported as conflicts. Missing parent directories of the sources
+// are recreated. Of opts, DryRun, Verbose, Output, Logger, AllowCrossDevice
+// and Verify apply. The error is a *RunError when some entries couldn't be
+// restored. Entries whose move overwrote a target file are restored with a
+// warning and counted as Replaced, since the overwritten file is lost.
+func Undo(ctx context.Context, manifestPath string, opts Options) (UndoResult, error) {
+	if err := validateOutput(opts.Output); err != nil {
+		return UndoResult{}, err
+	}
+	entries, err := readManifest(manifestPath)
+	if err != nil {
+		return UndoResult{}, err
+	}
+
+	logger := newLogger(&opts)
+	m := &mover{opts: &opts, stats: &Statistics{}, log: logger, errLog: newErrorLog(logger)}
+	if opts.Output == OutputJSON {
+		m.out = newJSONOutput(os.Stdout)
+	}
+
+	var result UndoResult
+	for _, e := range slices.Backward(entries) {
+		if ctx.Err() != nil {
+			break
+		}
+		switch m.undoEntry(e) {
+		case undoRestored:
+			result.Restored++
+			if e.Replaced {
+				result.Replaced++
+			}
+		case undoMissing:
+			result.Missing++
+		case undoConflict:
+			result.Conflicts++
+		}
+	}
+
+	m.errLog.flush()
+	result.Failures = m.failures.list()
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if len(result.Failures) > 0 {
+		return result, &RunError{Errors: int64(len(result.Failures)), Failures: result.Failures}
+	}
+	return result, nil
+}
+
+// readManifest loads the entries of a manifest in the order they were
+// written. A crash may leave the last line cut short, so a malformed final
+// line is ignored.
+func readManifest(path string) ([]ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open manifest: %w", err)
+	}
+	defer f.Close()
+
+	var entries []ManifestEntry
+	var lineErr error
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if lineErr != nil {
+			return nil, lineErr
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			lineErr = fmt.Errorf("manifest line %d: %w", line, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %w", err)
+	}
+	return entries, nil
+}
+
+// undoOutcome is what became of a manifest entry
+type undoOutcome int
+
+const (
+	undoRestored undoOutcome = iota
+	undoMissing
+	undoConflict
+	undoFailed
+)
+
+// undoEntry moves one entry's target back to its source
+func (m *mover) undoEntry(e ManifestEntry) undoOutcome {
+	info, err := os.Lstat(e.Target)
+	if err != nil {
+		m.logOp(opEvent{Op: "skipped", Source: e.Target, Target: e.Source, Reason: "missing"}, "Skipping entry, target no longer exists: %s\n", e.Target)
+		return undoMissing
+	}
+	if _, err := os.Lstat(e.Source); err == nil {
+		m.recordError(MoveError{Op: "undo", SourcePath: e.Target, TargetPath: e.Source, Err: errSourceOccupied}, "Cannot restore %s: %v", e.Target)
+		return undoConflict
+	}
+
+	m.logOp(opEvent{Op: "moved", Source: e.Target, Target: e.Source, Size: e.Size}, "Restoring: %s -> %s\n", e.Target, e.Source)
+	if e.Replaced {
+		m.logger().Warn("The file this move overwrote is lost, restoring only the moved one", "target", e.Target)
+	}
+	if m.opts.DryRun {
+		return undoRestored
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.Source), 0755); err != nil {
+		m.recordError(MoveError{Op: "mkdir", SourcePath: e.Target, TargetPath: e.Source, Err: err}, "Cannot recreate parent of %s: %v", e.Source)
+		return undoFailed
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		err = moveSymlink(e.Target, e.Source)
+	case info.IsDir():
+		err = os.Rename(e.Target, e.Source)
+	default:
+		err = m.moveFile(e.Target, e.Source, info, false)
+	}
+	if err != nil {
+		m.recordError(MoveError{Op: "undo", SourcePath: e.Target, TargetPath: e.Source, Err: err}, "Failed to restore %s: %v", e.Target)
+		return undoFailed
+	}
+	return undoRestored
+}
+
+// moveSymlink recreates a symlink at newpath and removes the old one, which
+// works across filesystems
+func moveSymlink(oldpath, newpath string) error {
+	link, err := os.Readlink(oldpath)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(link, newpath); err != nil {
+		return err
+	}
+	return os.Remove(oldpath)
+}
@@ -0,0 +1,246 @@
+package mvmv
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchSettle is how long a new file must go unmodified before it is moved
+const DefaultWatchSettle = 2 * time.Second
+
+// watch monitors the seed source paths for files created after the main pass
+// and feeds them to the worker pool once they stop changing. It returns when
+// the watch duration elapses or ctx is cancelled; files still being written
+// at that point are left in place.
+func (m *mover) watch(ctx context.Context, seeds []Job, jobs *jobQueue, jobsWg *sync.WaitGroup) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot start watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	for _, seed := range seeds {
+		addWatchTree(watcher, seed.SourcePath)
+	}
+
+	settle := m.opts.WatchSettle
+	if settle <= 0 {
+		settle = DefaultWatchSettle
+	}
+
+	// pending maps a source file to the time it last changed
+	pending := make(map[string]time.Time)
+	markTree := func(root string) {
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				pending[path] = time.Now()
+			}
+			return nil
+		})
+	}
+
+	deadline := time.NewTimer(m.opts.Watch)
+	defer deadline.Stop()
+	ticker := time.NewTicker(settle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-deadline.C:
+			m.unsettled.Store(int64(len(pending)))
+			if m.opts.Verbose && len(pending) > 0 {
+				m.printInfo("Watch ended with %d unsettled files left in source\n", len(pending))
+			}
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+					delete(pending, event.Name)
+				}
+				continue
+			}
+
+			info, err := os.Lstat(event.Name)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				// Files may land in a new directory before its watch is added
+				addWatchTree(watcher, event.Name)
+				markTree(event.Name)
+			} else if info.Mode().IsRegular() {
+				pending[event.Name] = time.Now()
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if m.opts.Verbose {
+				m.logger().Error("Watch error", "error", err)
+			}
+
+		case now := <-ticker.C:
+			for path, changed := range pending {
+				if now.Sub(changed) < settle {
+					continue
+				}
+				delete(pending, path)
+				if !m.opts.NoIgnore && filepath.Base(path) == ignoreFileName {
+					// Ignore files stay in the source, as in the main pass
+					continue
+				}
+
+				job, ok := m.watchJob(seeds, path)
+				if !ok {
+					continue
+				}
+				rules, ok := m.watchAncestors(job)
+				if !ok {
+					continue
+				}
+				job.ignore = rules
+				if m.opts.Flatten {
+					job.TargetPath = filepath.Join(job.TargetRoot, filepath.Base(path))
+				}
+				// A filtered file is still queued, to be skipped and reported
+				// like in the main pass, but nothing is created for it
+				if !m.opts.DryRun && !m.watchFiltered(job) {
+					if err := mkdirTarget(filepath.Dir(job.TargetPath), 0755, m.opts); err != nil {
+						m.recordError(MoveError{Op: "mkdir", SourcePath: job.SourcePath, TargetPath: job.TargetPath, Err: err}, "Cannot create directory for %s: %v", job.TargetPath)
+						continue
+					}
+				}
+
+				jobsWg.Add(1)
+				m.tracker.queue(job)
+				jobs.push(job)
+			}
+		}
+	}
+}
+
+// watchJob builds the job for a file that appeared under one of the seeds.
+// It reports false for a file outside the seeds.
+func (m *mover) watchJob(seeds []Job, path string) (Job, bool) {
+	for _, seed := range seeds {
+		rel, err := filepath.Rel(seed.SourcePath, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return Job{
+			SourcePath: path,
+			TargetPath: filepath.Join(seed.TargetPath, rel),
+			SourceRoot: seed.SourceRoot,
+			TargetRoot: seed.TargetRoot,
+		}, true
+	}
+	return Job{}, false
+}
+
+// watchAncestors loads the ignore files from the source root down to the
+// directory of a watch job's file, as processDir does on its way down. It
+// reports false, leaving the file in the source, when processPath or
+// processDir would have left one of those directories there: filtered,
+// excluded, ignored, or existing at the target at MaxDepth.
+func (m *mover) watchAncestors(job Job) (*ignoreRules, bool) {
+	rules := m.loadIgnore(nil, job.SourceRoot)
+	rel, err := filepath.Rel(job.SourceRoot, filepath.Dir(job.SourcePath))
+	if err != nil {
+		return nil, false
+	}
+	reason, depth := "", 0
+	dir, targetDir := job.SourceRoot, job.TargetRoot
+	if rel != "." {
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			dir = filepath.Join(dir, name)
+			if m.opts.Flatten {
+				targetDir = job.TargetRoot
+			} else {
+				targetDir = filepath.Join(targetDir, name)
+			}
+			depth++
+
+			info, err := os.Lstat(dir)
+			if err != nil {
+				// Gone again; processPath finds out
+				break
+			}
+			if m.opts.Filter != nil {
+				if d := m.opts.Filter(dir, info); d == FilterSkip || d == FilterPrune {
+					reason = "filter"
+					break
+				}
+			}
+			if m.excluded(dir) {
+				reason = "excluded"
+				break
+			}
+			if rules.ignored(dir, true) {
+				reason = "ignored"
+				break
+			}
+			if m.opts.MaxDepth > 0 && depth >= m.opts.MaxDepth {
+				if _, err := os.Lstat(targetDir); err == nil {
+					m.skip(SkipMaxDepth, opEvent{Source: job.SourcePath, Target: job.TargetPath}, "Skipping file below existing directory at max depth: %s\n", job.SourcePath)
+					return nil, false
+				}
+			}
+			rules = m.loadIgnore(rules, dir)
+		}
+	}
+	if reason != "" {
+		info, err := os.Lstat(job.SourcePath)
+		if err != nil {
+			return nil, false
+		}
+		m.skipFiltered(job.SourcePath, info, reason)
+		return nil, false
+	}
+	return rules, true
+}
+
+// watchFiltered reports whether the file of a watch job will be left in
+// the source by a filter, exclude pattern or ignore rule
+func (m *mover) watchFiltered(job Job) bool {
+	info, err := os.Lstat(job.SourcePath)
+	if err != nil {
+		// Gone again; processPath finds out
+		return true
+	}
+	if m.opts.Filter != nil {
+		if d := m.opts.Filter(job.SourcePath, info); d == FilterSkip || d == FilterPrune {
+			return true
+		}
+	}
+	return m.excluded(job.SourcePath) || job.ignore.ignored(job.SourcePath, false) || m.filterFile(job.SourcePath, info) != ""
+}
+
+// addWatchTree watches root and every directory below it, ignoring
+// directories that can no longer be read
+func addWatchTree(watcher *fsnotify.Watcher, root string) {
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			_ = watcher.Add(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,125 @@
+package mvmv
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stallWatch is the state of the watchdog between two checks
+type stallWatch struct {
+	progress int64
+	since    time.Time
+	warned   bool
+}
+
+// watchStalls checks every quarter of StallTimeout whether the run still
+// makes progress, until done is closed
+func (m *mover) watchStalls(done <-chan struct{}) {
+	interval := m.opts.StallTimeout / 4
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	w := &stallWatch{progress: m.progressCount(), since: time.Now()}
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			m.checkStall(w, now)
+		}
+	}
+}
+
+// checkStall warns once no counter has moved for StallTimeout while some
+// worker is busy, naming what each busy worker is stuck on. With StallAbort
+// the run is then stopped. It reports whether a stall was found.
+func (m *mover) checkStall(w *stallWatch, now time.Time) bool {
+	busy := m.tracker.busy()
+	if progress := m.progressCount(); progress != w.progress || len(busy) == 0 {
+		if w.warned && len(busy) > 0 {
+			m.logger().Warn("Progress resumed after stall")
+		}
+		*w = stallWatch{progress: progress, since: now}
+		return false
+	}
+	if w.warned || now.Sub(w.since) < m.opts.StallTimeout {
+		return false
+	}
+	w.warned = true
+
+	paths := make([]string, 0, len(busy))
+	for _, b := range busy {
+		paths = append(paths, b.path)
+		m.logger().Warn("Worker stalled", "worker", b.id, "source", b.path, "busy_for", now.Sub(b.started).Round(time.Second).String())
+	}
+	m.logger().Warn(fmt.Sprintf("No progress for %s", now.Sub(w.since).Round(time.Second)), "busy_workers", len(busy))
+
+	if m.opts.StallAbort {
+		err := fmt.Errorf("%w: no progress for %s on %s", ErrStalled, now.Sub(w.since).Round(time.Second), strings.Join(paths, ", "))
+		m.recordError(MoveError{Op: "stall", SourcePath: busy[0].path, Err: err}, "Stopping stalled run at %s: %v", busy[0].path)
+		m.abortStalled()
+	}
+	return true
+}
+
+// progressCount sums the counters that advance as the run gets work done,
+// including bytes copied so far by copies still in progress
+func (m *mover) progressCount() int64 {
+	n := m.copied.Load()
+	for _, c := range counterMetrics {
+		n += atomic.LoadInt64(c.value(m.stats))
+	}
+	for r := range m.stats.Skipped {
+		n += atomic.LoadInt64(&m.stats.Skipped[r])
+	}
+	return n
+}
+
+// abortStalled stops a stalled run without waiting for the stuck workers
+func (m *mover) abortStalled() {
+	m.stallOnce.Do(func() {
+		m.stalled.Store(true)
+		if m.cancel != nil {
+			m.cancel()
+		}
+		close(m.stallAbort)
+	})
+}
+
+// waitJobs waits for every queued job to finish, or for the run to be
+// aborted as stalled, in which case it reports false and leaves the stuck
+// workers behind
+func (m *mover) waitJobs(jobsWg *sync.WaitGroup) bool {
+	if m.stallAbort == nil {
+		jobsWg.Wait()
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		jobsWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-m.stallAbort:
+		return false
+	}
+}
+
+// countingReader adds the bytes read to a counter, so the watchdog sees a
+// long copy advance
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,24 @@
+package mvmv
+
+import "runtime"
+
+// AutoWorkers as Options.Workers picks the number of workers from the
+// storage involved: a few when a source or target is on a spinning disk,
+// where parallel access mostly adds seeks, and one per CPU core otherwise
+// or when the storage type can't be told
+const AutoWorkers = -1
+
+// rotationalWorkers is the AutoWorkers count for spinning disks
+const rotationalWorkers = 2
+
+// autoWorkers returns the AutoWorkers count for the seeds' sources and targets
+func autoWorkers(seeds []Job) (workers int, rot bool) {
+	for _, seed := range seeds {
+		for _, path := range []string{seed.SourceRoot, existingTarget(seed.TargetRoot)} {
+			if r, ok := rotational(path); ok && r {
+				return rotationalWorkers, true
+			}
+		}
+	}
+	return runtime.NumCPU(), false
+}
@@ -0,0 +1,94 @@
+//go:build linux
+
+package mvmv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// xattrsSupported reports whether copyXattrs can preserve extended attributes here
+const xattrsSupported = true
+
+// copyXattrs gives target every extended attribute of source, which
+// includes SELinux labels and POSIX ACLs. It fails with
+// errXattrsUnsupported when either filesystem has no extended attributes.
+func copyXattrs(source, target string) error {
+	names, err := listXattrs(source)
+	if err != nil {
+		return xattrError("list", source, err)
+	}
+	for _, name := range names {
+		value, err := getXattr(source, name)
+		if errors.Is(err, unix.ENODATA) {
+			// Removed since it was listed
+			continue
+		}
+		if err != nil {
+			return xattrError("get "+name, source, err)
+		}
+		if err := unix.Lsetxattr(target, name, value, 0); err != nil {
+			return xattrError("set "+name, target, err)
+		}
+	}
+	return nil
+}
+
+// xattrError wraps err, mapping a filesystem without extended attributes
+// to errXattrsUnsupported
+func xattrError(op, path string, err error) error {
+	if errors.Is(err, unix.ENOTSUP) {
+		return fmt.Errorf("%s %s: %w", op, path, errXattrsUnsupported)
+	}
+	return fmt.Errorf("%s %s: %w", op, path, err)
+}
+
+// listXattrs returns the names of path's extended attributes
+func listXattrs(path string) ([]string, error) {
+	buf, err := readXattrBuf(func(dest []byte) (int, error) {
+		return unix.Llistxattr(path, dest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range bytes.Split(buf, []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// getXattr returns the value of one of path's extended attributes
+func getXattr(path, name string) ([]byte, error) {
+	return readXattrBuf(func(dest []byte) (int, error) {
+		return unix.Lgetxattr(path, name, dest)
+	})
+}
+
+// readXattrBuf calls read with a buffer of the size it asks for, growing it
+// when the attributes change in between
+func readXattrBuf(read func([]byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size)
+		n, err := read(buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package mvmv
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPreserveXattrs(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file.txt")
+	dst := filepath.Join(t.TempDir(), "file.txt")
+	createFile(t, src, "content")
+	if err := unix.Lsetxattr(src, "user.mvmv", []byte("label"), 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			t.Skip("temporary directory has no user extended attributes")
+		}
+		t.Fatalf("Failed to set xattr: %v", err)
+	}
+
+	m := &mover{opts: &Options{PreserveXattrs: true}, stats: &Statistics{}}
+	if err := m.copyFile(src, dst, statFile(t, src)); err != nil {
+		t.Fatalf("copyFile failed: %v", err)
+	}
+
+	value := make([]byte, 64)
+	n, err := unix.Lgetxattr(dst, "user.mvmv", value)
+	if err != nil {
+		t.Fatalf("Copy lacks the xattr: %v", err)
+	}
+	if got := string(value[:n]); got != "label" {
+		t.Errorf("xattr = %q, want %q", got, "label")
+	}
+
+	dir := filepath.Join(t.TempDir(), "dir")
+	if err := m.createDir(dst, dir, statFile(t, dst)); err != nil {
+		t.Fatalf("createDir failed: %v", err)
+	}
+	if _, err := unix.Lgetxattr(dir, "user.mvmv", value); err != nil {
+		t.Errorf("Created directory lacks the xattr: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package mvmv
+
+// xattrsSupported reports whether copyXattrs can preserve extended attributes here
+const xattrsSupported = false
+
+// copyXattrs does nothing, since extended attributes are only copied on Linux
+func copyXattrs(source, target string) error {
+	return nil
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/eicca/mvmv/internal/testhooks"
+	"github.com/eicca/mvmv/pkg/mvmv"
+	"github.com/spf13/cobra"
+)
+
+// errInterrupted is returned by runMove when a signal cancelled the run.
+var errInterrupted = errors.New("interrupted")
+
+// runMove is the main entry point for the move command
+func runMove(cmd *cobra.Command, args []string) error {
+	// Arguments are valid at this point; don't bury runtime errors under usage.
+	cmd.SilenceUsage = true
+
+	ctx, stop := interruptContext(cmd.Context())
+	defer stop()
+
+	shard, _ := cmd.Flags().GetBool("shard")
+	opts, err := moveOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	subdir, _ := cmd.Flags().GetString("target-subdir")
+	inSubdir := func(target string) (string, error) {
+		if subdir == "" {
+			return target, nil
+		}
+		path, err := mvmv.TargetSubdir(target, subdir, opts)
+		if err == nil && opts.DryRun {
+			// The subdirectory may only exist in a real run, and the run
+			// reports creating it
+			opts.CreateTarget = true
+		}
+		return path, err
+	}
+
+	if shard {
+		targets := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			target, err := inSubdir(cleanPath(arg))
+			if err != nil {
+				return err
+			}
+			targets = append(targets, target)
+		}
+		result, err := mvmv.Shard(ctx, cleanPath(args[0]), targets, opts)
+		printShards(&result, &opts)
+		printResult(&result, &opts)
+		return interrupted(ctx, partial(err, completedAny(&result)))
+	}
+
+	var transfers []mvmv.Transfer
+	if fromFile, _ := cmd.Flags().GetString("from-file"); fromFile != "" {
+		transfers, err = mvmv.ReadTransfers(fromFile)
+		if err != nil {
+			return usageError{err}
+		}
+	} else {
+		target, err := inSubdir(cleanPath(args[len(args)-1]))
+		if err != nil {
+			return err
+		}
+		for _, arg := range args[:len(args)-1] {
+			sources, err := mvmv.ExpandSource(arg)
+			if err != nil {
+				return err
+			}
+			for _, source := range sources {
+				transfers = append(transfers, mvmv.ParseTransfer(source, target))
+			}
+		}
+	}
+	result, err := mvmv.MoveAll(ctx, transfers, opts)
+	printResult(&result, &opts)
+	return interrupted(ctx, partial(err, completedAny(&result)))
+}
+
+// moveOptions builds the options of a move from the flags of cmd
+func moveOptions(cmd *cobra.Command) (mvmv.Options, error) {
+	workers, err := workersFlag(cmd)
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+
+	buffer, _ := cmd.Flags().GetInt("buffer")
+	stats, _ := cmd.Flags().GetBool("stats")
+	statsInterval, _ := cmd.Flags().GetDuration("stats-interval")
+	if statsInterval == 0 {
+		// The library takes zero for its default
+		statsInterval = -1
+	}
+	resourceStats, _ := cmd.Flags().GetBool("resource-stats")
+	countDirBytes, _ := cmd.Flags().GetBool("count-dir-bytes")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	output, _ := cmd.Flags().GetString("output")
+	manifestPath, _ := cmd.Flags().GetString("manifest")
+	summaryDepth, err := summaryFlag(cmd)
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	checkpointPath, _ := cmd.Flags().GetString("checkpoint")
+	resume, _ := cmd.Flags().GetBool("resume")
+	logFormat, _ := cmd.Flags().GetString("log-format")
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	logger, err := newLogger(logFormat, logLevel)
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	progress := stats && output != mvmv.OutputJSON && mvmv.IsTerminal(os.Stdout)
+	moveSymlinks, _ := cmd.Flags().GetBool("move-symlinks")
+	rewriteSymlinks, _ := cmd.Flags().GetBool("rewrite-symlinks")
+	followSymlinks, _ := cmd.Flags().GetBool("follow-symlinks")
+	skipSpecial, _ := cmd.Flags().GetBool("skip-special")
+	skipIfInTarget, _ := cmd.Flags().GetBool("skip-if-in-target")
+	indexBy, _ := cmd.Flags().GetString("index-by")
+	hashDenylist, _ := cmd.Flags().GetString("hash-denylist")
+	deleteDenied, _ := cmd.Flags().GetBool("delete-denied")
+	debugSignal, _ := cmd.Flags().GetBool("debug-signal")
+	stallTimeout, _ := cmd.Flags().GetDuration("stall-timeout")
+	stallAbort, _ := cmd.Flags().GetBool("stall-abort")
+	timings, _ := cmd.Flags().GetBool("timings")
+	checksumManifest, _ := cmd.Flags().GetBool("checksum-manifest")
+	metricsAddr, _ := cmd.Flags().GetString("metrics")
+	atomicDirs, _ := cmd.Flags().GetBool("atomic-dirs")
+	flatten, _ := cmd.Flags().GetBool("flatten")
+	prefix, _ := cmd.Flags().GetString("prefix")
+	suffix, _ := cmd.Flags().GetString("suffix")
+	pruneEmpty, _ := cmd.Flags().GetBool("prune-empty")
+	keepTree, _ := cmd.Flags().GetBool("keep-tree")
+	caseCollisions, _ := cmd.Flags().GetString("case-collisions")
+	maxDepth, _ := cmd.Flags().GetInt("max-depth")
+	syncDirPerms, _ := cmd.Flags().GetBool("sync-dir-perms")
+	deleteSource, _ := cmd.Flags().GetBool("delete-source-on-success")
+	noReplace, _ := cmd.Flags().GetBool("no-replace")
+	crossDevice, _ := cmd.Flags().GetBool("cross-device")
+	checkSpace, _ := cmd.Flags().GetBool("check-space")
+	hardLinks, _ := cmd.Flags().GetBool("hard-links")
+	verify, _ := cmd.Flags().GetBool("verify")
+	replaceMismatched, _ := cmd.Flags().GetBool("replace-mismatched")
+	fsync, _ := cmd.Flags().GetBool("fsync")
+	maxOpenFiles, _ := cmd.Flags().GetInt("max-open-files")
+	preserveOwnership, _ := cmd.Flags().GetBool("preserve-ownership")
+	preserveXattrs, _ := cmd.Flags().GetBool("xattrs")
+	if archive, _ := cmd.Flags().GetBool("archive"); archive {
+		// Where ownership or extended attributes can't be kept, Move warns
+		// and goes on without them
+		preserveOwnership, preserveXattrs, hardLinks = true, true, true
+	}
+	createTarget, _ := cmd.Flags().GetBool("mkdir")
+	overwrite, _ := cmd.Flags().GetBool("overwrite")
+	overwriteNewer, _ := cmd.Flags().GetBool("overwrite-newer")
+	conflictRename, _ := cmd.Flags().GetBool("conflict-rename")
+	deleteIdentical, _ := cmd.Flags().GetBool("delete-identical")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	showConflicts, _ := cmd.Flags().GetBool("show-conflicts")
+	showSkipped, _ := cmd.Flags().GetBool("show-skipped")
+	if showConflicts || showSkipped {
+		dryRun = true
+	}
+	ordered, _ := cmd.Flags().GetBool("ordered")
+	shardBy, _ := cmd.Flags().GetString("shard-by")
+	watch, _ := cmd.Flags().GetDuration("watch")
+	watchSettle, _ := cmd.Flags().GetDuration("watch-settle")
+	include, _ := cmd.Flags().GetStringArray("include")
+	exclude, _ := cmd.Flags().GetStringArray("exclude")
+	minSize, err := sizeFlag(cmd, "min-size")
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	maxSize, err := sizeFlag(cmd, "max-size")
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	rateLimit, err := sizeFlag(cmd, "bwlimit")
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	copyBuffer, err := sizeFlag(cmd, "copy-buffer")
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	noTempFile, _ := cmd.Flags().GetBool("no-temp-file")
+	dirMode, err := modeFlag(cmd, "dir-mode")
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	now := time.Now()
+	newerThan, err := timeFlag(cmd, "newer-than", now)
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	olderThan, err := timeFlag(cmd, "older-than", now)
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	noIgnore, _ := cmd.Flags().GetBool("no-ignore")
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
+	inaccessible, _ := cmd.Flags().GetString("inaccessible")
+	maxErrors, maxErrorPercent, err := maxErrorsFlag(cmd)
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	faults, err := simulateErrorsFlag(cmd)
+	if err != nil {
+		return mvmv.Options{}, err
+	}
+	retries, _ := cmd.Flags().GetInt("retries")
+	retryDelay, _ := cmd.Flags().GetDuration("retry-delay")
+
+	opts := mvmv.Options{
+		Workers:       workers,
+		Buffer:        buffer,
+		Stats:         stats,
+		StatsInterval: statsInterval,
+		Verbose:       verbose,
+		Quiet:         quiet,
+		DryRun:        dryRun,
+		ShowConflicts: showConflicts,
+		ShowSkipped:   showSkipped,
+		Ordered:       ordered,
+		ShardBy:       shardBy,
+
+		Watch:       watch,
+		WatchSettle: watchSettle,
+
+		ResourceStats: resourceStats,
+		CountDirBytes: countDirBytes,
+
+		MoveSymlinks:    moveSymlinks,
+		RewriteSymlinks: rewriteSymlinks,
+		FollowSymlinks:  followSymlinks,
+		SkipSpecial:     skipSpecial,
+
+		SkipIfInTarget: skipIfInTarget,
+		IndexBy:        indexBy,
+
+		HashDenylist: hashDenylist,
+		DeleteDenied: deleteDenied,
+
+		CreateTarget:      createTarget,
+		DirMode:           dirMode,
+		Overwrite:         overwrite,
+		OverwriteNewer:    overwriteNewer,
+		ReplaceMismatched: replaceMismatched,
+		ConflictRename:    conflictRename,
+		DeleteIdentical:   deleteIdentical,
+		AllowCrossDevice:  crossDevice,
+		CheckSpace:        checkSpace,
+		PreserveHardLinks: hardLinks,
+		RateLimit:         rateLimit,
+		CopyBufferSize:    int(copyBuffer),
+		NoTempFile:        noTempFile,
+		MaxOpenFiles:      maxOpenFiles,
+		Verify:            verify,
+		Fsync:             fsync,
+
+		PreserveOwnership: preserveOwnership,
+		PreserveXattrs:    preserveXattrs,
+
+		NoReplace:        noReplace,
+		AtomicDirs:       atomicDirs,
+		Flatten:          flatten,
+		PruneEmpty:       pruneEmpty,
+		KeepTree:         keepTree,
+		CaseCollisions:   caseCollisions,
+		MaxDepth:         maxDepth,
+		SyncDirPerms:     syncDirPerms,
+		DebugSignal:      debugSignal,
+		StallTimeout:     stallTimeout,
+		StallAbort:       stallAbort,
+		Timings:          timings,
+		ChecksumManifest: checksumManifest,
+		MetricsAddr:      metricsAddr,
+
+		DeleteSourceOnSuccess: deleteSource,
+
+		Include: include,
+		Exclude: exclude,
+		MinSize: minSize,
+		MaxSize: maxSize,
+
+		NewerThan: newerThan,
+		OlderThan: olderThan,
+
+		NoIgnore: noIgnore,
+
+		Retries:    retries,
+		RetryDelay: retryDelay,
+
+		Logger:         logger,
+		ManifestPath:   manifestPath,
+		SummaryDepth:   summaryDepth,
+		CheckpointPath: checkpointPath,
+		Resume:         resume,
+
+		FailFast:        failFast,
+		MaxErrors:       maxErrors,
+		MaxErrorPercent: maxErrorPercent,
+		Inaccessible:    inaccessible,
+		Progress:        progress,
+		Output:          output,
+	}
+	if prefix != "" || suffix != "" {
+		opts.TargetNameTransform = mvmv.AffixName(prefix, suffix)
+	}
+	if faults != nil {
+		testhooks.SetFaultInjector(&opts, faults)
+	}
+	return opts, nil
+}
+
+// completedAny reports whether a run moved, copied or deduplicated anything
+func completedAny(result *mvmv.Result) bool {
+	return result.FilesMoved+result.FilesOverwritten+result.FilesDeduplicated+
+		result.DirsRenamed+result.SymlinksMoved+result.SymlinksFollowed > 0
+}
+
+// printShards lists where a sharded run sent each top-level entry, in
+// text output; the JSON report has them as its shards
+func printShards(result *mvmv.Result, opts *mvmv.Options) {
+	if opts.Output == mvmv.OutputJSON || opts.Quiet {
+		return
+	}
+	for _, a := range result.Shards {
+		fmt.Printf("Shard: %s -> %s\n", a.Entry, a.Target)
+	}
+}
+
+// printResult prints the final statistics in text output when asked for
+// them. An interrupted run always reports how far it got.
+func printResult(result *mvmv.Result, opts *mvmv.Options) {
+	if opts.Output == mvmv.OutputJSON || opts.Quiet || result.StartTime.IsZero() {
+		// The run never started, or the JSON report already covered it
+		return
+	}
+	printStats := opts.Stats || opts.ResourceStats || result.Interrupted
+	if printStats {
+		result.PrintStats(os.Stdout, opts)
+	}
+	if opts.SummaryDepth > 0 {
+		if printStats {
+			fmt.Println()
+		}
+		result.PrintSummary(os.Stdout)
+	}
+}
+
+// interruptContext returns a context that is cancelled on the first SIGINT or
+// SIGTERM, letting in-flight operations finish. A second signal exits the
+// process immediately.
+func interruptContext(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(os.Stderr, "\nInterrupted, finishing in-flight operations (press Ctrl-C again to force exit)")
+		cancel()
+
+		select {
+		case <-sigs:
+			fmt.Fprintln(os.Stderr, "Forced exit")
+			os.Exit(exitInterrupted)
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+}
+
+// interrupted replaces the error of a run stopped by a signal with
+// errInterrupted so main can exit with the dedicated status.
+func interrupted(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return errInterrupted
+	}
+	return err
+}
+
+// cleanPath normalizes a command-line path into an absolute path
+func cleanPath(p string) string {
+	cleaned := filepath.Clean(p)
+
+	if !filepath.IsAbs(cleaned) {
+		abs, err := filepath.Abs(cleaned)
+		if err == nil {
+			cleaned = abs
+		}
+	}
+
+	return cleaned
+}
+
+// moveArgs checks the positional arguments: none with --from-file, which
+// lists the transfers itself, and otherwise at least a source and a target
+func moveArgs(cmd *cobra.Command, args []string) error {
+	if !cmd.Flags().Changed("from-file") {
+		return cobra.MinimumNArgs(2)(cmd, args)
+	}
+	if shard, _ := cmd.Flags().GetBool("shard"); shard {
+		return fmt.Errorf("--from-file can't be combined with --shard")
+	}
+	if cmd.Flags().Changed("target-subdir") {
+		return fmt.Errorf("--from-file can't be combined with --target-subdir, the list names every target")
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("--from-file takes no SOURCE or TARGET arguments, got %d", len(args))
+	}
+	return nil
+}
+
+// workersFlag parses --workers: a count, "auto" for mvmv.AutoWorkers, or
+// unset for one worker per CPU core
+func workersFlag(cmd *cobra.Command) (int, error) {
+	value, _ := cmd.Flags().GetString("workers")
+	switch value {
+	case "":
+		return runtime.NumCPU(), nil
+	case "auto":
+		return mvmv.AutoWorkers, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, usageError{fmt.Errorf("--workers: want a number of workers or auto, got %q", value)}
+	}
+	if n == 0 {
+		n = runtime.NumCPU()
+	}
+	return n, nil
+}
+
+// maxErrorsFlag parses --max-errors: a count of failures, or a percentage
+// of the entries scanned such as "5%"; unset is no limit
+func maxErrorsFlag(cmd *cobra.Command) (count int, percent float64, err error) {
+	value, _ := cmd.Flags().GetString("max-errors")
+	if value == "" {
+		return 0, 0, nil
+	}
+	if p, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err = strconv.ParseFloat(p, 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			return 0, 0, usageError{fmt.Errorf("--max-errors: want a percentage between 0 and 100, got %q", value)}
+		}
+		return 0, percent, nil
+	}
+	count, err = strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		return 0, 0, usageError{fmt.Errorf("--max-errors: want a number of errors or a percentage, got %q", value)}
+	}
+	return count, 0, nil
+}
+
+// simulateErrorsFlag parses the hidden --simulate-errors into a fault
+// injector failing that percentage of renames with EIO; nil when unset
+func simulateErrorsFlag(cmd *cobra.Command) (func(string) error, error) {
+	percent, _ := cmd.Flags().GetFloat64("simulate-errors")
+	if percent < 0 || percent > 100 {
+		return nil, usageError{fmt.Errorf("--simulate-errors: want a percentage between 0 and 100, got %g", percent)}
+	}
+	if percent == 0 {
+		return nil, nil
+	}
+	return func(path string) error {
+		if rand.Float64()*100 >= percent {
+			return nil
+		}
+		return &os.PathError{Op: "rename", Path: path, Err: fmt.Errorf("simulated failure: %w", syscall.EIO)}
+	}, nil
+}
+
+// summaryFlag parses --summary and --summary-depth into the depth of the
+// summary tree; 0 means no summary
+func summaryFlag(cmd *cobra.Command) (int, error) {
+	summary, _ := cmd.Flags().GetString("summary")
+	depth, _ := cmd.Flags().GetInt("summary-depth")
+	switch {
+	case summary == "":
+		return 0, nil
+	case summary != "tree":
+		return 0, usageError{fmt.Errorf("--summary: unknown summary %q (want tree)", summary)}
+	case depth < 1:
+		return 0, usageError{fmt.Errorf("--summary-depth: want at least 1 level, got %d", depth)}
+	}
+	return depth, nil
+}
+
+// sizeFlag parses a size flag such as --min-size; an unset flag is 0
+func sizeFlag(cmd *cobra.Command, name string) (int64, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return 0, nil
+	}
+	size, err := mvmv.ParseSize(value)
+	if err != nil {
+		return 0, usageError{fmt.Errorf("--%s: %w", name, err)}
+	}
+	return size, nil
+}
+
+// modeFlag parses an octal permissions flag such as --dir-mode; an unset
+// flag is 0
+func modeFlag(cmd *cobra.Command, name string) (os.FileMode, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, usageError{fmt.Errorf("--%s: want octal permissions between 1 and 0777, got %q", name, value)}
+	}
+	return os.FileMode(mode), nil
+}
+
+// timeFlag parses a time flag such as --newer-than relative to now; an
+// unset flag is the zero time
+func timeFlag(cmd *cobra.Command, name string, now time.Time) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := mvmv.ParseTime(value, now)
+	if err != nil {
+		return time.Time{}, usageError{fmt.Errorf("--%s: %w", name, err)}
+	}
+	return t, nil
+}
+
+// newLogger builds the logger for --log-format and --log-level, writing to
+// stderr
+func newLogger(format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, usageError{fmt.Errorf("--log-level: unknown level %q (want debug, info, warn or error)", level)}
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, usageError{fmt.Errorf("--log-format: unknown format %q (want text or json)", format)}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestMoveOptionsArchive(t *testing.T) {
+	tests := []struct {
+		name                    string
+		args                    []string
+		ownership, xattrs, hard bool
+	}{
+		{"default", nil, false, false, false},
+		{"archive", []string{"--archive"}, true, true, true},
+		{"archive short", []string{"-a"}, true, true, true},
+		{"hard links only", []string{"--hard-links"}, false, false, true},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		addMoveFlags(cmd)
+		if err := cmd.ParseFlags(tt.args); err != nil {
+			t.Fatalf("%s: ParseFlags(%v) failed: %v", tt.name, tt.args, err)
+		}
+		opts, err := moveOptions(cmd)
+		if err != nil {
+			t.Fatalf("%s: moveOptions failed: %v", tt.name, err)
+		}
+		if opts.PreserveOwnership != tt.ownership || opts.PreserveXattrs != tt.xattrs || opts.PreserveHardLinks != tt.hard {
+			t.Errorf("%s: ownership, xattrs, hard links = %v, %v, %v; want %v, %v, %v", tt.name,
+				opts.PreserveOwnership, opts.PreserveXattrs, opts.PreserveHardLinks, tt.ownership, tt.xattrs, tt.hard)
+		}
+	}
+}
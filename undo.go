@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/eicca/mvmv/pkg/mvmv"
+	"github.com/spf13/cobra"
+)
+
+// runUndo reverses the moves recorded in a manifest
+func runUndo(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	ctx, stop := interruptContext(cmd.Context())
+	defer stop()
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	output, _ := cmd.Flags().GetString("output")
+	crossDevice, _ := cmd.Flags().GetBool("cross-device")
+	verify, _ := cmd.Flags().GetBool("verify")
+	logFormat, _ := cmd.Flags().GetString("log-format")
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	logger, err := newLogger(logFormat, logLevel)
+	if err != nil {
+		return err
+	}
+
+	opts := mvmv.Options{
+		DryRun:           dryRun,
+		Verbose:          verbose,
+		Output:           output,
+		AllowCrossDevice: crossDevice,
+		Verify:           verify,
+		Logger:           logger,
+	}
+
+	result, err := mvmv.Undo(ctx, args[0], opts)
+
+	// Only a run that got going has a summary to show
+	var runErr *mvmv.RunError
+	if err != nil && !errors.As(err, &runErr) && ctx.Err() == nil {
+		return err
+	}
+	if output == mvmv.OutputJSON {
+		json.NewEncoder(os.Stdout).Encode(result)
+	} else {
+		fmt.Printf("Restored: %d, missing: %d, conflicts: %d\n", result.Restored, result.Missing, result.Conflicts)
+		if result.Replaced > 0 {
+			fmt.Printf("Overwritten at the target and not recoverable: %d\n", result.Replaced)
+		}
+	}
+	return interrupted(ctx, partial(err, result.Restored > 0))
+}